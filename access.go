@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const inactiveCheckInterval = 24 * time.Hour
+
+// lastAccessed keep time of the last successful GET or HEAD of wiki, keyed
+// by full path. It is not persisted, so after restart all wikis are treated
+// as not accessed.
+// TODO: keep it in a small JSON or BoltDB file.
+var lastAccessed sync.Map
+
+func recordAccess(fullPath string) {
+	lastAccessed.Store(fullPath, time.Now())
+}
+
+func lastAccess(fullPath string) (time.Time, bool) {
+	v, ok := lastAccessed.Load(fullPath)
+	if !ok {
+		return time.Time{}, false
+	}
+	return v.(time.Time), true
+}
+
+// dayDuration is a time.Duration flag accepting also days, e.g. "90d".
+type dayDuration time.Duration
+
+func (d *dayDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *dayDuration) Set(s string) error {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		*d = dayDuration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = dayDuration(v)
+
+	return nil
+}
+
+var cleanupInactive dayDuration
+
+// checkInactive log wikis not accessed within period. Wikis not accessed
+// since start are reported only when server runs longer than period.
+func checkInactive(period time.Duration) {
+	now := time.Now()
+
+	for _, v := range allVhosts() {
+		users := knownUsers(v)
+
+		// without authentication wikis are served by handler of "" user
+		v.handlers.mu.RLock()
+		if v.handlers.find("") != nil {
+			users = append(users, "")
+		}
+		v.handlers.mu.RUnlock()
+
+		for _, user := range users {
+			userPath := v.userDir(user)
+
+			wikis, err := listUserWikis(userPath)
+			if err != nil {
+				continue
+			}
+
+			for _, w := range wikis {
+				fullPath := filepath.Join(userPath, w.Name)
+
+				last, ok := lastAccess(fullPath)
+				if !ok {
+					last = startTime
+				}
+
+				if now.Sub(last) <= period {
+					continue
+				}
+				if user == "" {
+					log.Printf("warning: wiki %s not accessed since %s\n", filepath.Join(userPath, w.Name), last.Format(time.RFC3339))
+					continue
+				}
+				log.Printf("warning: wiki %s of %s not accessed since %s\n",
+					w.Name, v.label(user), last.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+func inactiveLoop(period time.Duration) {
+	ticker := time.NewTicker(inactiveCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkInactive(period)
+	}
+}
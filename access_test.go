@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckInactiveNoAuth(t *testing.T) {
+	defer func(v *vhost, s time.Time) { defaultVhost, startTime = v, s }(defaultVhost, startTime)
+
+	dir := t.TempDir()
+	for _, name := range []string{"old.html", "new.html"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defaultVhost = &vhost{davDir: dir}
+	addHandler(&defaultVhost.handlers, "", dir)
+	startTime = time.Now().Add(-48 * time.Hour)
+	recordAccess(filepath.Join(dir, "new.html"))
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	checkInactive(24 * time.Hour)
+
+	out := buf.String()
+	if !strings.Contains(out, "old.html not accessed") {
+		t.Errorf("old.html not reported: %q", out)
+	}
+	if strings.Contains(out, "new.html") {
+		t.Errorf("new.html reported: %q", out)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+)
+
+var (
+	allowSpec string
+	denySpec  string
+
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+)
+
+// ipAllowed check client address against -allow and -deny lists; deny
+// takes precedence.
+func ipAllowed(ip net.IP) bool {
+	if ip == nil {
+		return len(allowNets) == 0 && len(denyNets) == 0
+	}
+
+	if containsIP(denyNets, ip) {
+		return false
+	}
+
+	return len(allowNets) == 0 || containsIP(allowNets, ip)
+}
+
+// ipFilter reject requests from addresses not allowed by -allow and -deny.
+func ipFilter(next http.Handler) http.Handler {
+	if len(allowNets) == 0 && len(denyNets) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !ipAllowed(net.ParseIP(ip)) {
+			log.Printf("access denied for %s\n", ip)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAllowed(t *testing.T) {
+	defer func(a, d []*net.IPNet) { allowNets, denyNets = a, d }(allowNets, denyNets)
+
+	tests := []struct {
+		allow, deny string
+		ip          string
+		want        bool
+	}{
+		{"", "", "192.0.2.1", true},
+		// allow only
+		{"192.0.2.0/24", "", "192.0.2.1", true},
+		{"192.0.2.0/24", "", "198.51.100.1", false},
+		{"192.0.2.0/24, 2001:db8::/32", "", "2001:db8::1", true},
+		// deny only
+		{"", "198.51.100.7", "198.51.100.7", false},
+		{"", "198.51.100.7", "198.51.100.8", true},
+		// deny takes precedence
+		{"192.0.2.0/24", "192.0.2.128/25", "192.0.2.200", false},
+		{"192.0.2.0/24", "192.0.2.128/25", "192.0.2.1", true},
+	}
+
+	for _, tt := range tests {
+		var err error
+		if allowNets, err = parseCIDRs(tt.allow); err != nil {
+			t.Fatal(err)
+		}
+		if denyNets, err = parseCIDRs(tt.deny); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ipAllowed(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("ipAllowed(%s) with allow %q, deny %q = %v, want %v", tt.ip, tt.allow, tt.deny, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	defer func(a, d []*net.IPNet) { allowNets, denyNets = a, d }(allowNets, denyNets)
+
+	allowNets, _ = parseCIDRs("192.0.2.0/24")
+	denyNets = nil
+
+	h := ipFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		remote string
+		want   int
+	}{
+		{"192.0.2.1:1000", http.StatusNoContent},
+		{"198.51.100.1:1000", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if rec.Code != tt.want {
+			t.Errorf("request from %s: status %d, want %d", tt.remote, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestParseCIDRsError(t *testing.T) {
+	for _, spec := range []string{"192.0.2.0/33", "example.com", "192.0.2.1,x"} {
+		if _, err := parseCIDRs(spec); err == nil {
+			t.Errorf("parseCIDRs(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var (
+	tlsACME         string
+	tlsACMECache    string
+	tlsACMEHTTPPort string
+)
+
+// acmeEnabled report if certificates are obtained with ACME; certificate
+// given by -tlscert and -tlskey takes precedence.
+func acmeEnabled() bool {
+	return tlsACME != "" && (tlsCert == "" || tlsKey == "")
+}
+
+// acmeListen return address to listen on: port 443 unless -http is set
+// explicitly.
+func acmeListen(addr string) string {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "http" {
+			explicit = true
+		}
+	})
+
+	if explicit {
+		return addr
+	}
+
+	return ":443"
+}
+
+func newACMEManager() *autocert.Manager {
+	var hosts []string
+	for _, h := range strings.Split(tlsACME, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(tlsACMECache),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+	}
+}
+
+// serveACMEChallenge answer HTTP-01 challenges and redirect other plain
+// HTTP requests to HTTPS.
+func serveACMEChallenge(m *autocert.Manager) {
+	s := &http.Server{
+		Addr:              net.JoinHostPort("", tlsACMEHTTPPort),
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	log.Printf("Listening for ACME challenges on '%s'", s.Addr)
+	if err := s.ListenAndServe(); err != nil {
+		log.Printf("acme challenge listener error: %v\n", err)
+	}
+}
+
+// acmeProtos are ALPN protocols including the one used by TLS-ALPN-01
+// challenge.
+var acmeProtos = []string{"h2", "http/1.1", acme.ALPNProto}
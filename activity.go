@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	activityDays    = 90
+	activityMaxDays = 3660
+)
+
+type activityDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// countActivity group save times by calendar day in loc; only days since
+// the start of the day days-1 before now are counted.
+func countActivity(times []time.Time, now time.Time, days int, loc *time.Location) []activityDay {
+	now = now.In(loc)
+	since := time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, loc)
+
+	counts := make(map[string]int)
+	for _, t := range times {
+		if t.Before(since) {
+			continue
+		}
+		counts[t.In(loc).Format(time.DateOnly)]++
+	}
+
+	result := make([]activityDay, 0, len(counts))
+	for date, count := range counts {
+		result = append(result, activityDay{Date: date, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+
+	return result
+}
+
+// serveActivity handle GET /api/v1/wikis/<wiki>/activity: number of saves
+// of wiki per day, taken from its backups.
+func serveActivity(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+
+	days := activityDays
+	if s := q.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > activityMaxDays {
+			jsonError(w, http.StatusBadRequest, "invalid days")
+			return
+		}
+		days = n
+	}
+
+	loc := time.Local
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid tz")
+			return
+		}
+		loc = l
+	}
+
+	fullPath := resolveWiki(req.userPath, wiki)
+	if fullPath == "" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+
+	if code := req.wikiAccess(r, fullPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	var times []time.Time
+	if backupsEnabled {
+		backups, err := listBackups(wikiBackupPath(req.site, req.user, wiki))
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, b := range backups {
+			times = append(times, b.CreatedAt)
+		}
+	} else {
+		// without backups only the last save is known
+		times = append(times, fi.ModTime())
+	}
+
+	writeJSON(w, http.StatusOK, countActivity(times, time.Now(), days, loc))
+}
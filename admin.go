@@ -0,0 +1,205 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const adminPrefix = "/admin/"
+
+var admins = make(map[string]bool)
+
+func parseAdmins(list string) {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			admins[name] = true
+		}
+	}
+}
+
+func isAdmin(user string) bool {
+	return user != "" && admins[user]
+}
+
+type adminUser struct {
+	Name       string `json:"name"`
+	UsageBytes int64  `json:"usage_bytes"`
+}
+
+type adminWiki struct {
+	Name       string `json:"name"`
+	SizeBytes  int64  `json:"size_bytes"`
+	ModifiedAt string `json:"modified_at"`
+}
+
+// knownUsers return names of all users of virtual host.
+func knownUsers(v *vhost) []string {
+	names := make(map[string]bool)
+	for _, u := range v.userNames() {
+		names[u] = true
+	}
+
+	v.handlers.mu.RLock()
+	for _, h := range v.handlers.list {
+		if h.name != "" {
+			names[h.name] = true
+		}
+	}
+	v.handlers.mu.RUnlock()
+
+	result := make([]string, 0, len(names))
+	for u := range names {
+		result = append(result, u)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func listUserWikis(userPath string) ([]adminWiki, error) {
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []adminWiki{}, nil
+		}
+		return nil, err
+	}
+
+	result := []adminWiki{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".html") {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		result = append(result, adminWiki{
+			Name:       e.Name(),
+			SizeBytes:  info.Size(),
+			ModifiedAt: info.ModTime().Format(time.RFC3339),
+		})
+	}
+
+	return result, nil
+}
+
+// serveAdmin handle /admin/ routes. Caller must check that user is admin
+// and hold lock of admin's own handler.
+func serveAdmin(w http.ResponseWriter, r *http.Request, req *apiRequest) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, adminPrefix), "/"), "/")
+	if len(parts) == 0 || parts[0] != "users" {
+		jsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	v := req.site
+	known := knownUsers(v)
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		result := make([]adminUser, 0, len(known))
+		for _, u := range known {
+			usage, err := dirSize(v.userDir(u))
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("admin: usage of %s error: %v\n", u, err)
+			}
+			result = append(result, adminUser{Name: u, UsageBytes: usage})
+		}
+
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	name := parts[1]
+	if !slices.Contains(known, name) {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	userPath := v.userDir(name)
+	if userPath == "" {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if len(parts) < 3 || parts[2] != "wikis" {
+		jsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if len(parts) == 3 {
+		if r.Method != http.MethodGet {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		wikis, err := listUserWikis(userPath)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, wikis)
+		return
+	}
+
+	wiki := strings.Join(parts[3:], "/")
+	fullPath := filepath.Clean(path.Join(userPath, wiki))
+	if !strings.HasSuffix(wiki, ".html") || !strings.HasPrefix(fullPath, userPath+"/") {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	target := req.handler
+	if name != req.user {
+		// lock of admin's handler is released first, so two admins deleting
+		// wikis of each other can not deadlock
+		req.handler.mu.Unlock()
+		defer req.handler.mu.Lock()
+
+		v.handlers.mu.RLock()
+		target = v.handlers.find(name)
+		v.handlers.mu.RUnlock()
+
+		if target != nil {
+			target.mu.Lock()
+			defer target.mu.Unlock()
+		}
+	}
+
+	if err := os.Remove(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			jsonError(w, http.StatusNotFound, "wiki not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	keep := r.URL.Query().Get("keep-backups") == "true"
+	cleanupDeleted(target, fullPath, wikiBackupPath(v, name, wiki), keep)
+	journal("delete user=%q wiki=%q keep_backups=%v remote=%s", req.user, fullPath, keep, clientIP(r))
+
+	log.Printf("admin %s deleted %s\n", req.user, fullPath)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const apiPrefix = "/api/v1/"
+
+// apiRequest holds state of authenticated request passed to API handlers.
+type apiRequest struct {
+	site     *vhost
+	user     string
+	pass     string
+	handler  *userHandler
+	userPath string
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write json response error: %v\n", err)
+	}
+}
+
+func jsonError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// serveAPI dispatch requests under /api/v1/. Caller must authenticate
+// request and hold handler lock.
+func serveAPI(w http.ResponseWriter, r *http.Request, req *apiRequest) {
+	route := strings.TrimPrefix(r.URL.Path, apiPrefix)
+
+	switch {
+	case route == "wikis":
+		serveWikiList(w, r, req)
+	case route == "export":
+		serveExport(w, r, req)
+	case route == "wikis/import":
+		serveImport(w, r, req)
+	case route == "wikis/verify-all":
+		serveVerify(w, r, req, "")
+	case strings.HasPrefix(route, "wikis/") && strings.HasSuffix(route, "/verify"):
+		serveVerify(w, r, req, strings.TrimSuffix(strings.TrimPrefix(route, "wikis/"), "/verify"))
+	case strings.HasPrefix(route, "wikis/") && strings.HasSuffix(route, "/watch"):
+		serveWatch(w, r, req, strings.TrimSuffix(strings.TrimPrefix(route, "wikis/"), "/watch"))
+	case strings.HasPrefix(route, "wikis/") && strings.HasSuffix(route, "/share"):
+		serveShare(w, r, req, strings.TrimSuffix(strings.TrimPrefix(route, "wikis/"), "/share"))
+	case strings.HasPrefix(route, "wikis/") && strings.HasSuffix(route, "/tiddlers"):
+		serveTiddlers(w, r, req, strings.TrimSuffix(strings.TrimPrefix(route, "wikis/"), "/tiddlers"))
+	case strings.HasPrefix(route, "wikis/") && strings.HasSuffix(route, "/activity"):
+		serveActivity(w, r, req, strings.TrimSuffix(strings.TrimPrefix(route, "wikis/"), "/activity"))
+	case strings.HasPrefix(route, "wikis/") && strings.HasSuffix(route, "/snapshot"):
+		serveSnapshot(w, r, req, strings.TrimSuffix(strings.TrimPrefix(route, "wikis/"), "/snapshot"))
+	case strings.HasPrefix(route, "wikis/") && strings.Contains(route, "/store/"):
+		idx := strings.LastIndex(route, "/store/")
+		serveStore(w, r, req, strings.TrimPrefix(route[:idx], "wikis/"), route[idx+len("/store/"):])
+	case strings.HasPrefix(route, "backups/"):
+		serveBackups(w, r, req, strings.TrimPrefix(route, "backups/"))
+	case strings.HasPrefix(route, "wikis/"):
+		serveWikis(w, r, req, strings.TrimPrefix(route, "wikis/"))
+	default:
+		jsonError(w, http.StatusNotFound, "not found")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	auditLogPath string
+	auditLog     *auditWriter
+
+	auditMethods = map[string]bool{
+		http.MethodPut:    true,
+		http.MethodDelete: true,
+		"MOVE":            true,
+		"COPY":            true,
+	}
+
+	auditEscaper = strings.NewReplacer("|", "%7C", "\n", "%0A", "\r", "%0D")
+)
+
+// auditWriter append records of write operations to audit log. File is
+// opened in append mode and never truncated.
+type auditWriter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openAuditLog(path string) (*auditWriter, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %s error: %w", path, err)
+	}
+	return &auditWriter{f: f}, nil
+}
+
+// record write line timestamp|username|method|path|client_ip|bytes_written.
+func (a *auditWriter) record(user, method, path, ip string, n int64) error {
+	line := fmt.Sprintf("%s|%s|%s|%s|%s|%d\n", time.Now().Format(time.RFC3339),
+		auditEscaper.Replace(user), method, auditEscaper.Replace(path), ip, n)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err := a.f.WriteString(line)
+	return err
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// auditRequest prepare write request for auditing; returned function
+// record it when it succeeded. reqPath is the path requested by client.
+func auditRequest(w http.ResponseWriter, r *http.Request, user, reqPath string) (http.ResponseWriter, func()) {
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = body
+
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+
+	return sw, func() {
+		if sw.code >= http.StatusMultipleChoices {
+			return
+		}
+
+		if err := auditLog.record(user, r.Method, reqPath, clientIP(r), body.n); err != nil {
+			log.Printf("audit log error: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	userAutoCreate bool
+	userSkel       string
+)
+
+// createUserDir create directory of user and fill it with content of
+// -user.skel. Existing directory is left untouched.
+func createUserDir(uPath string) error {
+	if _, err := os.Stat(uPath); !os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.Mkdir(uPath, 0o700); err != nil {
+		return err
+	}
+
+	if userSkel == "" {
+		return nil
+	}
+
+	if err := copySkel(userSkel, uPath); err != nil {
+		// do not leave half-copied skeleton, next request will retry
+		os.RemoveAll(uPath)
+		return err
+	}
+
+	log.Printf("created %s from %s\n", uPath, userSkel)
+
+	return nil
+}
+
+// copySkel copy files and directories of src into dst.
+func copySkel(src, dst string) error {
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, 0o700)
+		case d.Type().IsRegular():
+			return copyFile(p, target)
+		default:
+			// symlinks could point outside of user directory
+			return nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("copy skeleton %s error: %w", src, err)
+	}
+
+	return nil
+}
+
+// autoCreateHandler return handler for authenticated user without one when
+// -user.auto-create is set; directory is created on first request.
+func (v *vhost) autoCreateHandler(user string) *userHandler {
+	if !userAutoCreate || !validUserName(user) {
+		return nil
+	}
+
+	return v.handlers.findOrAdd(user, v.userDir(user))
+}
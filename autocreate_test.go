@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserAutoCreate(t *testing.T) {
+	defer func(a bool, s string) { userAutoCreate, userSkel = a, s }(userAutoCreate, userSkel)
+
+	skel := t.TempDir()
+	writeTestFiles(t, skel, "wiki.html", "docs/notes.html")
+	if err := os.Symlink("/etc/passwd", filepath.Join(skel, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	v := &vhost{auth: "basic", davDir: dir, users: map[string]string{
+		"alice": testHash(t, "alice"),
+	}}
+	h := wikiHandler(v)
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/wiki.html", nil)
+		r.SetBasicAuth("alice", "alice")
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		return rec
+	}
+	userPath := filepath.Join(dir, "alice")
+
+	userAutoCreate, userSkel = false, skel
+	if rec := get(); rec.Code != http.StatusNotFound {
+		t.Errorf("GET without -user.auto-create: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if _, err := os.Stat(userPath); !os.IsNotExist(err) {
+		t.Errorf("directory created without -user.auto-create: %v", err)
+	}
+
+	userAutoCreate = true
+	if rec := get(); rec.Code != http.StatusOK || rec.Body.String() != "wiki.html" {
+		t.Errorf("first GET: status %d, body %q", rec.Code, rec.Body)
+	}
+
+	fi, err := os.Stat(userPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o700 {
+		t.Errorf("user directory mode %v, want %v", fi.Mode().Perm(), os.FileMode(0o700))
+	}
+	if data, err := os.ReadFile(filepath.Join(userPath, "docs", "notes.html")); err != nil || string(data) != "docs/notes.html" {
+		t.Errorf("skeleton file %q, error %v", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(userPath, "link")); !os.IsNotExist(err) {
+		t.Errorf("symlink copied from skeleton: %v", err)
+	}
+
+	// second login keeps user content
+	if err := os.WriteFile(filepath.Join(userPath, "wiki.html"), []byte("edited"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get(); rec.Code != http.StatusOK || rec.Body.String() != "edited" {
+		t.Errorf("second GET: status %d, body %q", rec.Code, rec.Body)
+	}
+}
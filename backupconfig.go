@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// wikiConfigExt is extension of per-wiki configuration file, e.g.
+// notes.html.widdler configures notes.html.
+const wikiConfigExt = ".widdler"
+
+// backupConfig control backups of one wiki.
+type backupConfig struct {
+	// MinAge is minimal time between backups in seconds.
+	MinAge   int
+	Files    int
+	Compress bool
+}
+
+// wikiConfig is content of per-wiki configuration file; missing values are
+// taken from command line.
+type wikiConfig struct {
+	Backup struct {
+		Age      *int  `toml:"age"`
+		Files    *int  `toml:"files"`
+		Compress *bool `toml:"compress"`
+	} `toml:"backup"`
+}
+
+// defaultBackupConfig return backup configuration from command line.
+func defaultBackupConfig() backupConfig {
+	return backupConfig{MinAge: backupMinAge, Files: backupFiles, Compress: backupCompress}
+}
+
+// wikiBackupConfig return backup configuration of wiki at fullPath. The
+// configuration file is read every time, so changes apply without restart.
+func wikiBackupConfig(fullPath string) backupConfig {
+	cfg := defaultBackupConfig()
+
+	var wc wikiConfig
+	if _, err := toml.DecodeFile(fullPath+wikiConfigExt, &wc); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("read %s error: %v\n", fullPath+wikiConfigExt, err)
+		}
+		return cfg
+	}
+
+	if wc.Backup.Age != nil {
+		cfg.MinAge = *wc.Backup.Age
+	}
+	if wc.Backup.Files != nil && *wc.Backup.Files > 0 {
+		cfg.Files = *wc.Backup.Files
+	}
+	if wc.Backup.Compress != nil {
+		cfg.Compress = *wc.Backup.Compress
+	}
+
+	return cfg
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWikiBackupConfig(t *testing.T) {
+	defer func(a, f int, c bool) { backupMinAge, backupFiles, backupCompress = a, f, c }(backupMinAge, backupFiles, backupCompress)
+	backupMinAge, backupFiles, backupCompress = 60, 10, false
+
+	tests := []struct {
+		config string
+		want   backupConfig
+	}{
+		{"", backupConfig{60, 10, false}},
+		{"[backup]\nage = 3600\n", backupConfig{3600, 10, false}},
+		{"[backup]\nage = 0\nfiles = 3\ncompress = true\n", backupConfig{0, 3, true}},
+		// invalid number of files is ignored
+		{"[backup]\nfiles = 0\n", backupConfig{60, 10, false}},
+		{"[backup\nage = 1\n", backupConfig{60, 10, false}},
+	}
+
+	for _, tt := range tests {
+		fullPath := filepath.Join(t.TempDir(), "a.html")
+		if tt.config != "" {
+			if err := os.WriteFile(fullPath+wikiConfigExt, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := wikiBackupConfig(fullPath); got != tt.want {
+			t.Errorf("config %q: %+v, want %+v", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestCreateBackupWikiAge(t *testing.T) {
+	defer func(a int) { backupMinAge = a }(backupMinAge)
+	backupMinAge = 3600
+
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		config string
+		second bool
+	}{
+		{"global.html", "", false},
+		{"short.html", "[backup]\nage = 0\n", true},
+		{"long.html", "[backup]\nage = 3600\n", false},
+	}
+
+	for _, tt := range tests {
+		fullPath := filepath.Join(dir, tt.name)
+		backupPath := filepath.Join(dir, "backups", tt.name)
+		defer forgetBackupAge(fullPath)
+
+		writeTestFiles(t, dir, tt.name)
+		if tt.config != "" {
+			if err := os.WriteFile(fullPath+wikiConfigExt, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i, want := range []bool{true, tt.second} {
+			if err := createBackup(fullPath, backupPath, wikiBackupConfig(fullPath), false); err != nil {
+				t.Fatal(err)
+			}
+
+			matches, _ := filepath.Glob(backupPath[:len(backupPath)-len(".html")] + "-*")
+			if got := len(matches) > 0; got != want {
+				t.Errorf("%s: backup %d created %v, want %v", tt.name, i+1, got, want)
+			}
+			for _, m := range matches {
+				os.Remove(m)
+			}
+		}
+	}
+}
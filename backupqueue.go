@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Backups are created by pool of workers, so saving a wiki does not wait
+// for the copy. Before PUT the live file is copied to a snapshot, which is
+// consumed by a worker after the new content is written.
+
+type backupJob struct {
+	src        string
+	path       string
+	backupPath string
+	now        time.Time
+	cfg        backupConfig
+}
+
+const (
+	// backupRestartDelay is delay before restart of panicked worker; it is
+	// doubled on every panic up to backupRestartMaxDelay.
+	backupRestartDelay    = time.Second
+	backupRestartMaxDelay = 30 * time.Second
+)
+
+var (
+	backupWorkers   int
+	backupQueueSize int
+
+	backupQueue chan backupJob
+	backupWG    sync.WaitGroup
+
+	backupLocks sync.Map
+
+	// runBackupJob write backup of job; replaced in tests.
+	runBackupJob = func(job backupJob) error {
+		return writeBackup(job.src, job.backupPath, job.now, job.cfg)
+	}
+)
+
+// lockBackups serialize writes to backups of one wiki.
+func lockBackups(backupPath string) func() {
+	v, _ := backupLocks.LoadOrStore(backupPath, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+
+	return mu.Unlock
+}
+
+func startBackupWorkers(workers, queueSize int) {
+	backupQueue = make(chan backupJob, queueSize)
+
+	for i := 0; i < workers; i++ {
+		backupWG.Add(1)
+		go backupWorker()
+	}
+}
+
+// backupWorker process queued backups; worker is restarted after panic,
+// with growing delay when it panics again before finishing any job.
+func backupWorker() {
+	defer backupWG.Done()
+
+	delay := backupRestartDelay
+	for {
+		closed, processed := processBackups()
+		if closed {
+			return
+		}
+		if processed > 0 {
+			delay = backupRestartDelay
+		}
+
+		log.Printf("restarting backup worker in %s\n", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, backupRestartMaxDelay)
+	}
+}
+
+// processBackups write queued backups until queue is closed or some job
+// panics. Return number of finished jobs.
+func processBackups() (closed bool, processed int) {
+	var job backupJob
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("backup %s panic: %v\n%s", job.path, p, debug.Stack())
+			os.Remove(job.src)
+		}
+	}()
+
+	for job = range backupQueue {
+		if err := runBackupJob(job); err != nil {
+			log.Printf("backup %s error: %v\n", job.path, err)
+		}
+
+		if err := os.Remove(job.src); err != nil {
+			log.Printf("remove snapshot %s error: %v\n", job.src, err)
+		}
+		processed++
+	}
+
+	return true, processed
+}
+
+// safeCreateBackup call createBackup; panic is logged and returned as
+// error.
+func safeCreateBackup(path, backupPath string, cfg backupConfig, force bool) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("backup %s panic: %v\n%s", path, p, debug.Stack())
+			err = fmt.Errorf("backup %s panic: %v", path, p)
+		}
+	}()
+
+	return createBackup(path, backupPath, cfg, force)
+}
+
+// stopBackupWorkers wait until queued backups are written.
+func stopBackupWorkers(ctx context.Context) bool {
+	if backupQueue == nil {
+		return true
+	}
+
+	close(backupQueue)
+
+	done := make(chan struct{})
+	go func() {
+		backupWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// queueBackup prepare backup of fullPath before it is overwritten. Returned
+// function must be called after write with its result: on success backup
+// is queued, otherwise the previous content is restored. Without workers
+// backup is created synchronously. Caller must hold handler lock.
+func queueBackup(fullPath, backupPath string) (func(ok bool), error) {
+	noop := func(bool) {}
+	cfg := wikiBackupConfig(fullPath)
+
+	if backupQueue == nil {
+		return noop, safeCreateBackup(fullPath, backupPath, cfg, false)
+	}
+
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		return noop, nil
+	}
+
+	now := time.Now()
+	if !backupDue(fullPath, now, cfg.MinAge) {
+		return noop, nil
+	}
+
+	if len(backupQueue) >= cap(backupQueue) {
+		log.Printf("warning: backup queue full, skipping backup of %s\n", fullPath)
+		return noop, nil
+	}
+
+	snapshot := filepath.Join(filepath.Dir(fullPath),
+		fmt.Sprintf(".%s.%d.snapshot", filepath.Base(fullPath), now.UnixNano()))
+	// live file stays in place, so it is never missing for readers; WebDAV
+	// writes into the same inode, so hard link can not be used
+	if err := copyFile(fullPath, snapshot); err != nil {
+		return noop, fmt.Errorf("create snapshot of %s error: %w", fullPath, err)
+	}
+
+	return func(ok bool) {
+		if !ok {
+			// failed write may leave the wiki truncated
+			_ = os.Chmod(snapshot, fi.Mode().Perm())
+			if err := os.Rename(snapshot, fullPath); err != nil {
+				log.Printf("restore snapshot %s error: %v\n", snapshot, err)
+			}
+			return
+		}
+
+		select {
+		case backupQueue <- backupJob{src: snapshot, path: fullPath, backupPath: backupPath, now: now, cfg: cfg}:
+		default:
+			log.Printf("warning: backup queue full, skipping backup of %s\n", fullPath)
+			os.Remove(snapshot)
+		}
+	}, nil
+}
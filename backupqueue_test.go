@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readTestFile(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestQueueBackup(t *testing.T) {
+	defer func(q chan backupJob) { backupQueue = q }(backupQueue)
+
+	for _, ok := range []bool{true, false} {
+		backupQueue = make(chan backupJob, 1)
+
+		dir := t.TempDir()
+		fullPath := filepath.Join(dir, "a.html")
+		if err := os.WriteFile(fullPath, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		finish, err := queueBackup(fullPath, filepath.Join(dir, "backups", "a.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// wiki is readable while it is written
+		if got := readTestFile(t, fullPath); got != "old" {
+			t.Fatalf("wiki during write = %q, want %q", got, "old")
+		}
+
+		if err := os.WriteFile(fullPath, []byte("new"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		finish(ok)
+
+		if !ok {
+			if got := readTestFile(t, fullPath); got != "old" {
+				t.Errorf("wiki after failed write = %q, want %q", got, "old")
+			}
+			if len(backupQueue) != 0 {
+				t.Errorf("backup queued after failed write")
+			}
+			continue
+		}
+
+		if got := readTestFile(t, fullPath); got != "new" {
+			t.Errorf("wiki after write = %q, want %q", got, "new")
+		}
+		select {
+		case job := <-backupQueue:
+			if got := readTestFile(t, job.src); got != "old" {
+				t.Errorf("snapshot = %q, want %q", got, "old")
+			}
+		default:
+			t.Errorf("backup not queued")
+		}
+	}
+}
+
+func TestBackupWorkerRestart(t *testing.T) {
+	defer func(run func(backupJob) error) { runBackupJob = run }(runBackupJob)
+
+	done := make(chan string, 2)
+	runBackupJob = func(job backupJob) error {
+		if job.path == "panic" {
+			panic("test panic")
+		}
+		done <- job.path
+		return nil
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// the second panic comes before any job is finished, so delay grows
+	startBackupWorkers(1, 3)
+	backupQueue <- backupJob{path: "panic"}
+	backupQueue <- backupJob{path: "panic"}
+	backupQueue <- backupJob{path: "next"}
+
+	select {
+	case path := <-done:
+		if path != "next" {
+			t.Errorf("processed %q, want %q", path, "next")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("job after panic not processed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !stopBackupWorkers(ctx) {
+		t.Fatal("workers not stopped")
+	}
+	backupQueue = nil
+
+	out := buf.String()
+	if !strings.Contains(out, "backup panic panic: test panic") {
+		t.Errorf("panic not logged: %q", out)
+	}
+	for _, want := range []string{"restarting backup worker in 1s", "restarting backup worker in 2s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not logged: %q", want, out)
+		}
+	}
+}
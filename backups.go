@@ -0,0 +1,667 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupTimeFormat = "20060102_150405"
+
+	backupModeFull     = "full"
+	backupModeDelta    = "delta"
+	backupModeTiddlers = "tiddlers"
+)
+
+type backupInfo struct {
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Size       int64      `json:"size"`
+	Compressed bool       `json:"compressed"`
+	Delta      bool       `json:"delta"`
+	Base       string     `json:"base,omitempty"`
+	SHA256     string     `json:"sha256,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+
+	path string
+}
+
+// checksumExt is extension of sidecar file with SHA-256 of backup content
+// (after decompression), in sha256sum format. Modification time of the
+// sidecar is the time of the last successful verification.
+const checksumExt = ".sha256"
+
+var errBackupCorrupted = errors.New("backup corrupted")
+
+// backupHash compute SHA-256 of backup content; compressed backups are
+// hashed after decompression.
+func backupHash(fname string) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	if strings.HasSuffix(fname, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("read backup %s error: %w", fname, err)
+		}
+		src = gz
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, src); err != nil {
+		return "", fmt.Errorf("read backup %s error: %w", fname, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeChecksum(fname, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(fname))
+	if err := os.WriteFile(fname+checksumExt, []byte(line), 0o600); err != nil {
+		return fmt.Errorf("write checksum of %s error: %w", fname, err)
+	}
+	return nil
+}
+
+// readChecksum return hash stored in sidecar file and time of the last
+// verification.
+func readChecksum(fname string) (string, time.Time, error) {
+	data, err := os.ReadFile(fname + checksumExt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	fi, err := os.Stat(fname + checksumExt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+
+	return sum, fi.ModTime(), nil
+}
+
+// verifyBackup compare content of backup with hash from its sidecar file.
+// Sidecar is created for backups without it and its modification time is
+// updated after successful verification.
+func verifyBackup(path string) error {
+	sum, err := backupHash(path)
+	if err != nil {
+		return err
+	}
+
+	stored, _, err := readChecksum(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read checksum of %s error: %w", path, err)
+	}
+
+	if stored != "" && stored != sum {
+		return fmt.Errorf("%s: checksum mismatch: %w", filepath.Base(path), errBackupCorrupted)
+	}
+
+	return writeChecksum(path, sum)
+}
+
+// checkBackup verify just written backup against expected hash. Invalid
+// backup is removed.
+func checkBackup(fname, want string) error {
+	got, err := backupHash(fname)
+	if err == nil && got != want {
+		err = fmt.Errorf("%s: checksum mismatch: %w", filepath.Base(fname), errBackupCorrupted)
+	}
+
+	if err != nil {
+		os.Remove(fname)
+		return err
+	}
+
+	return recordBackup(fname, got)
+}
+
+// userBackupDir return directory where backups of user wikis are stored.
+// Relative -backup.dir is located in user directory; absolute one get
+// subdirectory for each user.
+func userBackupDir(v *vhost, user string) string {
+	if v == sharedSite {
+		// shared wikis do not belong to any user
+		user = ""
+	}
+
+	if filepath.IsAbs(backupDir) {
+		if v != defaultVhost {
+			return path.Join(backupDir, v.name, user)
+		}
+		return path.Join(backupDir, user)
+	}
+	return path.Join(v.userDir(user), backupDir)
+}
+
+// wikiBackupPath return base path of backups for wiki (relative to user
+// directory).
+func wikiBackupPath(v *vhost, user, wiki string) string {
+	return filepath.Clean(path.Join(userBackupDir(v, user), wiki))
+}
+
+// listBackups find all backups for backupPath, newest first.
+func listBackups(backupPath string) ([]backupInfo, error) {
+	ext := filepath.Ext(backupPath)
+	base := backupPath[0 : len(backupPath)-len(ext)]
+
+	var files []string
+	entries, err := readManifest(filepath.Dir(backupPath))
+	switch {
+	case err == nil:
+		for _, e := range entries {
+			files = append(files, filepath.Join(filepath.Dir(backupPath), e.File))
+		}
+	case os.IsNotExist(err):
+		// backups created before manifests were introduced
+		files, err = filepath.Glob(base + "-*")
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("read manifest error: %w", err)
+	}
+
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(filepath.Base(base)) +
+		`-(\d{8}_\d{6})` + regexp.QuoteMeta(ext) + `(\.delta)?(\.gz)?$`)
+
+	result := make([]backupInfo, 0, len(files))
+	for _, fname := range files {
+		m := re.FindStringSubmatch(filepath.Base(fname))
+		if m == nil {
+			continue
+		}
+
+		fi, err := os.Stat(fname)
+		if err != nil {
+			continue
+		}
+
+		created, err := time.ParseInLocation(backupTimeFormat, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+
+		b := backupInfo{
+			Name:       filepath.Base(fname),
+			CreatedAt:  created,
+			Size:       fi.Size(),
+			Compressed: m[3] != "",
+			Delta:      m[2] != "",
+			path:       fname,
+		}
+
+		if sum, verified, err := readChecksum(fname); err == nil {
+			b.SHA256, b.VerifiedAt = sum, &verified
+		}
+
+		if b.Delta {
+			base, _, f, err := openDeltaFile(fname)
+			if err != nil {
+				log.Printf("invalid delta backup %s: %v\n", fname, err)
+				continue
+			}
+			f.Close()
+			b.Base = base
+		}
+
+		result = append(result, b)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name > result[j].Name
+	})
+
+	return result, nil
+}
+
+// backupStem return backup name without compression and delta suffixes.
+func backupStem(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), deltaExt)
+}
+
+func findBackup(backups []backupInfo, name string) *backupInfo {
+	for i := range backups {
+		if backups[i].Name == name {
+			return &backups[i]
+		}
+	}
+	return nil
+}
+
+// backupStamp return time stamp and extension part of backup name.
+func backupStamp(name string) string {
+	stem := backupStem(name)
+	if idx := strings.LastIndex(stem, "-"); idx >= 0 {
+		return stem[idx+1:]
+	}
+	return stem
+}
+
+// findBackupBase find backup that delta was created against; base may have
+// been converted to a full backup or renamed with the wiki since.
+func findBackupBase(backups []backupInfo, base string) *backupInfo {
+	for i := range backups {
+		if backupStamp(backups[i].Name) == backupStamp(base) {
+			return &backups[i]
+		}
+	}
+	return nil
+}
+
+func openBackup(b *backupInfo) (io.ReadCloser, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.Compressed {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// readBackup return full content of backup; delta backups are reconstructed
+// by applying patches from the nearest full backup.
+func readBackup(backups []backupInfo, b *backupInfo) ([]byte, error) {
+	if !b.Delta {
+		src, err := openBackup(b)
+		if err != nil {
+			return nil, err
+		}
+		defer src.Close()
+
+		return io.ReadAll(src)
+	}
+
+	baseName, kind, patch, err := openDeltaFile(b.path)
+	if err != nil {
+		return nil, fmt.Errorf("open delta %s error: %w", b.Name, err)
+	}
+	defer patch.Close()
+
+	base := findBackupBase(backups, baseName)
+	if base == nil || base.Name >= b.Name {
+		return nil, fmt.Errorf("missing base %s for delta %s: %w", baseName, b.Name, errDeltaCorrupted)
+	}
+
+	baseData, err := readBackup(backups, base)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == tiddlerMagic {
+		return applyTiddlerDelta(baseData, patch)
+	}
+
+	return applyDelta(baseData, patch)
+}
+
+// deltaChainLength return number of deltas on top of the nearest full backup.
+func deltaChainLength(backups []backupInfo, b *backupInfo) int {
+	length := 0
+	for b != nil && b.Delta {
+		length++
+		b = findBackupBase(backups, b.Base)
+	}
+	return length
+}
+
+// materializeBackup replace delta backup by full copy, so its bases can be
+// removed.
+func materializeBackup(backups []backupInfo, b *backupInfo) error {
+	data, err := readBackup(backups, b)
+	if err != nil {
+		return err
+	}
+
+	dst := backupStem(b.path)
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		return fmt.Errorf("write backup %s error: %w", dst, err)
+	}
+
+	if err := checkBackup(dst, sha256Hex(data)); err != nil {
+		return err
+	}
+
+	os.Remove(b.path + checksumExt)
+
+	return os.Remove(b.path)
+}
+
+// restoreBackup replace live wiki with content of backup. Current state of
+// the wiki is backed up first. Caller must hold the user handler lock.
+func restoreBackup(fullPath, backupPath string, backups []backupInfo, b *backupInfo) error {
+	data, err := readBackup(backups, b)
+	if err != nil {
+		return fmt.Errorf("read backup %s error: %w", b.Name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".restore-*")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("copy backup %s error: %w", b.Name, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write temp file error: %w", err)
+	}
+
+	if _, err := os.Stat(fullPath); err == nil {
+		// always keep state before restore
+		if err := safeCreateBackup(fullPath, backupPath, wikiBackupConfig(fullPath), true); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return fmt.Errorf("replace %s error: %w", fullPath, err)
+	}
+
+	log.Printf("restored %s from %s\n", fullPath, b.Name)
+
+	return nil
+}
+
+// serveBackups handle /api/v1/backups/<wiki>: GET list backups or download
+// one with ?snapshot=<name>, POST with ?snapshot=<name> restore it or,
+// with additional verify=1, check its integrity.
+func serveBackups(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	if !strings.HasSuffix(wiki, ".html") {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	fullPath := filepath.Clean(path.Join(req.userPath, wiki))
+	if !strings.HasPrefix(fullPath, req.userPath) {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if code := req.wikiAccess(r, fullPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	backupPath := wikiBackupPath(req.site, req.user, wiki)
+
+	backups, err := listBackups(backupPath)
+	if err != nil {
+		log.Println(err)
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	snapshot := r.URL.Query().Get("snapshot")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if snapshot == "" {
+			writeJSON(w, http.StatusOK, backups)
+			return
+		}
+
+		b := findBackup(backups, snapshot)
+		if b == nil {
+			jsonError(w, http.StatusNotFound, "snapshot not found")
+			return
+		}
+
+		name := b.Name
+		if b.Delta {
+			// serve reconstructed wiki instead of patch
+			name = backupStem(name)
+
+			data, err := readBackup(backups, b)
+			if err != nil {
+				log.Println(err)
+				jsonError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+			http.ServeContent(w, r, name, b.CreatedAt, bytes.NewReader(data))
+			return
+		}
+
+		f, err := os.Open(b.path)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		http.ServeContent(w, r, name, b.CreatedAt, f)
+	case http.MethodPost:
+		if r.URL.Query().Get("verify") == "1" {
+			b := findBackup(backups, snapshot)
+			if b == nil {
+				jsonError(w, http.StatusNotFound, "snapshot not found")
+				return
+			}
+
+			if err := verifyBackup(b.path); err != nil {
+				log.Println(err)
+				code := http.StatusInternalServerError
+				if errors.Is(err, errBackupCorrupted) {
+					code = http.StatusConflict
+				}
+				jsonError(w, code, err.Error())
+				return
+			}
+
+			sum, verified, err := readChecksum(b.path)
+			if err != nil {
+				jsonError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"name":        b.Name,
+				"sha256":      sum,
+				"verified_at": verified,
+			})
+			return
+		}
+
+		if isReadOnly(fullPath) {
+			jsonError(w, http.StatusMethodNotAllowed, "wiki is read-only")
+			return
+		}
+
+		b := findBackup(backups, snapshot)
+		if b == nil {
+			jsonError(w, http.StatusNotFound, "snapshot not found")
+			return
+		}
+
+		if err := restoreBackup(fullPath, backupPath, backups, b); err != nil {
+			log.Println(err)
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"restored": b.Name})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// serveSnapshot handle POST /api/v1/wikis/<wiki>/snapshot: backup the wiki
+// now, regardless of -backup.age. Only for administrators.
+func serveSnapshot(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !isAdmin(req.user) {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	fullPath := resolveWiki(req.userPath, wiki)
+	if fullPath == "" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if _, err := os.Stat(fullPath); err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+
+	backupPath := wikiBackupPath(req.site, req.user, wiki)
+	if err := safeCreateBackup(fullPath, backupPath, wikiBackupConfig(fullPath), true); err != nil {
+		log.Println(err)
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	backups, err := listBackups(backupPath)
+	if err != nil || len(backups) == 0 {
+		jsonError(w, http.StatusInternalServerError, "backup not found")
+		return
+	}
+
+	log.Printf("user %s created snapshot %s\n", req.user, backups[0].Name)
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"backup_name": backups[0].Name,
+		"size":        backups[0].Size,
+		"created_at":  backups[0].CreatedAt,
+	})
+}
+
+// createDeltaBackup store content of path as a patch against the newest
+// backup: binary one or, in tiddlers mode, list of changed tiddlers. Return
+// false when full backup should be created instead.
+func createDeltaBackup(path, backupPath, dst string) (bool, error) {
+	backups, err := listBackups(backupPath)
+	if err != nil {
+		return false, err
+	}
+
+	// queued backups may be written after newer ones; patch must always be
+	// created against older backup
+	var prev *backupInfo
+	for i := range backups {
+		if backupStem(backups[i].Name) < backupStem(filepath.Base(dst)) {
+			prev = &backups[i]
+			break
+		}
+	}
+
+	if prev == nil {
+		return false, nil
+	}
+
+	if deltaChainLength(backups, prev) >= maxDeltaChain {
+		return false, nil
+	}
+
+	prevData, err := readBackup(backups, prev)
+	if err != nil {
+		log.Printf("read previous backup %s error: %v; creating full backup\n", prev.Name, err)
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("open %s for backup error: %w", path, err)
+	}
+
+	magic := deltaMagic
+	var delta []byte
+	if backupMode == backupModeTiddlers {
+		magic = tiddlerMagic
+		delta, err = createTiddlerDelta(prevData, data)
+		if err != nil {
+			log.Printf("tiddler delta of %s error: %v; creating full backup\n", path, err)
+			return false, nil
+		}
+	} else {
+		delta = createDelta(prevData, data)
+	}
+
+	log.Printf("backup %s -> %s (delta against %s)\n", path, dst, prev.Name)
+
+	if err := writeDeltaFile(dst, magic, prev.Name, delta); err != nil {
+		os.Remove(dst)
+		return false, err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s%s\n", magic, prev.Name)
+	h.Write(delta)
+
+	if err := checkBackup(dst, hex.EncodeToString(h.Sum(nil))); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// rebaseBackups make sure that backup file keep, which will become the
+// oldest one, does not depend on older backups.
+func rebaseBackups(backupPath, keep string) error {
+	backups, err := listBackups(backupPath)
+	if err != nil {
+		return err
+	}
+
+	for i := range backups {
+		if backups[i].path == keep && backups[i].Delta {
+			return materializeBackup(backups, &backups[i])
+		}
+	}
+
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
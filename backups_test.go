@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWikiBackupPath(t *testing.T) {
+	defer func(d string, v *vhost) { backupDir, defaultVhost = d, v }(backupDir, defaultVhost)
+
+	defaultVhost = &vhost{davDir: "/srv/wikis"}
+	other := &vhost{name: "example.com", davDir: "/srv/example"}
+
+	tests := []struct {
+		backupDir string
+		site      *vhost
+		user      string
+		wiki      string
+		want      string
+	}{
+		{"backups", defaultVhost, "alice", "/a.html", "/srv/wikis/alice/backups/a.html"},
+		{"backups", defaultVhost, "", "/a.html", "/srv/wikis/backups/a.html"},
+		{"/var/backups", defaultVhost, "alice", "/a.html", "/var/backups/alice/a.html"},
+		{"/var/backups", defaultVhost, "alice", "/dir/a.html", "/var/backups/alice/dir/a.html"},
+		{"/var/backups", defaultVhost, "bob", "a.html", "/var/backups/bob/a.html"},
+		{"/var/backups", defaultVhost, "", "/a.html", "/var/backups/a.html"},
+		{"/var/backups", other, "alice", "/a.html", "/var/backups/example.com/alice/a.html"},
+	}
+
+	for _, tt := range tests {
+		backupDir = tt.backupDir
+		if got := wikiBackupPath(tt.site, tt.user, tt.wiki); got != tt.want {
+			t.Errorf("wikiBackupPath(%s, %q, %q) with -backup.dir %s = %q, want %q",
+				tt.site.davDir, tt.user, tt.wiki, tt.backupDir, got, tt.want)
+		}
+	}
+}
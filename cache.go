@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type cacheEntry struct {
+	key  string
+	etag string
+	data []byte
+}
+
+// wikiCache is LRU cache of wiki files content limited by total size.
+type wikiCache struct {
+	mu    sync.Mutex
+	max   int64
+	size  int64
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+var sharedCache *wikiCache
+
+func newWikiCache(max int64) *wikiCache {
+	return &wikiCache{
+		max:   max,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// fileETag derive ETag from file modification time and size.
+func fileETag(fi os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
+// get return cached content of key if it is still valid for etag.
+func (c *wikiCache) get(key, etag string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if entry.etag != etag {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.data, true
+}
+
+func (c *wikiCache) put(key, etag string, data []byte) {
+	if int64(len(data)) > c.max {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, etag: etag, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate drop content of key and its compressed forms.
+func (c *wikiCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, k := range []string{key, encodedKey(key, "gzip"), encodedKey(key, "br")} {
+		if elem, ok := c.items[k]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// encodedKey return cache key of compressed form of key.
+func encodedKey(key, encoding string) string {
+	return key + "\x00" + encoding
+}
+
+// remove drop element from cache. Caller must hold c.mu.
+func (c *wikiCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.items, entry.key)
+	c.size -= int64(len(entry.data))
+}
+
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveCached serve GET or HEAD request for wiki from cache, compressed
+// with encoding when not empty. Conditional requests with matching ETag are
+// answered without reading the file.
+func serveCached(w http.ResponseWriter, r *http.Request, c *wikiCache, fullPath, encoding string) {
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := fileETag(fi)
+	w.Header().Set("ETag", etag)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatch(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, ok := c.get(fullPath, etag)
+	if !ok {
+		data, err = os.ReadFile(fullPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.put(fullPath, etag, data)
+	}
+
+	if encoding != "" {
+		key := encodedKey(fullPath, encoding)
+		encoded, ok := c.get(key, etag)
+		if !ok {
+			var buf bytes.Buffer
+			enc := newEncoder(&buf, encoding)
+			_, _ = enc.Write(data)
+			if err := enc.Close(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			encoded = buf.Bytes()
+			c.put(key, etag, encoded)
+		}
+
+		data = encoded
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Encoding", encoding)
+		// ServeContent does not set length of encoded content
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	}
+
+	http.ServeContent(w, r, filepath.Base(fullPath), fi.ModTime(), bytes.NewReader(data))
+}
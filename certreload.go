@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const tlsWatchInterval = time.Minute
+
+var tlsWatch bool
+
+// certReloader serve certificate loaded from -tlscert and -tlskey and
+// reload it when the files change, so certificates can be renewed without
+// restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	cert atomic.Pointer[tls.Certificate]
+	// modTime is modification time of the newer of the loaded files
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.load(c.filesModTime()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// filesModTime return modification time of the newer of certificate and key
+// files; zero time when any of them can not be checked.
+func (c *certReloader) filesModTime() time.Time {
+	var last time.Time
+	for _, fname := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(fname)
+		if err != nil {
+			return time.Time{}
+		}
+		if fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+	}
+
+	return last
+}
+
+func (c *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s error: %w", c.certFile, err)
+	}
+
+	c.cert.Store(&cert)
+	c.modTime = modTime
+
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// watch reload certificate when modification time of its files change.
+// On error the previous certificate is kept.
+func (c *certReloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		mt := c.filesModTime()
+		if mt.IsZero() || mt.Equal(c.modTime) {
+			continue
+		}
+
+		if err := c.load(mt); err != nil {
+			log.Printf("reload TLS certificate error: %v\n", err)
+			// do not retry until files change again
+			c.modTime = mt
+			continue
+		}
+
+		log.Printf("reloaded TLS certificate from %s\n", c.certFile)
+	}
+}
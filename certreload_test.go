@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, certFile, keyFile, cn string, mtime time.Time) {
+	t.Helper()
+
+	cert := testCert(t, cn, nil)
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for fname, block := range files {
+		if err := os.WriteFile(fname, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// modification time may have coarse resolution
+		if err := os.Chtimes(fname, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	now := time.Now()
+	writeTestCert(t, certFile, keyFile, "first", now)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go reloader.watch(10 * time.Millisecond)
+
+	// httptest.StartTLS would add own certificate
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Listener = tls.NewListener(ts.Listener, &tls.Config{GetCertificate: reloader.GetCertificate})
+	ts.Start()
+	defer ts.Close()
+	url := "https://" + ts.Listener.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		DisableKeepAlives: true,
+	}}
+	serverCN := func() string {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if cn := serverCN(); cn != "first" {
+		t.Fatalf("certificate %q, want %q", cn, "first")
+	}
+
+	waitCN := func(want string) {
+		t.Helper()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for cn := serverCN(); cn != want; cn = serverCN() {
+			if time.Now().After(deadline) {
+				t.Fatalf("certificate %q, want %q", cn, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	writeTestCert(t, certFile, keyFile, "second", now.Add(time.Minute))
+	waitCN("second")
+
+	// invalid files do not replace loaded certificate
+	if err := os.WriteFile(keyFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := now.Add(2 * time.Minute)
+	if err := os.Chtimes(keyFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if cn := serverCN(); cn != "second" {
+		t.Errorf("certificate after invalid change %q, want %q", cn, "second")
+	}
+
+	writeTestCert(t, certFile, keyFile, "third", now.Add(3*time.Minute))
+	waitCN("third")
+}
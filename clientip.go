@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRs parse comma-separated list of networks; single addresses are
+// treated as /32 (or /128) networks.
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			item = fmt.Sprintf("%s/%d", item, bits)
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", item, err)
+		}
+
+		result = append(result, network)
+	}
+
+	return result, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP return address of the connected peer.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type contextKey int
+
+const (
+	clientIPKey contextKey = iota
+	requestIDKey
+)
+
+// resolveClientIP return address of the client. For requests coming from
+// trusted proxies X-Forwarded-For is read from the right, skipping trusted
+// proxies, so the first untrusted hop is used; X-Real-IP is used when
+// X-Forwarded-For is missing. Headers are ignored when -trust.proxy is not
+// set.
+func resolveClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+
+	if len(trustedProxies) == 0 || !containsIP(trustedProxies, net.ParseIP(ip)) {
+		return ip
+	}
+
+	if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+		hops := strings.Split(strings.Join(fwd, ","), ",")
+
+		var addr net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr = net.ParseIP(strings.TrimSpace(hops[i]))
+			if addr == nil {
+				// malformed entry, do not trust anything before it
+				break
+			}
+
+			if !containsIP(trustedProxies, addr) {
+				return addr.String()
+			}
+		}
+
+		if addr != nil {
+			return addr.String()
+		}
+
+		return ip
+	}
+
+	if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+		return real.String()
+	}
+
+	return ip
+}
+
+// withClientIP store resolved client address in request context.
+func withClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey, resolveClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP return address of the client resolved by withClientIP.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r)
+}
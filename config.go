@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configFromArgs look for -config flag in args before flags are parsed.
+func configFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
+
+// flattenConfig convert nested tables into dotted keys, so
+// `[backup] dir = "x"` is the same as `"backup.dir" = "x"`.
+func flattenConfig(prefix string, values map[string]interface{}, out map[string]string) error {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenConfig(key, v, out); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			out[key] = strings.Join(items, ",")
+		case string, bool, int64, float64:
+			out[key] = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("unsupported value for key %q", key)
+		}
+	}
+
+	return nil
+}
+
+// loadConfig read TOML configuration file and use its values as flags
+// defaults. Keys are the same as flag names, so values given on command line
+// still override the configuration file.
+func loadConfig(path string) error {
+	var values map[string]interface{}
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return fmt.Errorf("read config %s error: %w", path, err)
+	}
+
+	flat := make(map[string]string)
+	if err := flattenConfig("", values, flat); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var unknown []string
+	for _, key := range keys {
+		if key == "config" || flag.Lookup(key) == nil {
+			unknown = append(unknown, key)
+			continue
+		}
+
+		if err := flag.Set(key, flat[key]); err != nil {
+			return fmt.Errorf("config %s: invalid value for %q: %w", path, key, err)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("config %s: unknown keys: %s", path, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
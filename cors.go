@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	corsMethods = "GET, HEAD, POST, PUT, DELETE, OPTIONS, PROPFIND, PROPPATCH, MKCOL, COPY, MOVE, LOCK, UNLOCK"
+	corsHeaders = "Authorization, Content-Type, Depth, Destination, If, Overwrite, X-TOTP-Code, X-Requested-With"
+	corsMaxAge  = "600"
+)
+
+var (
+	corsSpec        string
+	corsCredentials bool
+
+	corsOrigins map[string]bool
+	corsAny     bool
+)
+
+// parseCORSOrigins parse -cors.origins; "*" allow any origin, but can not be
+// combined with -cors.credentials.
+func parseCORSOrigins(spec string, credentials bool) error {
+	corsOrigins = make(map[string]bool)
+	for _, o := range strings.Split(spec, ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		switch o {
+		case "":
+		case "*":
+			corsAny = true
+		default:
+			corsOrigins[o] = true
+		}
+	}
+
+	if corsAny && credentials {
+		return errors.New("-cors.origins * can not be used with -cors.credentials")
+	}
+
+	return nil
+}
+
+func corsAllowed(origin string) bool {
+	return corsAny || corsOrigins[origin]
+}
+
+// withCORS add CORS headers for allowed origins and answer preflight
+// requests without authentication.
+func withCORS(next http.Handler) http.Handler {
+	if !corsAny && len(corsOrigins) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !corsAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if corsAny {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+		}
+		if corsCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsMethods)
+			h.Set("Access-Control-Allow-Headers", corsHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Expose-Headers", "ETag, Link, X-Request-ID, X-Widdler-Warning")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// recentWindow is number of seconds counted as recent requests.
+const recentWindow = 60
+
+var (
+	debugToken string
+	// debugPprof enable net/http/pprof handlers under /debug/pprof/.
+	debugPprof bool
+
+	// proxyHeaders are headers added by reverse proxies; such requests
+	// need -debug.token even when coming from loopback.
+	proxyHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+	// debugMethods are methods counted separately; others are counted as
+	// "OTHER".
+	debugMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodDelete, http.MethodOptions, "PROPFIND", "PROPPATCH",
+		"MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "OTHER",
+	}
+	methodCounters = newMethodCounters()
+	davLocks       = &lockCounter{locks: make(map[lockKey]time.Time)}
+)
+
+// methodCounter count all requests and requests in every of the last
+// recentWindow seconds.
+type methodCounter struct {
+	total   atomic.Uint64
+	buckets [recentWindow]atomic.Uint64
+	seconds [recentWindow]atomic.Int64
+}
+
+func (c *methodCounter) inc(now time.Time) {
+	c.total.Add(1)
+
+	sec := now.Unix()
+	i := sec % recentWindow
+	if old := c.seconds[i].Load(); old != sec && c.seconds[i].CompareAndSwap(old, sec) {
+		c.buckets[i].Store(0)
+	}
+	c.buckets[i].Add(1)
+}
+
+func (c *methodCounter) recent(now time.Time) uint64 {
+	sec := now.Unix()
+
+	var sum uint64
+	for i := range c.buckets {
+		if sec-c.seconds[i].Load() < recentWindow {
+			sum += c.buckets[i].Load()
+		}
+	}
+
+	return sum
+}
+
+func newMethodCounters() map[string]*methodCounter {
+	counters := make(map[string]*methodCounter, len(debugMethods))
+	for _, m := range debugMethods {
+		counters[m] = &methodCounter{}
+	}
+	return counters
+}
+
+// knownMethod return method when it is one of debugMethods and "OTHER"
+// otherwise, so clients can not create any number of counters.
+func knownMethod(method string) string {
+	if _, ok := methodCounters[method]; ok {
+		return method
+	}
+	return "OTHER"
+}
+
+func countRequest(method string) {
+	methodCounters[knownMethod(method)].inc(time.Now())
+}
+
+type lockKey struct {
+	ls    *countedLS
+	token string
+}
+
+// lockCounter track expiry of WebDAV locks of all handlers.
+type lockCounter struct {
+	mu    sync.Mutex
+	locks map[lockKey]time.Time
+}
+
+func (l *lockCounter) set(key lockKey, now time.Time, d time.Duration) {
+	var expires time.Time
+	if d >= 0 {
+		expires = now.Add(d)
+	}
+
+	l.mu.Lock()
+	l.locks[key] = expires
+	l.mu.Unlock()
+}
+
+func (l *lockCounter) remove(key lockKey) {
+	l.mu.Lock()
+	delete(l.locks, key)
+	l.mu.Unlock()
+}
+
+// active return number of not expired locks.
+func (l *lockCounter) active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, expires := range l.locks {
+		if !expires.IsZero() && !now.Before(expires) {
+			delete(l.locks, key)
+		}
+	}
+
+	return len(l.locks)
+}
+
+// countedLS is webdav.LockSystem reporting its locks to davLocks.
+type countedLS struct {
+	webdav.LockSystem
+}
+
+func (c *countedLS) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	token, err := c.LockSystem.Create(now, details)
+	if err == nil {
+		davLocks.set(lockKey{c, token}, now, details.Duration)
+	}
+	return token, err
+}
+
+func (c *countedLS) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	details, err := c.LockSystem.Refresh(now, token, duration)
+	if err == nil {
+		davLocks.set(lockKey{c, token}, now, duration)
+	}
+	return details, err
+}
+
+func (c *countedLS) Unlock(now time.Time, token string) error {
+	err := c.LockSystem.Unlock(now, token)
+	davLocks.remove(lockKey{c, token})
+	return err
+}
+
+type debugMethodStats struct {
+	Total  uint64 `json:"total"`
+	Recent uint64 `json:"last_60s"`
+}
+
+type debugMemStats struct {
+	Alloc        uint64 `json:"alloc_bytes"`
+	TotalAlloc   uint64 `json:"total_alloc_bytes"`
+	Sys          uint64 `json:"sys_bytes"`
+	HeapInuse    uint64 `json:"heap_inuse_bytes"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"gc_pause_total_ns"`
+}
+
+type debugStats struct {
+	Requests   map[string]debugMethodStats `json:"requests"`
+	Goroutines int                         `json:"goroutines"`
+	Memory     debugMemStats               `json:"memory"`
+	Locks      int                         `json:"dav_locks"`
+}
+
+// debugAllowed check if request has -debug.token or comes directly from
+// loopback. Requests forwarded by proxy always need the token.
+func debugAllowed(r *http.Request) bool {
+	if debugToken != "" {
+		token := r.Header.Get("X-Debug-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(debugToken)) == 1 {
+			return true
+		}
+	}
+
+	for _, h := range proxyHeaders {
+		if r.Header.Get(h) != "" {
+			return false
+		}
+	}
+
+	ip := net.ParseIP(clientIP(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// withDebugAccess allow only requests passing debugAllowed.
+func withDebugAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !debugAllowed(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// debugStatsHandler handle GET /debug/stats: request counters and runtime
+// statistics; ?pprof=true list pprof profiles instead.
+func debugStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if r.URL.Query().Get("pprof") == "true" {
+		if !debugPprof {
+			jsonError(w, http.StatusNotFound, "pprof is disabled, start widdler with -debug.pprof")
+			return
+		}
+		writePprofIndex(w)
+		return
+	}
+
+	now := time.Now()
+	stats := debugStats{
+		Requests:   make(map[string]debugMethodStats, len(methodCounters)),
+		Goroutines: runtime.NumGoroutine(),
+		Locks:      davLocks.active(),
+	}
+	for m, c := range methodCounters {
+		stats.Requests[m] = debugMethodStats{Total: c.total.Load(), Recent: c.recent(now)}
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats.Memory = debugMemStats{
+		Alloc:        ms.Alloc,
+		TotalAlloc:   ms.TotalAlloc,
+		Sys:          ms.Sys,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		NumGC:        ms.NumGC,
+		PauseTotalNs: ms.PauseTotalNs,
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// writePprofIndex write links to pprof profiles as plain text.
+func writePprofIndex(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	base := prefixed("/debug/pprof/")
+	for _, p := range runtimepprof.Profiles() {
+		fmt.Fprintf(w, "%-14s %6d  %s%s?debug=1\n", p.Name(), p.Count(), base, p.Name())
+	}
+	fmt.Fprintf(w, "%-14s %6s  %sprofile?seconds=30\n", "profile", "", base)
+	fmt.Fprintf(w, "%-14s %6s  %strace?seconds=5\n", "trace", "", base)
+	fmt.Fprintf(w, "%-14s %6s  %ssymbol\n", "symbol", "", base)
+}
+
+// registerDebug add /debug/stats and, with -debug.pprof, pprof handlers to
+// mux. pprof cmdline is never served, as command line contains secrets.
+func registerDebug(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/stats", withDebugAccess(debugStatsHandler))
+	if !debugPprof {
+		return
+	}
+
+	mux.HandleFunc("/debug/pprof/", withDebugAccess(pprofIndex))
+	mux.HandleFunc("/debug/pprof/profile", withDebugAccess(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", withDebugAccess(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", withDebugAccess(pprof.Trace))
+}
+
+// pprofIndex serve pprof index and profiles, except cmdline.
+func pprofIndex(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimPrefix(r.URL.Path, "/debug/pprof/") == "cmdline" {
+		http.NotFound(w, r)
+		return
+	}
+	pprof.Index(w, r)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugAccess(t *testing.T) {
+	defer func(tok string, p bool) { debugToken, debugPprof = tok, p }(debugToken, debugPprof)
+	debugToken = "secret"
+
+	tests := []struct {
+		pprof  bool
+		path   string
+		remote string
+		header string
+		token  string
+		want   int
+	}{
+		{false, "/debug/stats", "127.0.0.1:1000", "", "", http.StatusOK},
+		{false, "/debug/stats", "192.0.2.1:1000", "", "", http.StatusForbidden},
+		{false, "/debug/stats", "192.0.2.1:1000", "", "secret", http.StatusOK},
+		{false, "/debug/stats", "192.0.2.1:1000", "", "bad", http.StatusForbidden},
+		// proxied requests need token
+		{false, "/debug/stats", "127.0.0.1:1000", "X-Forwarded-For", "", http.StatusForbidden},
+		{false, "/debug/stats", "127.0.0.1:1000", "X-Real-IP", "", http.StatusForbidden},
+		{false, "/debug/stats", "127.0.0.1:1000", "Forwarded", "", http.StatusForbidden},
+		{false, "/debug/stats", "127.0.0.1:1000", "X-Forwarded-For", "secret", http.StatusOK},
+		// pprof only with -debug.pprof
+		{false, "/debug/stats?pprof=true", "127.0.0.1:1000", "", "", http.StatusNotFound},
+		{false, "/debug/pprof/", "127.0.0.1:1000", "", "", http.StatusNotFound},
+		{true, "/debug/stats?pprof=true", "127.0.0.1:1000", "", "", http.StatusOK},
+		{true, "/debug/pprof/", "127.0.0.1:1000", "", "", http.StatusOK},
+		{true, "/debug/pprof/heap", "127.0.0.1:1000", "", "", http.StatusOK},
+		{true, "/debug/pprof/", "192.0.2.1:1000", "", "", http.StatusForbidden},
+		{true, "/debug/pprof/cmdline", "127.0.0.1:1000", "", "", http.StatusNotFound},
+		{true, "/debug/pprof/cmdline", "192.0.2.1:1000", "", "secret", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		debugPprof = tt.pprof
+		mux := http.NewServeMux()
+		registerDebug(mux)
+
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.RemoteAddr = tt.remote
+		if tt.header != "" {
+			r.Header.Set(tt.header, "192.0.2.7")
+		}
+		if tt.token != "" {
+			r.Header.Set("X-Debug-Token", tt.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+
+		if rec.Code != tt.want {
+			t.Errorf("pprof %v, %s from %s, header %q, token %q: status %d, want %d",
+				tt.pprof, tt.path, tt.remote, tt.header, tt.token, rec.Code, tt.want)
+		}
+		if strings.Contains(rec.Body.String(), "cmdline") && strings.Contains(tt.path, "pprof=true") {
+			t.Errorf("pprof index lists cmdline: %s", rec.Body)
+		}
+	}
+}
+
+func TestKnownMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{http.MethodGet, http.MethodGet},
+		{"PROPFIND", "PROPFIND"},
+		{"propfind", "OTHER"},
+		{"X-RANDOM-1234", "OTHER"},
+		{"", "OTHER"},
+	}
+
+	for _, tt := range tests {
+		if got := knownMethod(tt.method); got != tt.want {
+			t.Errorf("knownMethod(%q) = %q, want %q", tt.method, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	journalPath string
+	journalMu   sync.Mutex
+)
+
+// journal append entry to deletion journal.
+func journal(format string, args ...interface{}) {
+	if journalPath == "" {
+		return
+	}
+
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	f, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Printf("open journal %s error: %v\n", journalPath, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...)); err != nil {
+		log.Printf("write journal %s error: %v\n", journalPath, err)
+	}
+}
+
+// deleteWiki remove wiki and, unless keep-backups=true is given, all its
+// backups. Caller must hold handler lock.
+func deleteWiki(w http.ResponseWriter, r *http.Request, req *apiRequest, fullPath, backupPath string) {
+	if err := os.Remove(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	keep := r.URL.Query().Get("keep-backups") == "true"
+	cleanupDeleted(req.handler, fullPath, backupPath, keep)
+
+	log.Printf("%s deleted %s (keep backups: %v)\n", req.user, fullPath, keep)
+	journal("delete user=%q wiki=%q keep_backups=%v remote=%s", req.user, fullPath, keep, clientIP(r))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cleanupDeleted remove cached data and, unless keep is set, backups of
+// deleted wiki. h may be nil when owner has no handler loaded. Caller must
+// hold h.mu.
+func cleanupDeleted(h *userHandler, fullPath, backupPath string, keep bool) {
+	removeGzipFile(fullPath)
+	forgetBackupAge(fullPath)
+	if h != nil {
+		h.invalidateUsage()
+		if h.cache != nil {
+			h.cache.invalidate(fullPath)
+		}
+	}
+
+	if !keep {
+		if err := removeBackups(backupPath); err != nil {
+			log.Printf("remove backups of %s error: %v\n", fullPath, err)
+		}
+	}
+}
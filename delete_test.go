@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeleteWiki(t *testing.T) {
+	defer func(p string) { journalPath = p }(journalPath)
+
+	tests := []struct {
+		query      string
+		keepBackup bool
+	}{
+		{"", false},
+		{"?keep-backups=true", true},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		journalPath = filepath.Join(dir, "journal")
+
+		fullPath := filepath.Join(dir, "a.html")
+		backupPath := filepath.Join(dir, "backups", "a.html")
+		backups := []string{
+			filepath.Join(dir, "backups", "a-20240101_100000.html"),
+			filepath.Join(dir, "backups", "a-20240102_100000.html.gz"),
+			// backup of other wiki
+			filepath.Join(dir, "backups", "b-20240101_100000.html"),
+		}
+		if err := os.MkdirAll(filepath.Dir(backupPath), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range append(backups, fullPath) {
+			if err := os.WriteFile(f, []byte("x"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := httptest.NewRequest(http.MethodDelete, "/a.html"+tt.query, nil)
+		rec := httptest.NewRecorder()
+		deleteWiki(rec, r, &apiRequest{user: "alice", handler: &userHandler{}}, fullPath, backupPath)
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("DELETE%s: status %d, want %d", tt.query, rec.Code, http.StatusNoContent)
+		}
+		if _, err := os.Stat(fullPath); !os.IsNotExist(err) {
+			t.Errorf("DELETE%s: wiki not removed", tt.query)
+		}
+		for i, f := range backups {
+			_, err := os.Stat(f)
+			want := tt.keepBackup || i == 2
+			if kept := err == nil; kept != want {
+				t.Errorf("DELETE%s: %s kept %v, want %v", tt.query, filepath.Base(f), kept, want)
+			}
+		}
+
+		data, err := os.ReadFile(journalPath)
+		if err != nil || !strings.Contains(string(data), `delete user="alice"`) {
+			t.Errorf("DELETE%s: journal %q, error %v", tt.query, data, err)
+		}
+	}
+}
+
+func TestDeleteMissingWiki(t *testing.T) {
+	dir := t.TempDir()
+	r := httptest.NewRequest(http.MethodDelete, "/a.html", nil)
+	rec := httptest.NewRecorder()
+	deleteWiki(rec, r, &apiRequest{user: "alice", handler: &userHandler{}},
+		filepath.Join(dir, "a.html"), filepath.Join(dir, "backups", "a.html"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Delta backups store binary patch against previous backup instead of full
+// copy of the wiki. Patch is computed using rsync-like algorithm: blocks of
+// the old file are indexed by weak rolling checksum (confirmed by SHA-256),
+// new file is scanned byte by byte and matching blocks are encoded as copy
+// operations, everything else as literals.
+//
+// Delta file is gzip compressed and contains:
+//
+//	"WDELTA1\n" <base backup name> "\n" <ops>
+//
+// where ops are 'C' offset length (copy from base), 'L' length bytes
+// (literal) and final 'E' length sha256 (size and hash of result).
+// Numbers are uvarint encoded.
+
+const (
+	deltaMagic     = "WDELTA1\n"
+	deltaBlockSize = 2048
+	deltaExt       = ".delta"
+	maxDeltaChain  = 10
+)
+
+var errDeltaCorrupted = errors.New("delta corrupted")
+
+func weakHash(p []byte) (uint32, uint32) {
+	var a, b uint32
+	for i, c := range p {
+		a += uint32(c)
+		b += uint32(len(p)-i) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+type deltaWriter struct {
+	buf     bytes.Buffer
+	copyOff int
+	copyLen int
+}
+
+func (d *deltaWriter) uvarint(v int) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(v))
+	d.buf.Write(tmp[:n])
+}
+
+func (d *deltaWriter) flushCopy() {
+	if d.copyLen == 0 {
+		return
+	}
+	d.buf.WriteByte('C')
+	d.uvarint(d.copyOff)
+	d.uvarint(d.copyLen)
+	d.copyLen = 0
+}
+
+func (d *deltaWriter) copy(off, length int) {
+	if d.copyLen > 0 && d.copyOff+d.copyLen == off {
+		d.copyLen += length
+		return
+	}
+	d.flushCopy()
+	d.copyOff, d.copyLen = off, length
+}
+
+func (d *deltaWriter) literal(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	d.flushCopy()
+	d.buf.WriteByte('L')
+	d.uvarint(len(p))
+	d.buf.Write(p)
+}
+
+// createDelta compute patch transforming old into data.
+func createDelta(old, data []byte) []byte {
+	const bs = deltaBlockSize
+
+	index := make(map[uint32][]int)
+	strong := make([][sha256.Size]byte, len(old)/bs)
+	for i := range strong {
+		block := old[i*bs : (i+1)*bs]
+		a, b := weakHash(block)
+		index[a|b<<16] = append(index[a|b<<16], i)
+		strong[i] = sha256.Sum256(block)
+	}
+
+	d := &deltaWriter{}
+	litStart := 0
+	i := 0
+
+	var a, b uint32
+	if len(data) >= bs {
+		a, b = weakHash(data[:bs])
+	}
+
+	for i+bs <= len(data) {
+		if cands, ok := index[a|b<<16]; ok {
+			sum := sha256.Sum256(data[i : i+bs])
+			matched := -1
+			for _, c := range cands {
+				if strong[c] == sum {
+					matched = c
+					break
+				}
+			}
+
+			if matched >= 0 {
+				d.literal(data[litStart:i])
+				d.copy(matched*bs, bs)
+				i += bs
+				litStart = i
+				if i+bs <= len(data) {
+					a, b = weakHash(data[i : i+bs])
+				}
+				continue
+			}
+		}
+
+		if i+bs < len(data) {
+			out, in := uint32(data[i]), uint32(data[i+bs])
+			a = (a - out + in) & 0xffff
+			b = (b - bs*out + a) & 0xffff
+		}
+		i++
+	}
+
+	d.literal(data[litStart:])
+	d.flushCopy()
+
+	sum := sha256.Sum256(data)
+	d.buf.WriteByte('E')
+	d.uvarint(len(data))
+	d.buf.Write(sum[:])
+
+	return d.buf.Bytes()
+}
+
+// applyDelta reconstruct file from base and patch created by createDelta.
+func applyDelta(base []byte, delta io.Reader) ([]byte, error) {
+	r := bufio.NewReader(delta)
+
+	var out bytes.Buffer
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, errDeltaCorrupted
+		}
+
+		switch op {
+		case 'C':
+			off, err1 := binary.ReadUvarint(r)
+			length, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || off+length > uint64(len(base)) {
+				return nil, errDeltaCorrupted
+			}
+			out.Write(base[off : off+length])
+		case 'L':
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errDeltaCorrupted
+			}
+			if _, err := io.CopyN(&out, r, int64(length)); err != nil {
+				return nil, errDeltaCorrupted
+			}
+		case 'E':
+			length, err := binary.ReadUvarint(r)
+			if err != nil || length != uint64(out.Len()) {
+				return nil, errDeltaCorrupted
+			}
+
+			var sum [sha256.Size]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				return nil, errDeltaCorrupted
+			}
+
+			if sha256.Sum256(out.Bytes()) != sum {
+				return nil, fmt.Errorf("delta checksum mismatch: %w", errDeltaCorrupted)
+			}
+
+			return out.Bytes(), nil
+		default:
+			return nil, errDeltaCorrupted
+		}
+	}
+}
+
+// writeDeltaFile store compressed patch of given kind (magic) against
+// baseName into dst.
+func writeDeltaFile(dst, magic, baseName string, delta []byte) error {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create delta file %s error: %w", dst, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(gz, "%s%s\n", magic, baseName); err != nil {
+		return err
+	}
+
+	if _, err := gz.Write(delta); err != nil {
+		return fmt.Errorf("write delta file %s error: %w", dst, err)
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// openDeltaFile open patch file and return name of its base backup, kind of
+// patch (deltaMagic or tiddlerMagic) and reader positioned on operations.
+func openDeltaFile(fname string) (string, string, io.ReadCloser, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return "", "", nil, err
+	}
+
+	r := bufio.NewReader(gz)
+
+	magic := make([]byte, len(deltaMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || (string(magic) != deltaMagic && string(magic) != tiddlerMagic) {
+		f.Close()
+		return "", "", nil, errDeltaCorrupted
+	}
+
+	base, err := r.ReadString('\n')
+	if err != nil {
+		f.Close()
+		return "", "", nil, errDeltaCorrupted
+	}
+
+	return strings.TrimSuffix(base, "\n"), string(magic), struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
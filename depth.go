@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// davMaxDepth is maximum Depth of PROPFIND requests (0 or 1); -1 allows
+// "infinity".
+var davMaxDepth = 1
+
+// depthWriter buffer multistatus response to add description of applied
+// depth limit.
+type depthWriter struct {
+	http.ResponseWriter
+	code int
+	buf  bytes.Buffer
+}
+
+func (d *depthWriter) WriteHeader(code int) {
+	if d.code == 0 {
+		d.code = code
+	}
+}
+
+func (d *depthWriter) Write(p []byte) (int, error) {
+	if d.code == 0 {
+		d.code = http.StatusOK
+	}
+	return d.buf.Write(p)
+}
+
+func (d *depthWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// finish send buffered response; description is added as the last element
+// of multistatus.
+func (d *depthWriter) finish(depth int) {
+	if d.code == 0 {
+		d.code = http.StatusOK
+	}
+
+	body := d.buf.Bytes()
+	end := []byte("</D:multistatus>")
+	if idx := bytes.LastIndex(body, end); d.code == http.StatusMultiStatus && idx >= 0 {
+		desc := fmt.Sprintf("<D:responsedescription>Depth limited to %d</D:responsedescription>", depth)
+		body = append(body[:idx:idx], append([]byte(desc), body[idx:]...)...)
+	}
+
+	d.ResponseWriter.WriteHeader(d.code)
+	_, _ = d.ResponseWriter.Write(body)
+}
+
+// limitDepth cap Depth header of PROPFIND requests to -dav.max-depth, so
+// clients can not list whole tree of directories in one request. Missing
+// Depth header means "infinity".
+func limitDepth(next http.Handler) http.Handler {
+	if davMaxDepth < 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch depth := r.Header.Get("Depth"); {
+		case depth == "0", depth == "1" && davMaxDepth >= 1:
+			next.ServeHTTP(w, r)
+			return
+		case depth != "1" && depth != "infinity" && depth != "":
+			// invalid value is rejected by WebDAV handler
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Header.Set("Depth", strconv.Itoa(davMaxDepth))
+
+		dw := &depthWriter{ResponseWriter: w}
+		next.ServeHTTP(dw, r)
+		dw.finish(davMaxDepth)
+	})
+}
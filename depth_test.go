@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitDepth(t *testing.T) {
+	defer func(d int) { davMaxDepth = d }(davMaxDepth)
+
+	const multistatus = `<?xml version="1.0" encoding="UTF-8"?><D:multistatus xmlns:D="DAV:"></D:multistatus>`
+
+	tests := []struct {
+		maxDepth int
+		method   string
+		depth    string
+		want     string
+		limited  bool
+	}{
+		{1, "PROPFIND", "infinity", "1", true},
+		{1, "PROPFIND", "", "1", true},
+		{1, "PROPFIND", "1", "1", false},
+		{1, "PROPFIND", "0", "0", false},
+		{0, "PROPFIND", "1", "0", true},
+		{0, "PROPFIND", "infinity", "0", true},
+		{-1, "PROPFIND", "infinity", "infinity", false},
+		// invalid depth is left for WebDAV handler
+		{1, "PROPFIND", "2", "2", false},
+		{1, "COPY", "infinity", "infinity", false},
+	}
+
+	for _, tt := range tests {
+		davMaxDepth = tt.maxDepth
+
+		var got string
+		h := limitDepth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Depth")
+			w.WriteHeader(http.StatusMultiStatus)
+			_, _ = w.Write([]byte(multistatus))
+		}))
+
+		r := httptest.NewRequest(tt.method, "/", nil)
+		if tt.depth != "" {
+			r.Header.Set("Depth", tt.depth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if got != tt.want {
+			t.Errorf("max %d, %s Depth %q: forwarded Depth %q, want %q", tt.maxDepth, tt.method, tt.depth, got, tt.want)
+		}
+		if rec.Code != http.StatusMultiStatus {
+			t.Errorf("max %d, %s Depth %q: status %d", tt.maxDepth, tt.method, tt.depth, rec.Code)
+		}
+		limited := strings.Contains(rec.Body.String(), "<D:responsedescription>Depth limited to "+tt.want+"</D:responsedescription></D:multistatus>")
+		if limited != tt.limited {
+			t.Errorf("max %d, %s Depth %q: description %v, want %v: %s", tt.maxDepth, tt.method, tt.depth, limited, tt.limited, rec.Body)
+		}
+	}
+}
+
+func TestLimitDepthWikiHandler(t *testing.T) {
+	defer func(d int) { davMaxDepth = d }(davMaxDepth)
+	davMaxDepth = 1
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "a.html", "sub/b.html", "sub/deep/c.html")
+	v := &vhost{davDir: dir}
+	addHandler(&v.handlers, "", dir)
+	h := wikiHandler(v)
+
+	tests := []struct {
+		path    string
+		depth   string
+		listed  []string
+		hidden  []string
+		limited bool
+	}{
+		{"/", "infinity", []string{"/a.html", "/sub/"}, []string{"/sub/b.html"}, true},
+		{"/sub/", "infinity", []string{"/sub/b.html", "/sub/deep/"}, []string{"/sub/deep/c.html"}, true},
+		{"/sub/", "", []string{"/sub/b.html"}, []string{"/sub/deep/c.html"}, true},
+		{"/sub/", "0", []string{"/sub/"}, []string{"/sub/b.html"}, false},
+		{"/a.html", "infinity", []string{"/a.html"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("PROPFIND", tt.path, nil)
+		if tt.depth != "" {
+			r.Header.Set("Depth", tt.depth)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, r)
+
+		body := rec.Body.String()
+		if rec.Code != http.StatusMultiStatus {
+			t.Errorf("PROPFIND %s Depth %q: status %d, want %d", tt.path, tt.depth, rec.Code, http.StatusMultiStatus)
+			continue
+		}
+		for _, p := range tt.listed {
+			if !strings.Contains(body, "<D:href>"+p+"</D:href>") {
+				t.Errorf("PROPFIND %s Depth %q: %s not listed", tt.path, tt.depth, p)
+			}
+		}
+		for _, p := range tt.hidden {
+			if strings.Contains(body, "<D:href>"+p+"</D:href>") {
+				t.Errorf("PROPFIND %s Depth %q: %s listed", tt.path, tt.depth, p)
+			}
+		}
+		if got := strings.Contains(body, "Depth limited to 1"); got != tt.limited {
+			t.Errorf("PROPFIND %s Depth %q: description %v, want %v", tt.path, tt.depth, got, tt.limited)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// isCopyMove check if method of r has Destination header.
+func isCopyMove(r *http.Request) bool {
+	return r.Method == "MOVE" || r.Method == "COPY"
+}
+
+// davDestination return cleaned path of Destination header of MOVE or COPY
+// request, relative to directory of handler serving r. Only plain wikis
+// (.html) are accepted as destination; on error status code is returned.
+func davDestination(r *http.Request, shared bool) (string, int) {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || u.Path == "" {
+		return "", http.StatusBadRequest
+	}
+	if u.Host != "" && u.Host != r.Host {
+		return "", http.StatusBadGateway
+	}
+
+	// like request paths, Destination may come without -prefix when it was
+	// already stripped by proxy
+	p := u.Path
+	if urlPrefix != "" {
+		if rest, ok := strings.CutPrefix(p, urlPrefix+"/"); ok {
+			p = "/" + rest
+		}
+	}
+	if shared {
+		rest, ok := strings.CutPrefix(p, "/"+sharedPrefix)
+		if !ok {
+			// wikis can not be moved between shared and own directory
+			return "", http.StatusForbidden
+		}
+		p = "/" + rest
+	}
+
+	// files kept next to wikis (.htpasswd, .readonly, .widdler, .store.json,
+	// .quota...) never end with .html
+	if strings.Contains(p, "..") || strings.Contains(p, ".htpasswd") || strings.Contains(p, ".journal") ||
+		!strings.HasSuffix(p, ".html") {
+		return "", http.StatusForbidden
+	}
+
+	return path.Clean(p), 0
+}
+
+// withDestination return copy of r with Destination header set to p.
+func withDestination(r *http.Request, p string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.Header.Set("Destination", (&url.URL{Path: p}).String())
+	return r2
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDavDestination(t *testing.T) {
+	tests := []struct {
+		dest     string
+		shared   bool
+		wantPath string
+		wantCode int
+	}{
+		{"/b.html", false, "/b.html", 0},
+		{"http://example.com/dir/b.html", false, "/dir/b.html", 0},
+		{"/a//b.html", false, "/a/b.html", 0},
+		{"/shared/b.html", true, "/b.html", 0},
+		{"/b.html", true, "", http.StatusForbidden},
+		{"http://other.com/b.html", false, "", http.StatusBadGateway},
+		{"", false, "", http.StatusBadRequest},
+		{"/b.html.htpasswd", false, "", http.StatusForbidden},
+		{"/b.html.readonly", false, "", http.StatusForbidden},
+		{"/b.html.widdler", false, "", http.StatusForbidden},
+		{"/b.html.store.json", false, "", http.StatusForbidden},
+		{"/.quota", false, "", http.StatusForbidden},
+		{"/b.htpasswd.html", false, "", http.StatusForbidden},
+		{"/x/../../b.html", false, "", http.StatusForbidden},
+		{"/b.txt", false, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("MOVE", "http://example.com/a.html", nil)
+		r.Header.Set("Destination", tt.dest)
+
+		p, code := davDestination(r, tt.shared)
+		if p != tt.wantPath || code != tt.wantCode {
+			t.Errorf("davDestination(%q, %v) = %q, %d, want %q, %d", tt.dest, tt.shared, p, code, tt.wantPath, tt.wantCode)
+		}
+	}
+}
+
+func TestDavDestinationPrefix(t *testing.T) {
+	defer func(p string) { urlPrefix = p }(urlPrefix)
+	urlPrefix = "/wikis"
+
+	tests := []struct {
+		dest     string
+		shared   bool
+		wantPath string
+	}{
+		{"/wikis/b.html", false, "/b.html"},
+		{"http://example.com/wikis/dir/b.html", false, "/dir/b.html"},
+		{"/b.html", false, "/b.html"},
+		{"/wikis/shared/b.html", true, "/b.html"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("COPY", "http://example.com/a.html", nil)
+		r.Header.Set("Destination", tt.dest)
+
+		p, code := davDestination(r, tt.shared)
+		if p != tt.wantPath || code != 0 {
+			t.Errorf("davDestination(%q, %v) = %q, %d, want %q, 0", tt.dest, tt.shared, p, code, tt.wantPath)
+		}
+	}
+}
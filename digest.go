@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP Digest authentication (RFC 7616). Users are read from the -htpass
+// file in htdigest format:
+//
+//	user:widdler:<HA1>
+//
+// where HA1 is MD5 (or SHA-256) of "user:widdler:password", e.g. as created
+// by `htdigest .htpasswd widdler user`.
+
+const (
+	digestRealm    = "widdler"
+	digestNonceTTL = 60 * time.Second
+)
+
+// digestNonces map issued nonces to their *digestNonce.
+var digestNonces sync.Map
+
+// digestNonce keep expiry time of nonce and the last nonce count used with
+// it, so requests can not be replayed.
+type digestNonce struct {
+	expires time.Time
+
+	mu sync.Mutex
+	nc uint64
+}
+
+// use check that nc is higher than any count used before with nonce.
+func (n *digestNonce) use(nc uint64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if nc <= n.nc {
+		return false
+	}
+	n.nc = nc
+	return true
+}
+
+// digestAlgorithms are offered to clients; HA1 of user decide which of them
+// can be verified. MD5 is the first, because many clients use only the
+// first challenge.
+var digestAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"MD5", md5.New},
+	{"SHA-256", sha256.New},
+}
+
+func digestHash(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// digestChallenge send 401 response with new nonce. stale tell client that
+// only nonce expired, so it can retry without asking user.
+func digestChallenge(w http.ResponseWriter, stale bool) {
+	now := time.Now()
+	digestNonces.Range(func(k, v any) bool {
+		if now.After(v.(*digestNonce).expires) {
+			digestNonces.Delete(k)
+		}
+		return true
+	})
+
+	nonce := randomToken(16)
+	digestNonces.Store(nonce, &digestNonce{expires: now.Add(digestNonceTTL)})
+
+	for _, alg := range digestAlgorithms {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(
+			`Digest realm=%q, qop="auth", algorithm=%s, nonce=%q, stale=%t`,
+			digestRealm, alg.name, nonce, stale))
+	}
+
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// parseDigestParams parse comma-separated key=value pairs of Digest
+// Authorization header; values may be quoted.
+func parseDigestParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", \t") {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var val strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				val.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			v, next, _ := strings.Cut(rest, ",")
+			val.WriteString(strings.TrimSpace(v))
+			s = next
+		}
+
+		params[key] = val.String()
+	}
+
+	return params
+}
+
+// authenticateDigest verify Digest Authorization header of request. stale
+// is true when credentials were valid, but nonce expired.
+func (v *vhost) authenticateDigest(r *http.Request) (user string, ok, stale bool) {
+	scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return "", false, false
+	}
+
+	p := parseDigestParams(rest)
+	user = p["username"]
+	if user == "" || p["realm"] != digestRealm || p["uri"] != r.RequestURI {
+		return "", false, false
+	}
+
+	entry, exists := v.lookupUser(user)
+	if !exists {
+		return "", false, false
+	}
+
+	realm, ha1, _ := strings.Cut(entry, ":")
+	if realm != digestRealm {
+		return "", false, false
+	}
+
+	algorithm := p["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+
+	var newHash func() hash.Hash
+	for _, alg := range digestAlgorithms {
+		if strings.EqualFold(alg.name, algorithm) {
+			newHash = alg.hash
+		}
+	}
+	if newHash == nil || len(ha1) != 2*newHash().Size() {
+		return "", false, false
+	}
+
+	ha2 := digestHash(newHash, r.Method+":"+p["uri"])
+
+	var expected string
+	switch p["qop"] {
+	case "auth":
+		expected = digestHash(newHash, strings.Join([]string{ha1, p["nonce"], p["nc"], p["cnonce"], "auth", ha2}, ":"))
+	case "":
+		expected = digestHash(newHash, ha1+":"+p["nonce"]+":"+ha2)
+	default:
+		return "", false, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(p["response"]))) != 1 {
+		return "", false, false
+	}
+
+	n, issued := digestNonces.Load(p["nonce"])
+	if !issued || time.Now().After(n.(*digestNonce).expires) {
+		return "", false, true
+	}
+
+	if p["qop"] == "auth" {
+		nc, err := strconv.ParseUint(p["nc"], 16, 64)
+		if err != nil || !n.(*digestNonce).use(nc) {
+			return "", false, false
+		}
+	}
+
+	return user, true, false
+}
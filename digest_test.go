@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// digestRequest return GET request of uri authenticated with Digest auth.
+func digestRequest(user, pass, uri string) *http.Request {
+	rec := httptest.NewRecorder()
+	digestChallenge(rec, false)
+	params := parseDigestParams(strings.TrimPrefix(rec.Header().Get("WWW-Authenticate"), "Digest "))
+
+	ha1 := digestHash(md5.New, user+":"+digestRealm+":"+pass)
+	ha2 := digestHash(md5.New, "GET:"+uri)
+	response := digestHash(md5.New, strings.Join([]string{ha1, params["nonce"], "00000001", "abc", "auth", ha2}, ":"))
+
+	r := httptest.NewRequest(http.MethodGet, uri, nil)
+	r.Header.Set("Authorization", fmt.Sprintf(
+		`Digest username=%q, realm=%q, nonce=%q, uri=%q, qop=auth, nc=00000001, cnonce="abc", response=%q`,
+		user, digestRealm, params["nonce"], uri, response))
+	return r
+}
+
+func TestAuthenticateDigestNonceCount(t *testing.T) {
+	ha1 := digestHash(md5.New, "alice:"+digestRealm+":secret")
+	v := &vhost{users: map[string]string{"alice": digestRealm + ":" + ha1}}
+
+	rec := httptest.NewRecorder()
+	digestChallenge(rec, false)
+	params := parseDigestParams(strings.TrimPrefix(rec.Header().Get("WWW-Authenticate"), "Digest "))
+	nonce := params["nonce"]
+
+	tests := []struct {
+		nc   string
+		want bool
+	}{
+		{"00000001", true},
+		{"00000002", true},
+		// replayed and lower counts
+		{"00000002", false},
+		{"00000001", false},
+		{"0000000a", true},
+		{"zz", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/a.html", nil)
+		ha2 := digestHash(md5.New, "GET:/a.html")
+		response := digestHash(md5.New, strings.Join([]string{ha1, nonce, tt.nc, "abc", "auth", ha2}, ":"))
+		r.Header.Set("Authorization", fmt.Sprintf(
+			`Digest username="alice", realm=%q, nonce=%q, uri="/a.html", qop=auth, nc=%s, cnonce="abc", response=%q`,
+			digestRealm, nonce, tt.nc, response))
+
+		user, ok, _ := v.authenticateDigest(r)
+		if ok != tt.want || ok && user != "alice" {
+			t.Errorf("nc %s: authenticateDigest = %q, %v, want %v", tt.nc, user, ok, tt.want)
+		}
+	}
+}
+
+func TestDigestWikiPassword(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "alice/a.html", "alice/b.html", "bob/a.html")
+	htpasswd := "alice:" + testHash(t, "other") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "alice", "a.html"+wikiPassExt), []byte(htpasswd), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bob", "a.html"+wikiPassExt), []byte("carol:"+testHash(t, "x")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vhost{auth: "digest", davDir: dir, users: map[string]string{
+		"alice": digestRealm + ":" + digestHash(md5.New, "alice:"+digestRealm+":secret"),
+		"bob":   digestRealm + ":" + digestHash(md5.New, "bob:"+digestRealm+":secret"),
+	}}
+	addHandler(&v.handlers, "alice", filepath.Join(dir, "alice"))
+	addHandler(&v.handlers, "bob", filepath.Join(dir, "bob"))
+	h := wikiHandler(v)
+
+	tests := []struct {
+		user string
+		uri  string
+		want int
+	}{
+		// listed in per-wiki file
+		{"alice", "/a.html", http.StatusOK},
+		// no per-wiki file
+		{"alice", "/b.html", http.StatusOK},
+		// not listed
+		{"bob", "/a.html", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, digestRequest(tt.user, "secret", tt.uri))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.user, tt.uri, rec.Code, tt.want)
+		}
+	}
+}
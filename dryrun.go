@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var dryRun bool
+
+// dryRunCheck is single check of configuration; fn return short summary of
+// what was found.
+type dryRunCheck struct {
+	name string
+	fn   func() (string, error)
+}
+
+// checkWritableDir verify that dir exists and files can be created in it.
+func checkWritableDir(dir string) (string, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".widdler-dry-run-*")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return dir + " is writable", nil
+}
+
+// checkCreatableDir verify that dir exists or can be created.
+func checkCreatableDir(dir string) (string, error) {
+	parent := filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(parent); err == nil {
+			break
+		}
+		next := filepath.Dir(parent)
+		if next == parent {
+			return "", fmt.Errorf("no existing parent of %s", dir)
+		}
+		parent = next
+	}
+
+	if _, err := checkWritableDir(parent); err != nil {
+		return "", err
+	}
+
+	if parent != filepath.Clean(dir) {
+		return dir + " will be created", nil
+	}
+
+	return dir + " is writable", nil
+}
+
+func checkPasswordFile() (string, error) {
+	users, err := loadHTPasswd(htpassPaths(passPath))
+	if err != nil {
+		return "", err
+	}
+
+	if len(users) == 0 && (auth == "basic" || auth == "header" || auth == "digest") {
+		return "", fmt.Errorf("no users in %s, required by -auth %s", passPath, auth)
+	}
+
+	return fmt.Sprintf("%d users in %s", len(users), passPath), nil
+}
+
+func checkCertificate() (string, error) {
+	pair, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+	if err != nil {
+		return "", err
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	switch {
+	case now.After(cert.NotAfter):
+		return "", fmt.Errorf("certificate %s expired on %s", tlsCert, cert.NotAfter.Format(time.DateOnly))
+	case now.Before(cert.NotBefore):
+		return "", fmt.Errorf("certificate %s is valid from %s", tlsCert, cert.NotBefore.Format(time.DateOnly))
+	}
+
+	return fmt.Sprintf("%s valid until %s", cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly)), nil
+}
+
+// dryRunChecks return checks for current configuration.
+func dryRunChecks() []dryRunCheck {
+	checks := []dryRunCheck{
+		{"wikis directory", func() (string, error) { return checkWritableDir(davDir) }},
+	}
+
+	if auth != "none" || passPath != "" {
+		checks = append(checks, dryRunCheck{"password file", checkPasswordFile})
+	}
+
+	if tlsCert != "" || tlsKey != "" {
+		checks = append(checks, dryRunCheck{"TLS certificate", checkCertificate})
+	}
+
+	if tlsCA != "" {
+		checks = append(checks, dryRunCheck{"TLS client CA", func() (string, error) {
+			_, err := loadClientCAs(tlsCA)
+			return tlsCA, err
+		}})
+	}
+
+	if backupsEnabled {
+		dir := backupDir
+		if !filepath.IsAbs(dir) {
+			// relative backup directories are created in user directories
+			dir = filepath.Join(davDir, dir)
+		}
+		checks = append(checks, dryRunCheck{"backup directory", func() (string, error) {
+			return checkCreatableDir(dir)
+		}})
+	}
+
+	names := make([]string, 0, len(vhosts))
+	for name := range vhosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := vhosts[name]
+		checks = append(checks, dryRunCheck{"vhost " + name, func() (string, error) {
+			return checkWritableDir(v.davDir)
+		}})
+	}
+
+	return checks
+}
+
+// runDryRun print result of every check to out and return exit code: 0
+// when all checks passed.
+func runDryRun(out io.Writer) int {
+	failed := 0
+	checks := dryRunChecks()
+
+	for _, c := range checks {
+		msg, err := c.fn()
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL  %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(out, "ok    %s: %s\n", c.name, msg)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "%d of %d checks failed\n", failed, len(checks))
+		return 1
+	}
+
+	fmt.Fprintf(out, "all %d checks passed\n", len(checks))
+
+	return 0
+}
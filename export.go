@@ -0,0 +1,188 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type exportFile struct {
+	name string // name in archive
+	path string
+}
+
+// exportWikis find wikis in user directory accessible by the request,
+// relative paths are kept.
+func exportWikis(r *http.Request, req *apiRequest) ([]exportFile, error) {
+	skip := filepath.Clean(userBackupDir(req.site, req.user))
+
+	var files []exportFile
+	err := filepath.WalkDir(req.userPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if p != req.userPath && (p == skip || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), ".html") {
+			return nil
+		}
+
+		if req.wikiAccess(r, p) != 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(req.userPath, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, exportFile{name: filepath.ToSlash(rel), path: p})
+		return nil
+	})
+
+	return files, err
+}
+
+// exportBackups return backups of wiki with names in archive: relative to
+// user directory or, for backup directory outside of it, under "backups/".
+func exportBackups(req *apiRequest, wiki string) ([]exportFile, error) {
+	backups, err := listBackups(wikiBackupPath(req.site, req.user, wiki))
+	if err != nil {
+		return nil, err
+	}
+
+	root := req.userPath
+	prefix := ""
+	if dir := userBackupDir(req.site, req.user); !strings.HasPrefix(filepath.Clean(dir), req.userPath+"/") {
+		root, prefix = filepath.Clean(dir), "backups/"
+	}
+
+	var files []exportFile
+	for _, b := range backups {
+		for _, p := range []string{b.path, b.path + checksumExt} {
+			if _, err := os.Stat(p); err != nil {
+				continue
+			}
+
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, exportFile{name: prefix + filepath.ToSlash(rel), path: p})
+		}
+	}
+
+	return files, nil
+}
+
+func addZipFile(zw *zip.Writer, f exportFile) error {
+	src, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	hdr.Name = f.name
+	hdr.Method = zip.Deflate
+	if strings.HasSuffix(f.name, ".gz") {
+		hdr.Method = zip.Store
+	}
+
+	dst, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("export %s error: %w", f.name, err)
+	}
+
+	return nil
+}
+
+// serveExport handle GET /api/v1/export: stream zip archive with all wikis
+// of user and, with ?include-backups=true, their backups.
+func serveExport(w http.ResponseWriter, r *http.Request, req *apiRequest) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	wikis, err := exportWikis(r, req)
+	if err != nil {
+		log.Println(err)
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	includeBackups := backupsEnabled && r.URL.Query().Get("include-backups") == "true"
+
+	name := fmt.Sprintf("wikis-%s.zip", time.Now().Format("2006-01-02"))
+	if req.user != "" {
+		name = fmt.Sprintf("wikis-%s-%s.zip", req.user, time.Now().Format("2006-01-02"))
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	// user lock is taken only while copying a wiki, so saves are not
+	// blocked for the whole download
+	req.handler.mu.Unlock()
+	defer req.handler.mu.Lock()
+
+	zw := zip.NewWriter(w)
+
+	for _, f := range wikis {
+		req.handler.mu.Lock()
+		err := addZipFile(zw, f)
+		req.handler.mu.Unlock()
+
+		if err != nil {
+			log.Printf("export %s error: %v\n", f.path, err)
+			return
+		}
+
+		if !includeBackups {
+			continue
+		}
+
+		unlock := lockBackups(wikiBackupPath(req.site, req.user, f.name))
+		backups, err := exportBackups(req, f.name)
+		for i := 0; err == nil && i < len(backups); i++ {
+			err = addZipFile(zw, backups[i])
+		}
+		unlock()
+
+		if err != nil {
+			log.Printf("export backups of %s error: %v\n", f.path, err)
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Printf("export error: %v\n", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxTiddlerFileName is maximum length of file name made from tiddler title.
+const maxTiddlerFileName = 200
+
+var (
+	extractWiki   string
+	extractDir    string
+	extractFormat string
+)
+
+// tiddlerFileName make file name from tiddler title the same way as
+// TiddlyWiki on Node.js: characters not allowed in file names are replaced
+// with "_".
+func tiddlerFileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`<>:"/\|?*^`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+
+	name = strings.Trim(name, ". ")
+	if len(name) > maxTiddlerFileName {
+		name = name[:maxTiddlerFileName]
+	}
+	if name == "" {
+		name = "_"
+	}
+
+	return name
+}
+
+// tidFile format tiddler fields as .tid file: fields as "name: value" lines,
+// blank line and text. Return false when some value can not be written in
+// this format.
+func tidFile(fields map[string]string) ([]byte, bool) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if name != "text" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		if strings.ContainsAny(name, ":\n") || strings.ContainsRune(fields[name], '\n') {
+			return nil, false
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", name, fields[name])
+	}
+
+	buf.WriteString("\n")
+	buf.WriteString(fields["text"])
+
+	return buf.Bytes(), true
+}
+
+// tiddlerFields return fields of tiddler as strings; non-string values are
+// stored as JSON.
+func tiddlerFields(raw json.RawMessage) (map[string]string, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(values))
+	for name, v := range values {
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			s = string(v)
+		}
+		fields[name] = s
+	}
+
+	return fields, nil
+}
+
+// extractTiddlers write every tiddler of wiki into own file in dir, in
+// json or tid format; tiddlers which can not be stored as .tid are written
+// as .json. Return number of written files.
+func extractTiddlers(wiki, dir, format string) (int, error) {
+	if format != "json" && format != "tid" {
+		return 0, fmt.Errorf("invalid extract format %q", format)
+	}
+
+	f, err := os.Open(filepath.Clean(wiki))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return 0, err
+	}
+
+	used := make(map[string]bool)
+	count := 0
+
+	err = eachTiddler(f, func(raw json.RawMessage) error {
+		fields, err := tiddlerFields(raw)
+		if err != nil {
+			return fmt.Errorf("invalid tiddler: %w", err)
+		}
+		if fields["title"] == "" {
+			return nil
+		}
+
+		var data []byte
+		ext := ".json"
+		if format == "tid" {
+			if tid, ok := tidFile(fields); ok {
+				data, ext = tid, ".tid"
+			}
+		}
+		if data == nil {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, raw, "", "  "); err != nil {
+				return err
+			}
+			buf.WriteString("\n")
+			data = buf.Bytes()
+		}
+
+		// different titles may give the same file name
+		base := tiddlerFileName(fields["title"])
+		name := base + ext
+		for i := 1; used[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+		used[strings.ToLower(name)] = true
+
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			return err
+		}
+		count++
+
+		return nil
+	})
+
+	return count, err
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile is no-op on systems without flock; tokens are still protected
+// by inviteMu within the process.
+func lockFile(_ *os.File) error {
+	return nil
+}
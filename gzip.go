@@ -0,0 +1,236 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// brotliLevel is compromise between speed and size; higher levels are
+// too slow for wikis of several MB.
+const brotliLevel = 6
+
+var (
+	compressMinSize = byteSize(4096)
+	compressBrotli  bool
+)
+
+// acceptsEncoding check if client accept content encoding (gzip, br).
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.TrimSpace(name) != encoding {
+			continue
+		}
+		return strings.ReplaceAll(params, " ", "") != "q=0"
+	}
+	return false
+}
+
+// responseEncoding choose encoding of response: Brotli, when enabled and
+// accepted, is preferred over gzip. Empty string means no compression.
+func responseEncoding(r *http.Request) string {
+	switch {
+	case compressBrotli && acceptsEncoding(r, "br"):
+		return "br"
+	case acceptsEncoding(r, "gzip"):
+		return "gzip"
+	}
+	return ""
+}
+
+// newEncoder return compressing writer for encoding.
+func newEncoder(w io.Writer, encoding string) io.WriteCloser {
+	if encoding == "br" {
+		return brotli.NewWriterLevel(w, brotliLevel)
+	}
+	return gzip.NewWriter(w)
+}
+
+// compressWriter compress successful responses; other responses (304, 206,
+// errors) are passed unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	h := c.Header()
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", c.encoding)
+		c.enc = newEncoder(c.ResponseWriter, c.encoding)
+	}
+
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *compressWriter) Close() error {
+	if c.enc != nil {
+		return c.enc.Close()
+	}
+	return nil
+}
+
+type liveHash struct {
+	modTime time.Time
+	size    int64
+	sum     string
+}
+
+// liveHashes keep SHA-256 of wiki files, so they can be matched with
+// checksums of compressed backups.
+var liveHashes sync.Map
+
+func wikiHash(fullPath string, fi os.FileInfo) (string, error) {
+	if v, ok := liveHashes.Load(fullPath); ok {
+		h := v.(liveHash)
+		if h.size == fi.Size() && h.modTime.Equal(fi.ModTime()) {
+			return h.sum, nil
+		}
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	liveHashes.Store(fullPath, liveHash{modTime: fi.ModTime(), size: fi.Size(), sum: sum})
+
+	return sum, nil
+}
+
+// servePrecompressed serve compressed backup with the same content as the
+// wiki, if there is one. Return false when response was not written.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, fullPath, backupPath string, fi os.FileInfo) bool {
+	backups, err := listBackups(backupPath)
+	if err != nil {
+		return false
+	}
+
+	var backup *backupInfo
+	for i := range backups {
+		if !backups[i].Delta && backups[i].Compressed && backups[i].SHA256 != "" {
+			backup = &backups[i]
+			break
+		}
+	}
+
+	if backup == nil {
+		return false
+	}
+
+	sum, err := wikiHash(fullPath, fi)
+	if err != nil || sum != backup.SHA256 {
+		return false
+	}
+
+	f, err := os.Open(backup.path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	etag := fileETag(fi)
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatch(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Encoding", "gzip")
+	h.Set("Content-Length", strconv.FormatInt(backup.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, f)
+	}
+
+	return true
+}
+
+// gzipExt is extension of pre-compressed copy of a wiki kept next to it.
+const gzipExt = ".gz"
+
+// serveGzipFile serve <wiki>.html.gz when it is not older than the wiki.
+// Return false when response was not written.
+func serveGzipFile(w http.ResponseWriter, r *http.Request, fullPath string) bool {
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		return false
+	}
+
+	gzPath := fullPath + gzipExt
+	gzfi, err := os.Stat(gzPath)
+	if err != nil || !gzfi.Mode().IsRegular() || gzfi.ModTime().Before(fi.ModTime()) {
+		return false
+	}
+
+	f, err := os.Open(gzPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	h := w.Header()
+	h.Set("ETag", fileETag(gzfi))
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Encoding", "gzip")
+	if r.Header.Get("Range") == "" {
+		// ServeContent does not set length of encoded content
+		h.Set("Content-Length", strconv.FormatInt(gzfi.Size(), 10))
+	}
+
+	http.ServeContent(w, r, filepath.Base(fullPath), gzfi.ModTime(), f)
+
+	return true
+}
+
+// removeGzipFile delete pre-compressed copy of wiki, which become stale when
+// the wiki is modified.
+func removeGzipFile(fullPath string) {
+	if err := os.Remove(fullPath + gzipExt); err != nil && !os.IsNotExist(err) {
+		log.Printf("remove %s error: %v\n", fullPath+gzipExt, err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// diskCheckFile is written and read back in wikis directories to check if
+// storage works.
+const diskCheckFile = ".widdler-health"
+
+var (
+	startTime = time.Now()
+
+	diskCheckInterval = 30 * time.Second
+	// diskHealthy is false when the last disk check failed; writes are
+	// refused then.
+	diskHealthy atomic.Bool
+)
+
+func init() {
+	diskHealthy.Store(true)
+}
+
+var errDiskCheck = errors.New("disk check failed")
+
+// checkDisk write, read back and remove small file in dir.
+func checkDisk(dir string) error {
+	fname := filepath.Join(dir, diskCheckFile)
+	data := []byte(time.Now().Format(time.RFC3339Nano))
+
+	if err := os.WriteFile(fname, data, 0o600); err != nil {
+		return fmt.Errorf("write %s error: %w", fname, err)
+	}
+	defer os.Remove(fname)
+
+	read, err := os.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("read %s error: %w", fname, err)
+	}
+
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("%s: %w", fname, errDiskCheck)
+	}
+
+	return nil
+}
+
+// diskCheckLoop periodically check storage of all virtual hosts.
+func diskCheckLoop(interval time.Duration) {
+	for {
+		healthy := true
+		for _, v := range allVhosts() {
+			if err := checkDisk(v.davDir); err != nil {
+				log.Printf("disk check error: %v\n", err)
+				healthy = false
+				break
+			}
+		}
+
+		if diskHealthy.Swap(healthy) != healthy && healthy {
+			log.Printf("disk check ok again\n")
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// countWikis return number of wiki files in dir, skipping backups.
+func countWikis(dir string) int {
+	count := 0
+
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if p != dir && d.Name() == backupDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasSuffix(d.Name(), ".html") {
+			count++
+		}
+
+		return nil
+	})
+
+	return count
+}
+
+// checkHealth verify that wiki directories are available.
+func checkHealth() (int, error) {
+	count := 0
+	for _, v := range allVhosts() {
+		if _, err := os.Stat(v.davDir); err != nil {
+			return 0, err
+		}
+		count += countWikis(v.davDir)
+	}
+
+	return count, nil
+}
+
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	count, err := checkHealth()
+	if err == nil && !diskHealthy.Load() {
+		err = errDiskCheck
+	}
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": "degraded",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(startTime).Seconds()),
+		"wiki_count":     count,
+	})
+}
+
+// readyHandler additionally check that user handlers were initialised.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	ready := false
+	for _, v := range allVhosts() {
+		v.handlers.mu.RLock()
+		ready = ready || len(v.handlers.list) > 0
+		v.handlers.mu.RUnlock()
+	}
+
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": "degraded",
+			"error":  "no user handlers initialised",
+		})
+		return
+	}
+
+	healthHandler(w, r)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	checkHTPass bool
+	fixHTPass   bool
+)
+
+// htpassIssue is malformed line of .htpasswd file.
+type htpassIssue struct {
+	line   int
+	user   string
+	reason string
+}
+
+// checkHTPassLine return reason why line of .htpasswd can not be used;
+// empty when it is valid, blank or comment. User is returned when known.
+func checkHTPassLine(line string) (string, string) {
+	switch {
+	case strings.ContainsRune(line, 0):
+		return "", "contains NUL byte"
+	case !utf8.ValidString(line):
+		return "", "invalid UTF-8"
+	}
+
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", ""
+	}
+
+	fields := strings.Split(line, ":")
+	if len(fields) == 3 {
+		return checkHTDigestLine(fields)
+	}
+	if len(fields) != 2 {
+		return "", fmt.Sprintf("expected user:hash, got %d fields", len(fields))
+	}
+
+	user := strings.TrimLeft(fields[0], " \t")
+	hash := strings.TrimLeft(fields[1], " \t")
+	if user == "" {
+		return "", "empty user name"
+	}
+	if strings.ContainsRune(user, '"') || strings.ContainsRune(hash, '"') {
+		return user, "contains quote"
+	}
+
+	if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+		return user, "not a bcrypt hash"
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil || len(hash) != 60 {
+		return user, "invalid bcrypt hash"
+	}
+
+	return user, ""
+}
+
+// checkHTDigestLine check user:realm:HA1 entry used by -auth digest.
+func checkHTDigestLine(fields []string) (string, string) {
+	user := strings.TrimLeft(fields[0], " \t")
+	if user == "" {
+		return "", "empty user name"
+	}
+	if fields[1] != digestRealm {
+		return user, fmt.Sprintf("realm %q instead of %q", fields[1], digestRealm)
+	}
+
+	ha1 := fields[2]
+	if _, err := hex.DecodeString(ha1); err != nil || (len(ha1) != 32 && len(ha1) != 64) {
+		return user, "invalid digest hash"
+	}
+
+	return user, ""
+}
+
+// checkHTPassFile report malformed lines of .htpasswd file at path and, with
+// fix, remove them. Return number of problems left in the file.
+func checkHTPassFile(out io.Writer, path string, fix bool) (int, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var issues []htpassIssue
+	var kept bytes.Buffer
+	for i, line := range lines {
+		user, reason := checkHTPassLine(strings.TrimRight(line, "\r\n"))
+		if reason == "" {
+			kept.WriteString(line)
+			continue
+		}
+		issues = append(issues, htpassIssue{line: i + 1, user: user, reason: reason})
+	}
+
+	for _, issue := range issues {
+		if issue.user != "" {
+			fmt.Fprintf(out, "%s:%d: %s (user %q)\n", path, issue.line, issue.reason, issue.user)
+		} else {
+			fmt.Fprintf(out, "%s:%d: %s\n", path, issue.line, issue.reason)
+		}
+	}
+
+	if len(issues) == 0 {
+		fmt.Fprintf(out, "%s: %d lines OK\n", path, len(lines))
+		return 0, nil
+	}
+
+	if !fix {
+		fmt.Fprintf(out, "%s: %d malformed lines; use -fix to remove them\n", path, len(issues))
+		return len(issues), nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return len(issues), err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), fi.Mode().Perm()); err != nil {
+		return len(issues), fmt.Errorf("write %s error: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return len(issues), fmt.Errorf("replace %s error: %w", path, err)
+	}
+
+	fmt.Fprintf(out, "%s: removed %d malformed lines\n", path, len(issues))
+
+	return 0, nil
+}
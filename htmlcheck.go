@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// sniffLen is number of bytes of request body checked by -strict-html.
+const sniffLen = 512
+
+var strictHTML bool
+
+// looksLikeHTML check if beginning of content looks like an HTML document.
+func looksLikeHTML(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(head, []byte("\xfe\xff")) || bytes.HasPrefix(head, []byte("\xff\xfe")) {
+		// UTF-16 text can not be checked further
+		return true
+	}
+
+	start := bytes.ToLower(bytes.TrimLeft(head, " \t\r\n"))
+	if bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html")) {
+		return true
+	}
+
+	return twSignature.Match(head)
+}
+
+// checkHTMLBody peek at the beginning of request body and check that it is
+// an HTML document. Read bytes are put back to the body.
+func checkHTMLBody(r *http.Request) (bool, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r.Body, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+	head = head[:n]
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	return looksLikeHTML(head), nil
+}
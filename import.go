@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	uploadMaxSize = byteSize(50 << 20)
+
+	twSignature = regexp.MustCompile(`(?i)<meta\s+name=["']application-name["']\s+content=["']TiddlyWiki["']`)
+)
+
+// readUpload return content of "file" field of multipart request and its
+// file name. Content larger than uploadMaxSize is rejected.
+func readUpload(r *http.Request) ([]byte, string, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, "", errors.New("missing file field")
+			}
+			return nil, "", err
+		}
+
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, int64(uploadMaxSize)+1))
+		part.Close()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if int64(len(data)) > int64(uploadMaxSize) {
+			return nil, "", errUploadTooLarge
+		}
+
+		return data, part.FileName(), nil
+	}
+}
+
+var errUploadTooLarge = errors.New("file too large")
+
+// serveImport handle POST /api/v1/wikis/import: save uploaded TiddlyWiki
+// file in user directory. Wiki name is taken from ?name or from uploaded
+// file name. Existing wiki is replaced only with ?overwrite=true.
+func serveImport(w http.ResponseWriter, r *http.Request, req *apiRequest) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	data, fname, err := readUpload(r)
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			jsonError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !twSignature.Match(data) {
+		jsonError(w, http.StatusUnprocessableEntity, "not a TiddlyWiki file")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(fname, `\`, "/")))
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".htm"), ".html") + ".html"
+
+	fullPath := resolveWiki(req.userPath, name)
+	if fullPath == "" || name == ".html" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if _, err := os.Stat(fullPath); err == nil && r.URL.Query().Get("overwrite") != "true" {
+		jsonError(w, http.StatusConflict, "wiki exists")
+		return
+	}
+
+	if isReadOnly(fullPath) {
+		jsonError(w, http.StatusMethodNotAllowed, "wiki is read-only")
+		return
+	}
+
+	over, err := req.handler.exceedsQuota(req.userPath, fullPath, int64(len(data)))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if over {
+		jsonError(w, http.StatusInsufficientStorage, "quota exceeded")
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o700); err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".import-*")
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, bytes.NewReader(data))
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fullPath)
+	}
+	if err != nil {
+		log.Printf("import %s error: %v\n", fullPath, err)
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	req.handler.invalidateUsage()
+	if req.handler.cache != nil {
+		req.handler.cache.invalidate(fullPath)
+	}
+
+	if backupsEnabled {
+		// imported file is the first state of the wiki
+		forgetBackupAge(fullPath)
+		if err := safeCreateBackup(fullPath, wikiBackupPath(req.site, req.user, name), wikiBackupConfig(fullPath), false); err != nil {
+			log.Printf("backup of imported %s error: %v\n", fullPath, err)
+		}
+	}
+
+	log.Printf("%s imported %s (%d bytes)\n", req.user, fullPath, len(data))
+	writeJSON(w, http.StatusCreated, map[string]string{"wiki": name, "url": "/" + name})
+}
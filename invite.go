@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	registerPath      = "/register"
+	minPasswordLength = 8
+)
+
+var (
+	inviteTokens string
+	genInvite    bool
+
+	inviteMu sync.Mutex
+
+	errInvalidToken = errors.New("invalid or used invite token")
+
+	userNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+)
+
+const registerPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>widdler - register</title>
+</head>
+<body>
+<h1>Create account</h1>
+{{if .Error}}<p><b>{{.Error}}</b></p>{{end}}
+<form method="post" action="register">
+<input type="hidden" name="token" value="{{.Token}}">
+<p><label>Username: <input name="username" value="{{.User}}" required></label></p>
+<p><label>Password: <input type="password" name="password" required></label></p>
+<p><label>Repeat password: <input type="password" name="password2" required></label></p>
+<p><input type="submit" value="Register"></p>
+</form>
+</body>
+</html>
+`
+
+var registerTempl = template.Must(template.New("register").Parse(registerPage))
+
+type registerForm struct {
+	Token string
+	User  string
+	Error string
+}
+
+// readTokens return lines of tokens file; used tokens are commented out.
+func readTokens(fname string) ([]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	return lines, s.Err()
+}
+
+func tokenValid(fname, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	inviteMu.Lock()
+	defer inviteMu.Unlock()
+
+	lines, err := readTokens(fname)
+	if err != nil {
+		log.Printf("read invite tokens error: %v\n", err)
+		return false
+	}
+
+	for _, l := range lines {
+		if strings.TrimSpace(l) == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+// useToken mark token as used by user and call register. The tokens file
+// is locked, so token can be used only once also by concurrent processes.
+func useToken(fname, token, user string, register func() error) error {
+	inviteMu.Lock()
+	defer inviteMu.Unlock()
+
+	lock, err := os.OpenFile(fname+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("lock invite tokens error: %w", err)
+	}
+
+	lines, err := readTokens(fname)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, l := range lines {
+		if token != "" && strings.TrimSpace(l) == token {
+			lines[i] = fmt.Sprintf("# used %s by %s at %s", token, user, time.Now().Format(time.RFC3339))
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return errInvalidToken
+	}
+
+	if err := register(); err != nil {
+		return err
+	}
+
+	tmp := fname + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write invite tokens error: %w", err)
+	}
+
+	return os.Rename(tmp, fname)
+}
+
+// addInvite append new token to tokens file and return it.
+func addInvite(fname string) (string, error) {
+	token := randomToken(16)
+
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := fmt.Fprintln(f, token); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return token, f.Close()
+}
+
+// registerUser add user to .htpasswd of default host and create its
+// directory with an empty wiki.
+func registerUser(user, pass string) error {
+	userPath := defaultVhost.userDir(user)
+	if !validUserName(user) || userPath == "" {
+		return fmt.Errorf("invalid user name %q", user)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), genCost)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Clean(htpassPaths(passPath)[0]), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(f, "%s:%s\n", user, hash); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(userPath, 0o700); err != nil {
+		return err
+	}
+
+	err = createEmpty(path.Join(userPath, "wiki.html"), "")
+	if err != nil && !errors.Is(err, errCreateDisabled) {
+		return err
+	}
+
+	return defaultVhost.loadUsers()
+}
+
+// registerHandler show registration form for valid invite token and create
+// account on submit.
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	form := registerForm{Token: r.FormValue("token")}
+
+	render := func(code int) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		if err := registerTempl.Execute(w, form); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if !tokenValid(inviteTokens, form.Token) {
+		http.Error(w, errInvalidToken.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		render(http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	form.User = r.PostFormValue("username")
+	pass := r.PostFormValue("password")
+
+	switch {
+	case !userNameRe.MatchString(form.User) || !validUserName(form.User):
+		form.Error = "Invalid username; use letters, digits, '.', '_' and '-', not starting with '.'."
+	case len(pass) < minPasswordLength:
+		form.Error = fmt.Sprintf("Password must have at least %d characters.", minPasswordLength)
+	case pass != r.PostFormValue("password2"):
+		form.Error = "Passwords do not match."
+	}
+
+	if _, exists := defaultVhost.lookupUser(form.User); form.Error == "" && exists {
+		form.Error = "User already exists."
+	}
+
+	if form.Error != "" {
+		render(http.StatusBadRequest)
+		return
+	}
+
+	err := useToken(inviteTokens, form.Token, form.User, func() error {
+		return registerUser(form.User, pass)
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidToken) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		log.Printf("register %s error: %v\n", form.User, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("registered user %s\n", form.User)
+	journal("register user=%q remote=%s", form.User, clientIP(r))
+
+	http.Redirect(w, r, prefixed("/wiki.html"), http.StatusSeeOther)
+}
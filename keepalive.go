@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	idleTimeout  time.Duration
+	maxIdleConns int
+	keepAlive    = true
+)
+
+// idleLimiter close connections going idle when there are already
+// maxIdleConns idle ones, so keep-alive can not hold too many sockets.
+type idleLimiter struct {
+	mu   sync.Mutex
+	max  int
+	idle map[net.Conn]struct{}
+}
+
+func (l *idleLimiter) connState(c net.Conn, state http.ConnState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if state != http.StateIdle {
+		delete(l.idle, c)
+		return
+	}
+
+	if len(l.idle) >= l.max {
+		c.Close()
+		return
+	}
+	l.idle[c] = struct{}{}
+}
+
+// setupKeepAlive apply keep-alive flags to server s and log them.
+func setupKeepAlive(s *http.Server) {
+	if !keepAlive {
+		s.SetKeepAlivesEnabled(false)
+		log.Println("Keep-alive: disabled")
+		return
+	}
+
+	s.IdleTimeout = idleTimeout
+
+	timeout := "same as read timeout"
+	if idleTimeout > 0 {
+		timeout = idleTimeout.String()
+	} else if readTimeout == 0 {
+		timeout = "none"
+	}
+
+	conns := "unlimited"
+	if maxIdleConns > 0 {
+		l := &idleLimiter{max: maxIdleConns, idle: make(map[net.Conn]struct{})}
+		s.ConnState = l.connState
+		conns = strconv.Itoa(maxIdleConns)
+	}
+
+	log.Printf("Keep-alive: idle timeout %s, max idle connections %s\n", timeout, conns)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetupKeepAlive(t *testing.T) {
+	defer func(i time.Duration, m int, k bool) { idleTimeout, maxIdleConns, keepAlive = i, m, k }(idleTimeout, maxIdleConns, keepAlive)
+
+	tests := []struct {
+		idleTimeout  time.Duration
+		maxIdleConns int
+		keepAlive    bool
+		wantLimiter  bool
+	}{
+		{0, 0, true, false},
+		{time.Minute, 0, true, false},
+		{time.Minute, 10, true, true},
+		{time.Minute, 10, false, false},
+	}
+
+	for _, tt := range tests {
+		idleTimeout, maxIdleConns, keepAlive = tt.idleTimeout, tt.maxIdleConns, tt.keepAlive
+
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		setupKeepAlive(ts.Config)
+		// httptest replaces ConnState when started
+		if got := ts.Config.ConnState != nil; got != tt.wantLimiter {
+			t.Errorf("%+v: idle connections limited %v, want %v", tt, got, tt.wantLimiter)
+		}
+		ts.Start()
+
+		wantIdle := tt.idleTimeout
+		if !tt.keepAlive {
+			wantIdle = 0
+		}
+		if ts.Config.IdleTimeout != wantIdle {
+			t.Errorf("%+v: IdleTimeout %s, want %s", tt, ts.Config.IdleTimeout, wantIdle)
+		}
+
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Close == tt.keepAlive {
+			t.Errorf("%+v: connection closed %v", tt, resp.Close)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestIdleLimiter(t *testing.T) {
+	l := &idleLimiter{max: 1, idle: make(map[net.Conn]struct{})}
+
+	a, peerA := net.Pipe()
+	b, peerB := net.Pipe()
+	defer peerA.Close()
+	defer peerB.Close()
+
+	l.connState(a, http.StateIdle)
+	l.connState(b, http.StateIdle)
+
+	// b is over the limit and closed; a stays open
+	if _, err := b.Write([]byte("x")); err == nil {
+		t.Error("connection over limit not closed")
+	}
+	if len(l.idle) != 1 {
+		t.Errorf("%d idle connections, want 1", len(l.idle))
+	}
+
+	// active connection frees place for another idle one
+	l.connState(a, http.StateActive)
+	c, peerC := net.Pipe()
+	defer peerC.Close()
+	l.connState(c, http.StateIdle)
+	if _, ok := l.idle[c]; !ok {
+		t.Error("idle connection not accepted after other became active")
+	}
+	a.Close()
+	c.Close()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	landingTemplate string
+	templ           atomic.Pointer[template.Template]
+)
+
+// loadLanding parse landing page template from file or the built-in one
+// when path is empty. Template is checked by rendering sample data, so
+// references to fields missing in Landing are reported at load time.
+func loadLanding(path string) (*template.Template, error) {
+	src := landingPage
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read landing template error: %w", err)
+		}
+		src = string(data)
+	}
+
+	t, err := template.New("landing").Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse landing template error: %w", err)
+	}
+
+	sample := Landing{
+		User:     "user",
+		URL:      "http://localhost:8080/wiki.html",
+		Versions: []string{"5.3.3"},
+		Wikis:    []string{"wiki.html"},
+		Theme:    "light",
+		Prefix:   "/wikis",
+	}
+	if err := t.ExecuteTemplate(io.Discard, "landing", sample); err != nil {
+		return nil, fmt.Errorf("invalid landing template: %w", err)
+	}
+
+	return t, nil
+}
+
+// reloadLandingOnSignal re-read landing page template on SIGHUP; invalid
+// template is reported and the previous one is kept.
+func reloadLandingOnSignal(path string) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		t, err := loadLanding(path)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		templ.Store(t)
+		log.Printf("Reloaded landing template %s\n", path)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiEnabled is false when /api/v1/ is disabled with -api=false.
+var apiEnabled = true
+
+// wikiLinks return Link header values pointing to API endpoints of wiki
+// served at path p.
+func wikiLinks(site *vhost, p string) []string {
+	base := apiPrefix
+	if site == sharedSite {
+		base = "/" + sharedPrefix + strings.TrimPrefix(apiPrefix, "/")
+	}
+	base = prefixed(base)
+
+	name := (&url.URL{Path: strings.TrimPrefix(p, "/")}).EscapedPath()
+
+	return []string{
+		fmt.Sprintf(`<%swikis/%s/tiddlers>; rel="tiddlers"`, base, name),
+		fmt.Sprintf(`<%sbackups/%s>; rel="backups"`, base, name),
+		fmt.Sprintf(`<%swikis/%s/activity>; rel="activity"`, base, name),
+	}
+}
+
+// linkWriter add Link headers to successful responses.
+type linkWriter struct {
+	http.ResponseWriter
+	links       []string
+	wroteHeader bool
+}
+
+func (lw *linkWriter) WriteHeader(code int) {
+	if !lw.wroteHeader && code < http.StatusMultipleChoices {
+		for _, l := range lw.links {
+			lw.Header().Add("Link", l)
+		}
+	}
+	lw.wroteHeader = true
+
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *linkWriter) Write(b []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	return lw.ResponseWriter.Write(b)
+}
+
+func (lw *linkWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
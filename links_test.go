@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWikiLinks(t *testing.T) {
+	defer func(p string, s *vhost) { urlPrefix, sharedSite = p, s }(urlPrefix, sharedSite)
+	sharedSite = &vhost{}
+	site := &vhost{}
+
+	tests := []struct {
+		prefix string
+		site   *vhost
+		path   string
+		want   []string
+	}{
+		{"", site, "/a.html", []string{
+			`</api/v1/wikis/a.html/tiddlers>; rel="tiddlers"`,
+			`</api/v1/backups/a.html>; rel="backups"`,
+			`</api/v1/wikis/a.html/activity>; rel="activity"`,
+		}},
+		{"/wikis", site, "/notes/my wiki.html", []string{
+			`</wikis/api/v1/wikis/notes/my%20wiki.html/tiddlers>; rel="tiddlers"`,
+			`</wikis/api/v1/backups/notes/my%20wiki.html>; rel="backups"`,
+			`</wikis/api/v1/wikis/notes/my%20wiki.html/activity>; rel="activity"`,
+		}},
+		{"", sharedSite, "/team.html", []string{
+			`</shared/api/v1/wikis/team.html/tiddlers>; rel="tiddlers"`,
+			`</shared/api/v1/backups/team.html>; rel="backups"`,
+			`</shared/api/v1/wikis/team.html/activity>; rel="activity"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		urlPrefix = tt.prefix
+		if got := wikiLinks(tt.site, tt.path); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("wikiLinks(%q) with prefix %q = %q, want %q", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestLinkHeaders(t *testing.T) {
+	defer func(a bool) { apiEnabled = a }(apiEnabled)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "a.html")
+	v := &vhost{davDir: dir}
+	addHandler(&v.handlers, "", dir)
+	h := wikiHandler(v)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	apiEnabled = false
+	if links := get("/a.html").Header().Values("Link"); len(links) != 0 {
+		t.Errorf("Link headers with -api=false: %q", links)
+	}
+
+	apiEnabled = true
+	rec := get("/a.html")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status %d", rec.Code)
+	}
+
+	link := regexp.MustCompile(`^<([^>]+)>; rel="(\w+)"$`)
+	rels := make(map[string]bool)
+	for _, l := range rec.Header().Values("Link") {
+		m := link.FindStringSubmatch(l)
+		if m == nil {
+			t.Errorf("invalid Link header %q", l)
+			continue
+		}
+		rels[m[2]] = true
+
+		u, err := url.Parse(m[1])
+		if err != nil {
+			t.Errorf("invalid URL in Link header %q: %v", l, err)
+			continue
+		}
+		if code := get(u.String()).Code; code != http.StatusOK {
+			t.Errorf("GET %s: status %d, want %d", u, code, http.StatusOK)
+		}
+	}
+
+	for _, rel := range []string{"tiddlers", "backups", "activity"} {
+		if !rels[rel] {
+			t.Errorf("Link with rel=%s missing", rel)
+		}
+	}
+
+	// links are added only to successful responses
+	if links := get("/missing.txt").Header().Values("Link"); len(links) != 0 {
+		t.Errorf("Link headers on error: %q", links)
+	}
+}
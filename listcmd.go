@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	listCmd    bool
+	listFormat string
+)
+
+// discoverWikis find all wikis under dir. The first directory level is
+// the user; wikis directly in dir (without authentication) have no user.
+// Hidden directories and backup directories are skipped.
+func discoverWikis(dir string) ([]wikiInfo, error) {
+	site := &vhost{davDir: dir}
+
+	result := []wikiInfo{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		user, name, ok := strings.Cut(rel, "/")
+		if !ok {
+			user, name = "", rel
+		}
+
+		if d.IsDir() {
+			if p == dir {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") || p == filepath.Clean(userBackupDir(site, user)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), ".html") {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		info := wikiInfo{
+			User:       user,
+			Name:       name,
+			SizeBytes:  fi.Size(),
+			CreatedAt:  fi.ModTime(),
+			ModifiedAt: fi.ModTime(),
+		}
+
+		if backups, err := listBackups(wikiBackupPath(site, user, name)); err == nil {
+			info.BackupCount = len(backups)
+		}
+
+		result = append(result, info)
+		return nil
+	})
+
+	return result, err
+}
+
+// printWikis write list of wikis under dir in given format: table or json.
+func printWikis(out io.Writer, dir, format string) error {
+	wikis, err := discoverWikis(dir)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(wikis)
+	case "table":
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "USER\tWIKI\tSIZE\tMODIFIED\tBACKUPS")
+		for _, wi := range wikis {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", wi.User, wi.Name, formatSize(wi.SizeBytes),
+				wi.ModifiedAt.Format(time.DateTime), wi.BackupCount)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("invalid list format %q", format)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const unixPrefix = "unix:"
+
+var (
+	socketModeStr string
+	socketMode    os.FileMode
+)
+
+// listenAddrs split comma-separated -http value into addresses.
+func listenAddrs(spec string) []string {
+	var addrs []string
+	for _, a := range strings.Split(spec, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// unixSockets return paths of Unix sockets from addrs.
+func unixSockets(addrs []string) []string {
+	var paths []string
+	for _, a := range addrs {
+		if p, ok := strings.CutPrefix(a, unixPrefix); ok {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// parseSocketMode parse octal file mode of Unix sockets.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// openListener listen on TCP address or, for "unix:<path>", on Unix socket.
+// Stale socket file left by previous run is removed first; the file is
+// removed again when listener is closed.
+func openListener(addr string) (net.Listener, error) {
+	sock, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if fi, err := os.Lstat(sock); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(sock)
+	}
+
+	lis, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(sock, socketMode); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("chmod socket %s error: %w", sock, err)
+	}
+
+	return lis, nil
+}
+
+// removeSockets delete socket files of Unix listeners.
+func removeSockets(addrs []string) {
+	for _, p := range unixSockets(addrs) {
+		os.Remove(p)
+	}
+}
+
+// publicAddr return first TCP address, used to build links to the server.
+func publicAddr(addrs []string) string {
+	for _, a := range addrs {
+		if !strings.HasPrefix(a, unixPrefix) {
+			return a
+		}
+	}
+	return "localhost"
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+var (
+	lockStorePath string
+	locks         *lockStore
+)
+
+// lockRecord is WebDAV lock as stored in -dav.lock-store file.
+type lockRecord struct {
+	Token string `json:"token"`
+	// Dir is the directory served by the handler owning the lock.
+	Dir   string `json:"dir"`
+	Path  string `json:"path"`
+	Depth string `json:"depth"`
+	// Timeout is expiry time of the lock; nil for infinite locks.
+	Timeout *time.Time `json:"timeout,omitempty"`
+	Owner   string     `json:"owner,omitempty"`
+}
+
+func (l *lockRecord) expired(now time.Time) bool {
+	return l.Timeout != nil && !now.Before(*l.Timeout)
+}
+
+// lockStore keep WebDAV locks of all handlers and save them to file on
+// every change.
+type lockStore struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]*lockRecord
+}
+
+// loadLockStore read locks from file; expired ones are discarded.
+func loadLockStore(path string) (*lockStore, error) {
+	s := &lockStore{path: path, records: make(map[string]*lockRecord)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read lock store %s error: %w", path, err)
+	}
+
+	var records []*lockRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse lock store %s error: %w", path, err)
+	}
+
+	now := time.Now()
+	for _, r := range records {
+		if !r.expired(now) {
+			s.records[r.Token] = r
+		}
+	}
+
+	return s, nil
+}
+
+// save write all not expired locks to file. Caller must hold s.mu.
+func (s *lockStore) save() {
+	now := time.Now()
+	records := make([]*lockRecord, 0, len(s.records))
+	for token, r := range s.records {
+		if r.expired(now) {
+			delete(s.records, token)
+			continue
+		}
+		records = append(records, r)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		log.Printf("save lock store error: %v\n", err)
+		return
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.Printf("save lock store error: %v\n", err)
+		return
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("save lock store error: %v\n", err)
+	}
+}
+
+func (s *lockStore) put(r *lockRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[r.Token] = r
+	s.save()
+}
+
+func (s *lockStore) remove(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, token)
+	s.save()
+}
+
+// live check if lock with token is stored and not expired.
+func (s *lockStore) live(token string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[token]
+	return ok && !r.expired(now)
+}
+
+// system return lock system for handler serving dir with locks restored
+// from the store.
+func (s *lockStore) system(dir string) webdav.LockSystem {
+	ls := &persistentLS{
+		store:  s,
+		dir:    dir,
+		mem:    webdav.NewMemLS(),
+		tokens: make(map[string]string),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for token, r := range s.records {
+		if r.Dir != dir || r.expired(now) {
+			continue
+		}
+
+		details := webdav.LockDetails{
+			Root:      r.Path,
+			Duration:  -1,
+			OwnerXML:  r.Owner,
+			ZeroDepth: r.Depth == "0",
+		}
+		if r.Timeout != nil {
+			details.Duration = r.Timeout.Sub(now)
+		}
+
+		memToken, err := ls.mem.Create(now, details)
+		if err != nil {
+			log.Printf("restore lock %s on %s error: %v\n", token, r.Path, err)
+			continue
+		}
+		ls.tokens[token] = memToken
+	}
+
+	return ls
+}
+
+// newLockSystem return lock system for handler serving dir: persistent when
+// -dav.lock-store is set, in memory otherwise.
+func newLockSystem(dir string) webdav.LockSystem {
+	if locks == nil {
+		return &countedLS{webdav.NewMemLS()}
+	}
+	return &countedLS{locks.system(dir)}
+}
+
+// persistentLS is webdav.LockSystem that keep locks in memory (webdav.memLS)
+// and record them in lockStore. Tokens of memLS can not be chosen, so
+// persistent tokens are mapped to tokens of restored locks.
+type persistentLS struct {
+	store *lockStore
+	dir   string
+	mem   webdav.LockSystem
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (p *persistentLS) memToken(token string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.tokens[token]
+	return t, ok
+}
+
+func (p *persistentLS) forget(token string) {
+	p.mu.Lock()
+	delete(p.tokens, token)
+	p.mu.Unlock()
+
+	p.store.remove(token)
+}
+
+func (p *persistentLS) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	mapped := make([]webdav.Condition, len(conditions))
+	for i, c := range conditions {
+		if t, ok := p.memToken(c.Token); ok {
+			c.Token = t
+		}
+		mapped[i] = c
+	}
+
+	release, err := p.mem.Confirm(now, name0, name1, mapped...)
+	if errors.Is(err, webdav.ErrConfirmationFailed) || errors.Is(err, webdav.ErrNoSuchLock) {
+		// memLS drop expired locks silently; forget their tokens too
+		for _, c := range conditions {
+			if _, ok := p.memToken(c.Token); ok && !p.store.live(c.Token, now) {
+				p.forget(c.Token)
+			}
+		}
+	}
+
+	return release, err
+}
+
+func (p *persistentLS) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	memToken, err := p.mem.Create(now, details)
+	if err != nil {
+		return "", err
+	}
+
+	token := "opaquelocktoken:" + randomToken(16)
+
+	p.mu.Lock()
+	p.tokens[token] = memToken
+	p.mu.Unlock()
+
+	r := &lockRecord{
+		Token: token,
+		Dir:   p.dir,
+		Path:  filepath.ToSlash(filepath.Clean("/" + details.Root)),
+		Depth: "infinity",
+		Owner: details.OwnerXML,
+	}
+	if details.ZeroDepth {
+		r.Depth = "0"
+	}
+	if details.Duration >= 0 {
+		t := now.Add(details.Duration)
+		r.Timeout = &t
+	}
+	p.store.put(r)
+
+	return token, nil
+}
+
+func (p *persistentLS) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	memToken, ok := p.memToken(token)
+	if !ok {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+
+	details, err := p.mem.Refresh(now, memToken, duration)
+	if err != nil {
+		if errors.Is(err, webdav.ErrNoSuchLock) {
+			p.forget(token)
+		}
+		return details, err
+	}
+
+	p.store.mu.Lock()
+	if r, ok := p.store.records[token]; ok {
+		r.Timeout = nil
+		if duration >= 0 {
+			t := now.Add(duration)
+			r.Timeout = &t
+		}
+		p.store.save()
+	}
+	p.store.mu.Unlock()
+
+	return details, nil
+}
+
+func (p *persistentLS) Unlock(now time.Time, token string) error {
+	memToken, ok := p.memToken(token)
+	if !ok {
+		return webdav.ErrNoSuchLock
+	}
+
+	err := p.mem.Unlock(now, memToken)
+	if err == nil || errors.Is(err, webdav.ErrNoSuchLock) {
+		p.forget(token)
+	}
+
+	return err
+}
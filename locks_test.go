@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestLockStoreReload(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "locks.json")
+	store, err := loadLockStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	ls := store.system("/srv/wikis/alice")
+	token, err := ls.Create(now, webdav.LockDetails{Root: "/a.html", Duration: time.Hour, ZeroDepth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, err := ls.Create(now.Add(-2*time.Second), webdav.LockDetails{Root: "/b.html", Duration: time.Second, ZeroDepth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restart: expired lock is dropped while loading
+	later := now.Add(time.Minute)
+	store, err = loadLockStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.records[short]; ok {
+		t.Errorf("expired lock %s loaded", short)
+	}
+	ls = store.system("/srv/wikis/alice")
+
+	release, err := ls.Confirm(later, "/a.html", "", webdav.Condition{Token: token})
+	if err != nil {
+		t.Fatalf("Confirm of persisted token error: %v", err)
+	}
+	release()
+
+	if _, err := ls.Confirm(later, "/a.html", "", webdav.Condition{Token: "opaquelocktoken:unknown"}); err == nil {
+		t.Errorf("Confirm of unknown token succeeded")
+	}
+
+	if err := ls.Unlock(later, token); err != nil {
+		t.Fatalf("Unlock of persisted token error: %v", err)
+	}
+	if len(store.records) != 0 {
+		t.Errorf("records after unlock: %v", store.records)
+	}
+	if err := ls.Unlock(later, token); !errors.Is(err, webdav.ErrNoSuchLock) {
+		t.Errorf("second Unlock error %v, want %v", err, webdav.ErrNoSuchLock)
+	}
+}
+
+func TestPersistentLSConfirmExpired(t *testing.T) {
+	store, err := loadLockStore(filepath.Join(t.TempDir(), "locks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	ls := store.system("/srv/wikis/alice").(*persistentLS)
+	token, err := ls.Create(now, webdav.LockDetails{Root: "/a.html", Duration: time.Second, ZeroDepth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ls.Confirm(now.Add(2*time.Second), "/a.html", "", webdav.Condition{Token: token}); err == nil {
+		t.Fatalf("Confirm of expired lock succeeded")
+	}
+	if _, ok := ls.memToken(token); ok {
+		t.Errorf("token of expired lock not forgotten")
+	}
+}
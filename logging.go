@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	logQuery bool
+	// redactParams are names of query parameters hidden in logs
+	redactParams = make(map[string]bool)
+)
+
+const redacted = "[REDACTED]"
+
+func parseRedactParams(spec string) {
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			redactParams[name] = true
+		}
+	}
+}
+
+// redactQuery hide values of -log.redact-params parameters in raw query.
+func redactQuery(rawQuery string) string {
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil && redactParams[name] {
+			parts[i] = key + "=" + redacted
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// logPath return path of request for logs; with -log.query the query is
+// included, with values of -log.redact-params parameters hidden. u is not
+// modified.
+func logPath(u *url.URL) string {
+	if !logQuery || u.RawQuery == "" {
+		return u.Path
+	}
+
+	return u.Path + "?" + redactQuery(u.RawQuery)
+}
+
+// logRequestURI return request target as sent by client, with values of
+// -log.redact-params parameters hidden.
+func logRequestURI(uri string) string {
+	if p, q, ok := strings.Cut(uri, "?"); ok {
+		return p + "?" + redactQuery(q)
+	}
+	return uri
+}
+
+// requestEntry describe one served request.
+type requestEntry struct {
+	Time          time.Time
+	Method        string
+	Path          string
+	Proto         string
+	Remote        string
+	ContentLength int64
+	Status        int
+	Duration      time.Duration
+	RequestID     string
+}
+
+// logSink receive access log entries and, as io.Writer, lines from the
+// standard log package.
+type logSink interface {
+	io.Writer
+	LogRequest(e *requestEntry)
+}
+
+// textSink write logs in traditional, human readable format.
+type textSink struct {
+	out io.Writer
+}
+
+func (t *textSink) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+func (t *textSink) LogRequest(e *requestEntry) {
+	fmt.Fprintf(t.out, "%s (%s) [%s] \"%s %s\" %03d %s\n",
+		e.Remote,
+		e.Time.Format(time.RFC822Z),
+		e.Method,
+		e.Path,
+		e.Proto,
+		e.ContentLength,
+		e.RequestID,
+	)
+}
+
+// jsonSink write logs as newline-delimited JSON.
+type jsonSink struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+type jsonEntry struct {
+	TS            string `json:"ts"`
+	Level         string `json:"level"`
+	Msg           string `json:"msg"`
+	Method        string `json:"method,omitempty"`
+	Path          string `json:"path,omitempty"`
+	Remote        string `json:"remote,omitempty"`
+	ContentLength *int64 `json:"content_length,omitempty"`
+	Status        int    `json:"status,omitempty"`
+	DurationMS    *int64 `json:"duration_ms,omitempty"`
+	RequestID     string `json:"request_id,omitempty"`
+}
+
+func (j *jsonSink) emit(e *jsonEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.out.Write(append(data, '\n'))
+
+	return err
+}
+
+func (j *jsonSink) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+
+	level := "info"
+	if strings.Contains(strings.ToLower(msg), "error") {
+		level = "error"
+	}
+
+	err := j.emit(&jsonEntry{
+		TS:    time.Now().Format(time.RFC3339Nano),
+		Level: level,
+		Msg:   msg,
+	})
+
+	return len(p), err
+}
+
+func (j *jsonSink) LogRequest(e *requestEntry) {
+	duration := e.Duration.Milliseconds()
+	length := e.ContentLength
+
+	_ = j.emit(&jsonEntry{
+		TS:            e.Time.Format(time.RFC3339Nano),
+		Level:         "info",
+		Msg:           "request",
+		Method:        e.Method,
+		Path:          e.Path,
+		Remote:        e.Remote,
+		ContentLength: &length,
+		Status:        e.Status,
+		DurationMS:    &duration,
+		RequestID:     e.RequestID,
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &jsonSink{out: &buf}
+
+	sink.LogRequest(&requestEntry{
+		Time:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Method:        "PUT",
+		Path:          "/a.html",
+		Remote:        "192.0.2.1",
+		ContentLength: 42,
+		Status:        201,
+		Duration:      1500 * time.Millisecond,
+		RequestID:     "abc",
+	})
+	if _, err := sink.Write([]byte("backup a.html error: disk full\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink.Write([]byte("Listening on :8080\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), buf.String())
+	}
+
+	var req map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"ts":             "2024-01-02T03:04:05Z",
+		"level":          "info",
+		"msg":            "request",
+		"method":         "PUT",
+		"path":           "/a.html",
+		"remote":         "192.0.2.1",
+		"content_length": 42.0,
+		"status":         201.0,
+		"duration_ms":    1500.0,
+		"request_id":     "abc",
+	}
+	for k, v := range want {
+		if req[k] != v {
+			t.Errorf("request field %s = %v, want %v", k, req[k], v)
+		}
+	}
+
+	tests := []struct {
+		line  string
+		level string
+		msg   string
+	}{
+		{lines[1], "error", "backup a.html error: disk full"},
+		{lines[2], "info", "Listening on :8080"},
+	}
+	for _, tt := range tests {
+		var e jsonEntry
+		if err := json.Unmarshal([]byte(tt.line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Level != tt.level || e.Msg != tt.msg || e.TS == "" {
+			t.Errorf("entry %q: level %q, msg %q, want %q, %q", tt.line, e.Level, e.Msg, tt.level, tt.msg)
+		}
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	defer func(m map[string]bool) { redactParams = m }(redactParams)
+	redactParams = make(map[string]bool)
+	parseRedactParams("token, key")
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"a=1", "a=1"},
+		{"token=secret&a=1", "token=" + redacted + "&a=1"},
+		{"a=1&key=x&key=y", "a=1&key=" + redacted + "&key=" + redacted},
+		{"to%6Ben=secret", "to%6Ben=" + redacted},
+	}
+
+	for _, tt := range tests {
+		if got := redactQuery(tt.query); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestLogPathRedact(t *testing.T) {
+	defer func(q bool, m map[string]bool, s logSink) { logQuery, redactParams, accessLog = q, m, s }(logQuery, redactParams, accessLog)
+	redactParams = make(map[string]bool)
+	parseRedactParams("token")
+
+	u, err := url.Parse("/a.html?token=secret&tw=5.3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logQuery = false
+	if got := logPath(u); got != "/a.html" {
+		t.Errorf("logPath without -log.query = %q", got)
+	}
+
+	logQuery = true
+	want := "/a.html?token=" + redacted + "&tw=5.3.0"
+	if got := logPath(u); got != want {
+		t.Errorf("logPath = %q, want %q", got, want)
+	}
+	if got := logRequestURI(u.RequestURI()); got != want {
+		t.Errorf("logRequestURI = %q, want %q", got, want)
+	}
+
+	// request seen by handler and logged request
+	var buf bytes.Buffer
+	accessLog = &jsonSink{out: &buf}
+	var query string
+	h := logger(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	})
+	r := httptest.NewRequest(http.MethodGet, "/a.html?token=secret&tw=5.3.0", nil)
+	h(httptest.NewRecorder(), r)
+
+	if query != "token=secret&tw=5.3.0" || r.URL.RawQuery != query {
+		t.Errorf("request query modified: %q, %q", query, r.URL.RawQuery)
+	}
+	if u.RawQuery != "token=secret&tw=5.3.0" {
+		t.Errorf("URL query modified: %q", u.RawQuery)
+	}
+
+	var e map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["path"] != want {
+		t.Errorf("logged path %v, want %q", e["path"], want)
+	}
+}
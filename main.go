@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"embed"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -18,7 +25,6 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -29,13 +35,52 @@ import (
 
 // Landing will be used to fill our landing template
 type Landing struct {
-	User string
-	URL  string
+	User      string
+	URL       string
+	Versions  []string
+	Wikis     []string
+	Theme     string
+	CustomCSS template.CSS
+	NoCreate  bool
+	Prefix    string
 }
 
-const landingPage = `
+const landingPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>widdler</title>
+<style>
+:root { --bg: #ffffff; --fg: #222222; --link: #0645ad; --code-bg: #f0f0f0; }
+{{- if eq .Theme "dark"}}
+:root { --bg: #1e1e1e; --fg: #dddddd; --link: #8ab4f8; --code-bg: #2d2d2d; }
+{{- else if eq .Theme "auto"}}
+@media (prefers-color-scheme: dark) {
+	:root { --bg: #1e1e1e; --fg: #dddddd; --link: #8ab4f8; --code-bg: #2d2d2d; }
+}
+{{- end}}
+body { background: var(--bg); color: var(--fg); font-family: sans-serif; max-width: 48em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+a { color: var(--link); }
+code { background: var(--code-bg); padding: 0 .2em; }
+{{.CustomCSS}}
+</style>
+</head>
+<body>
 <h1>Hello{{if .User}} {{.User}}{{end}}! Welcome to widdler!</h1>
-
+{{if .Wikis}}
+<h3>Your wikis:</h3>
+
+<ul>
+{{range .Wikis}}<li><a href="{{$.Prefix}}/{{.}}">{{.}}</a></li>
+{{end}}</ul>
+
+{{- if not .NoCreate}}
+<p>To create another TiddlyWiki html file, append a new html file name to the URL in the address bar, e.g. <a href="{{.URL}}">{{.URL}}</a>.</p>
+{{- end}}
+{{else if .NoCreate}}
+<p>There are no wikis yet.</p>
+{{else}}
 <p>To create a new TiddlyWiki html file, simply append an html file name to the URL in the address bar!</p>
 
 <h3>For example:</h3>
@@ -43,16 +88,30 @@ const landingPage = `
 <a href="{{.URL}}">{{.URL}}</a>
 
 <p>This will create a new wiki called "<b>wiki.html</b>"</p>
-
+{{end}}
+{{- if .Versions}}
+<p>Available TiddlyWiki versions (add <code>?tw=&lt;version&gt;</code> to the URL to choose one):</p>
+
+<ul>
+{{range .Versions}}<li><a href="{{$.URL}}?tw={{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{end}}
+{{- if and (not .Wikis) (not .NoCreate)}}
 <p>After creating a wiki, this message will be replaced by a list of your wiki files.</p>
+{{end}}
+</body>
+</html>
 `
 
 var (
 	twFile = "empty.html"
 
+	theme     string
+	themeCSS  string
+	customCSS template.CSS
+
 	//go:embed empty.html
 	tiddly embed.FS
-	templ  *template.Template
 )
 
 type userHandler struct {
@@ -60,347 +119,1026 @@ type userHandler struct {
 	dav  *webdav.Handler
 	fs   http.Handler
 	name string
+	dir  string
+
+	usageSize int64
+	usageAt   time.Time
+
+	cache *wikiCache
+
+	accessLog *rotatingFile
+
+	// slots limit requests holding or waiting for mu
+	slots chan struct{}
+}
+
+// acquire take request slot of the user; return false when all slots are in
+// use.
+func (h *userHandler) acquire() bool {
+	if h.slots == nil {
+		return true
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait take request slot, blocking until one is free.
+func (h *userHandler) wait() {
+	if h.slots != nil {
+		h.slots <- struct{}{}
+	}
+}
+
+func (h *userHandler) release() {
+	if h.slots != nil {
+		<-h.slots
+	}
 }
 
 type userHandlers struct {
-	list []userHandler
+	list []*userHandler
 	mu   sync.RWMutex
 }
 
 func (u *userHandlers) find(name string) *userHandler {
-	for i := range u.list {
-		if u.list[i].name == name {
-			return &u.list[i]
+	for _, h := range u.list {
+		if h.name == name {
+			return h
 		}
 	}
 	return nil
 }
 
+// findOrAdd return handler for user, creating it when user is seen for
+// the first time.
+func (u *userHandlers) findOrAdd(name, uPath string) *userHandler {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if h := u.find(name); h != nil {
+		return h
+	}
+
+	if uPath == "" {
+		// directory of user would be outside of wikis directory
+		log.Printf("invalid user name %q\n", name)
+		return nil
+	}
+
+	return addHandler(u, name, uPath)
+}
+
 var (
 	auth       string
+	configFile string
 	davDir     string
 	fullListen string
 	genHtpass  bool
-	handlers   userHandlers
+	genCost    int
 	listen     string
 	passPath   string
+	vhostsPath string
+	totpPath   string
+	envPrefix  string
 	tlsCert    string
 	tlsKey     string
-	users      map[string]string
+	tlsCA      string
 	version    bool
 	build      string
+	serviceCmd string
 
 	backupsEnabled bool
 	backupDir      string
 	backupFiles    int
 	backupMinAge   int
 	backupCompress bool
+	backupMode     string
+
+	shutdownTimeout   time.Duration
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	metricsEnabled    bool
+	logFormat         string
+	redactParamsSpec  string
+	rateLimitSpec     string
+	rateWhitelist     string
+	trustProxy        string
+	adminUsers        string
+	htpassWatch       bool
+	readOnly          bool
+	noCreate          bool
+	userGlob          string
+	userMaxConcurrent int
+	cacheEnabled      bool
+	authSecret        string
+	authClaim         string
+	sessionTTL        time.Duration
+	authMinCost       int
+	weakHashWarned    sync.Map
+	oidcIssuer        string
+	oidcClientID      string
+	oidcClientSecret  string
+	oidcRedirectURL   string
+	cacheSize         = byteSize(64 << 20)
+	trustedProxies    []*net.IPNet
+	accessLog         logSink = &textSink{out: os.Stdout}
+	quota             byteSize
 )
 
+const htpassWatchInterval = 5 * time.Second
+
+var errCreateDisabled = errors.New("creating wikis is disabled")
+
 var pledges = "stdio wpath rpath cpath tty inet dns unveil"
 
 func init() {
-	users = make(map[string]string)
 	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	flag.StringVar(&davDir, "wikis", dir, "Directory of TiddlyWikis to serve over WebDAV.")
-	flag.StringVar(&listen, "http", "localhost:8080", "Listen on")
+	flag.StringVar(&listen, "http", "localhost:8080", "Listen on (comma-separated addresses, unix:<path> for Unix socket)")
+	flag.StringVar(&socketModeStr, "http.socket-mode", "0660", "File mode of Unix sockets.")
+	flag.BoolVar(&proxyProtocol, "proxy-protocol", false, "Read client address from PROXY protocol (v1 or v2) header sent by load balancer.")
+	flag.BoolVar(&proxyProtocolStrict, "proxy-protocol.strict", false, "Reject connections without PROXY protocol header.")
 	flag.StringVar(&tlsCert, "tlscert", "", "TLS certificate.")
 	flag.StringVar(&tlsKey, "tlskey", "", "TLS key.")
-	flag.StringVar(&passPath, "htpass", fmt.Sprintf("%s/.htpasswd", dir), "Path to .htpasswd file..")
-	flag.StringVar(&auth, "auth", "none", "Enable HTTP Basic Authentication (basic, none, header).")
+	flag.BoolVar(&tlsWatch, "tls.watch", false, "Reload -tlscert and -tlskey when they change.")
+	flag.BoolVar(&httpsRedirect, "https.redirect", false, "Redirect plain HTTP to HTTPS and send HSTS header.")
+	flag.StringVar(&httpsRedirectPort, "https.redirect-port", "80", "Port of plain HTTP listener redirecting to HTTPS.")
+	flag.StringVar(&tlsACME, "tls.acme", "", "Obtain TLS certificate with ACME (Let's Encrypt) for this domain (comma-separated list).")
+	flag.StringVar(&tlsACMECache, "tls.acme.cache", "./.acme-cache", "Directory for ACME certificates cache.")
+	flag.StringVar(&tlsACMEHTTPPort, "tls.acme.http-port", "80", "Port for ACME HTTP-01 challenge listener.")
+	flag.StringVar(&tlsCA, "tls.ca", "", "CA certificate used to verify client certificates (-auth mtls).")
+	flag.StringVar(&passPath, "htpass", fmt.Sprintf("%s/.htpasswd", dir), "Path to .htpasswd file (comma-separated list to merge more files).")
+	flag.StringVar(&lockStorePath, "dav.lock-store", "", "File to keep WebDAV locks in across restarts.")
+	flag.StringVar(&auditLogPath, "audit.log", "", "Append-only log of write operations (empty to disable).")
+	flag.StringVar(&sharedDir, "shared.dir", "", "Directory of wikis shared by all users, served under /shared/.")
+	flag.StringVar(&sharedUsersSpec, "shared.users", "", "Comma-separated list of users allowed to access shared wikis (default all).")
+	flag.BoolVar(&http2Push, "http2.push", false, "Push resources from Link preload headers of wikis over HTTP/2 (TLS only).")
+	flag.BoolVar(&strictHTML, "strict-html", true, "Reject saving wikis with content which does not look like HTML.")
+	flag.StringVar(&journalPath, "journal", fmt.Sprintf("%s/.journal", dir), "Path to journal of deleted wikis (empty to disable).")
+	flag.StringVar(&vhostsPath, "vhosts", "", "Path to YAML file mapping host names to wikis_dir, htpass and auth.")
+	flag.StringVar(&auth, "auth", "none", "Enable HTTP Basic Authentication (basic, digest, none, header, mtls, oidc, webhook).")
+	flag.StringVar(&envPrefix, "auth.env-prefix", "", "Load users from environment variables with this prefix (PREFIX<USERNAME>=<bcrypt-hash>).")
+	flag.StringVar(&totpPath, "auth.totp", "", "Path to TOTP secrets file (user:base32secret); enables second factor.")
 	flag.BoolVar(&genHtpass, "gen", false, "Generate a .htpasswd file or add a new entry to an existing file.")
+	flag.IntVar(&genCost, "gen.cost", 11, "bcrypt cost of password generated by -gen, 10-14; each step doubles hashing time (about 50ms for 10, 100ms for 11, 200ms for 12, 400ms for 13, 800ms for 14).")
+	flag.IntVar(&authMinCost, "auth.min-cost", 10, "Warn about password hashes with bcrypt cost lower than this.")
+	flag.StringVar(&inviteTokens, "invite.tokens", "", "File with invite tokens enabling registration at /register.")
+	flag.BoolVar(&genInvite, "gen.invite", false, "Add a new invite token to -invite.tokens file.")
+	flag.BoolVar(&checkHTPass, "check-htpass", false, "Check .htpasswd file for malformed lines and exit.")
+	flag.BoolVar(&fixHTPass, "fix", false, "Remove malformed lines found by -check-htpass.")
+	flag.BoolVar(&rebuildManifestCmd, "backup.rebuild-manifest", false, "Regenerate manifests of all backup directories and exit.")
+	flag.StringVar(&serviceCmd, "service", "", "Manage Windows service: install, uninstall, start or stop.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Check configuration, print report and exit without starting the server.")
+	flag.StringVar(&extractWiki, "extract", "", "Write tiddlers of this wiki file as separate files to -extract.dir and exit.")
+	flag.StringVar(&extractDir, "extract.dir", "tiddlers", "Output directory of -extract.")
+	flag.StringVar(&extractFormat, "extract.format", "tid", "Format of files written by -extract (tid, json).")
+	flag.BoolVar(&apiEnabled, "api", true, "Enable JSON API under /api/v1/.")
+	flag.BoolVar(&listCmd, "list", false, "List all wikis and exit.")
+	flag.BoolVar(&migrateCmd, "migrate", false, "Move wikis from the wikis directory with their backups to directory of -to-user and exit; with -dry-run only print what would be moved.")
+	flag.StringVar(&migrateToUser, "to-user", "", "User whose directory wikis are moved to by -migrate.")
+	flag.StringVar(&listFormat, "list.format", "table", "Format of -list output (table, json).")
 	flag.BoolVar(&version, "v", false, "Show version and exit.")
 
 	flag.BoolVar(&backupsEnabled, "backup", false, "Create backup written files.")
-	flag.StringVar(&backupDir, "backup.dir", "backups", "Directory for backups in user directory.")
+	flag.StringVar(&backupDir, "backup.dir", "backups", "Directory for backups in user directory; absolute path stores backups of all users there.")
 	flag.IntVar(&backupFiles, "backup.files", 10, "Maximum number of backup each file.")
+	flag.IntVar(&backupWorkers, "backup.workers", 2, "Number of background backup workers (0 - create backups while saving).")
+	flag.IntVar(&backupQueueSize, "backup.queue-size", 16, "Maximum number of pending backups; backups are skipped when queue is full.")
 	flag.IntVar(&backupMinAge, "backup.age", 60, "Minimal time between backups (in seconds)")
 	flag.BoolVar(&backupCompress, "backup.compress", false, "GZIP backup files.")
+	flag.StringVar(&backupMode, "backup.mode", backupModeFull, "Backup mode: full copies, delta patches against previous backup or changed tiddlers only (full, delta, tiddlers).")
+	flag.Var(&cleanupInactive, "cleanup.inactive", "Warn about wikis not accessed within this period (e.g. 90d).")
+	flag.Var(&compressMinSize, "compress.min-size", "Minimal size of wiki served with gzip or Brotli compression.")
+	flag.BoolVar(&compressBrotli, "compress.brotli", false, "Serve wikis with Brotli compression to clients accepting it.")
+	flag.Var(&uploadMaxSize, "upload.max-size", "Maximum size of imported wiki file.")
+	flag.Var(&shareMaxTTL, "share.max-ttl", "Maximum lifetime of links sharing wikis (e.g. 7d).")
+	flag.Var(&warnSize, "warn.size", "Size of wiki above which saves get X-Widdler-Warning header (default 90% of quota).")
+	flag.Var(&httpMaxBody, "http.max-body", "Maximum size of request body (e.g. 200MB) except saved wikis; 0 means unlimited.")
+	flag.Var(&wikiMaxSize, "wiki.max-size", "Maximum size of a wiki file (e.g. 100MB); 0 means unlimited. Overridden by <user>/.maxsize file.")
+	flag.Var(&quota, "quota", "Default per-user disk quota (e.g. 500MB); 0 means unlimited. Overridden by <user>/.quota file.")
+	flag.StringVar(&webhookURL, "auth.webhook-url", "", "URL of authentication webhook (-auth webhook).")
+	flag.DurationVar(&webhookTimeout, "auth.webhook-timeout", 2*time.Second, "Timeout of authentication webhook requests.")
+	flag.DurationVar(&webhookCacheTTL, "auth.webhook-cache-ttl", 30*time.Second, "How long successful webhook authentications are cached.")
+	flag.StringVar(&otelEndpoint, "otel.endpoint", "", "Export traces of requests to this OpenTelemetry collector (OTLP/HTTP, e.g. http://localhost:4318).")
+	flag.StringVar(&debugToken, "debug.token", "", "Token accepted in X-Debug-Token header by /debug/ endpoints; without it they are available only from loopback.")
+	flag.BoolVar(&debugPprof, "debug.pprof", false, "Serve pprof profiles under /debug/pprof/ (same access rules as /debug/stats).")
+	flag.StringVar(&sentryDSN, "sentry.dsn", "", "Report server errors and panics to Sentry project with this DSN.")
+	flag.StringVar(&authSecret, "auth.secret", "", "Secret used to sign session cookies.")
+	flag.StringVar(&authClaim, "auth.claim", "email", "ID token claim used as user name (-auth oidc).")
+	flag.DurationVar(&sessionTTL, "auth.session-ttl", 24*time.Hour, "Session lifetime.")
+	flag.BoolVar(&authSession, "auth.session", false, "Issue session cookie to browsers after successful Basic auth (-auth basic).")
+	flag.StringVar(&oidcIssuer, "auth.oidc.issuer", "", "OpenID Connect issuer URL (-auth oidc).")
+	flag.StringVar(&oidcClientID, "auth.oidc.client-id", "", "OpenID Connect client ID.")
+	flag.StringVar(&oidcClientSecret, "auth.oidc.client-secret", "", "OpenID Connect client secret.")
+	flag.StringVar(&oidcRedirectURL, "auth.oidc.redirect-url", "", "OpenID Connect redirect URL, e.g. https://wiki.example.com/auth/callback.")
+	flag.StringVar(&urlPrefix, "prefix", "", "URL path prefix under which wikis are served, e.g. /wikis.")
+	flag.StringVar(&staticDir, "static", "", "Directory of static assets (fonts, images) served under /static/.")
+	flag.BoolVar(&staticPublic, "static.public", false, "Serve -static assets without authentication.")
+	flag.StringVar(&landingTemplate, "landing.template", "", "File with landing page template (reloaded on SIGHUP).")
+	flag.StringVar(&theme, "theme", "light", "Landing page theme (light, dark, auto).")
+	flag.StringVar(&themeCSS, "theme.custom-css", "", "CSS file added to the landing page.")
+	flag.StringVar(&twTemplateURL, "tw.template-url", "", "URL of empty TiddlyWiki used for new wikis, downloaded at start.")
+	flag.StringVar(&twTemplateCache, "tw.template-cache", fmt.Sprintf("%s/.empty-cache.html", dir), "File caching template downloaded from -tw.template-url.")
+	flag.StringVar(&twEmptyFile, "tw.empty", "", "File with empty TiddlyWiki used for new wikis instead of the embedded one.")
+	flag.BoolVar(&twAutoUpdate, "tw.auto-update", false, "Check -tw.update-url at start and download newer empty TiddlyWiki.")
+	flag.StringVar(&twUpdateURL, "tw.update-url", "", "URL of JSON describing the latest empty TiddlyWiki: {\"version\", \"url\", \"sha256\"}.")
+	flag.StringVar(&twVersionsDir, "tw.versions", "", "Directory with empty-<version>.html TiddlyWiki templates.")
+	flag.BoolVar(&cacheEnabled, "cache", false, "Cache wiki files in memory.")
+	flag.Var(&cacheSize, "cache.size", "Maximum size of in-memory cache.")
+	flag.BoolVar(&validatePut, "validate.put", true, "Reject saved wikis without valid tiddler store or truncated.")
+	flag.BoolVar(&noCreate, "no-create", false, "Do not create new wikis; existing ones are served as usual.")
+	flag.IntVar(&userMaxConcurrent, "user.max-concurrent", 4, "Maximum number of concurrent requests of one user; 0 disables the limit.")
+	flag.BoolVar(&userAutoCreate, "user.auto-create", false, "Serve every authenticated user, creating their directory on first login.")
+	flag.StringVar(&userSkel, "user.skel", "", "Directory copied into directories of new users.")
+	flag.StringVar(&userMapPath, "user.map", "", "TOML file mapping users to their directories (reloaded on SIGHUP).")
+	flag.StringVar(&userGlob, "user.glob", "", "Serve users whose existing directory match pattern (e.g. '*') without restart.")
+	flag.BoolVar(&readOnly, "readonly", false, "Serve wikis read-only; writes can be also blocked per wiki with <wiki>.readonly file.")
+	flag.BoolVar(&htpassWatch, "htpass.watch", false, "Reload .htpasswd files when they change.")
+	flag.StringVar(&adminUsers, "admin", "", "Comma-separated list of users allowed to manage other users' wikis.")
+	flag.StringVar(&rateLimitSpec, "ratelimit", "", "Limit requests per client address (e.g. 20/min); empty disables limit.")
+	flag.StringVar(&rateWhitelist, "ratelimit.whitelist", "", "Comma-separated list of CIDRs not subject to rate limit.")
+	flag.StringVar(&allowSpec, "allow", "", "Comma-separated list of CIDRs allowed to access the server.")
+	flag.StringVar(&corsSpec, "cors.origins", "", "Comma-separated list of origins allowed to make cross-origin requests (or *).")
+	flag.BoolVar(&corsCredentials, "cors.credentials", false, "Allow credentials in cross-origin requests.")
+	flag.BoolVar(&securityHeaders, "security-headers", true, "Add security headers (CSP, X-Frame-Options etc.) to HTML responses.")
+	flag.StringVar(&securityCSP, "security.csp", defaultCSP, "Content-Security-Policy of HTML responses.")
+	flag.StringVar(&denySpec, "deny", "", "Comma-separated list of CIDRs denied access to the server; takes precedence over -allow.")
+	flag.StringVar(&trustProxy, "trust.proxy", "", "Comma-separated list of CIDRs of trusted reverse proxies; enables X-Forwarded-For and X-Real-IP.")
+	flag.StringVar(&logFile, "log.file", "", "Write request log to this file instead of stdout.")
+	flag.Var(&logRotateSize, "log.rotate-size", "Rotate request log file when it exceeds this size (e.g. 100MB); 0 disables rotation.")
+	flag.IntVar(&logRotateKeep, "log.rotate-keep", 5, "Number of rotated request log files to keep.")
+	flag.BoolVar(&userAccessLog, "user-access-log", false, "Write requests to wikis of every user to access.log in Combined Log Format in the user directory.")
+	flag.StringVar(&logFormat, "log.format", "text", "Log format (text, json).")
+	flag.BoolVar(&logQuery, "log.query", false, "Include query string of requests in request log.")
+	flag.StringVar(&redactParamsSpec, "log.redact-params", "token,key,secret", "Comma-separated query parameters which values are hidden in request log.")
+	flag.BoolVar(&metricsEnabled, "metrics", false, "Expose Prometheus metrics on /metrics.")
+	flag.DurationVar(&readHeaderTimeout, "http.read-header-timeout", 10*time.Second, "Maximum time to read request headers.")
+	flag.DurationVar(&readTimeout, "http.read-timeout", 0, "Maximum time to read whole request, including body (0 - no limit).")
+	flag.DurationVar(&writeTimeout, "http.write-timeout", 60*time.Second, "Maximum time to write response.")
+	flag.DurationVar(&idleTimeout, "http.idle-timeout", 0, "How long idle keep-alive connections are kept open (0 - same as -http.read-timeout).")
+	flag.IntVar(&maxIdleConns, "http.max-idle-conns", 0, "Maximum number of idle keep-alive connections; 0 means unlimited.")
+	flag.BoolVar(&keepAlive, "http.keep-alive", true, "Keep client connections open between requests.")
+	flag.DurationVar(&timeoutGet, "timeout.get", 0, "Maximum time of GET and HEAD requests (0 - no limit).")
+	flag.DurationVar(&timeoutPut, "timeout.put", 0, "Maximum time of PUT requests (0 - no limit).")
+	flag.IntVar(&davMaxDepth, "dav.max-depth", 1, "Maximum Depth of PROPFIND requests (0 or 1; -1 allows infinity).")
+	flag.DurationVar(&timeoutPropfind, "timeout.propfind", 0, "Maximum time of PROPFIND requests (0 - no limit).")
+	flag.DurationVar(&diskCheckInterval, "health.disk-check-interval", diskCheckInterval, "How often writing to wikis directory is checked; 0 disables the check.")
+	flag.DurationVar(&shutdownTimeout, "shutdown.timeout", 30*time.Second, "Maximum time to wait for in-flight requests on shutdown.")
+	flag.StringVar(&configFile, "config", "", "Path to TOML configuration file; command line flags override its values.")
+}
+
+// parseFlags read configuration file and command line flags and check
+// them. It is called from main, so tests can run without flags of widdler.
+func parseFlags() {
+	var err error
+
+	if cfg := configFromArgs(os.Args[1:]); cfg != "" {
+		if err := loadConfig(cfg); err != nil {
+			log.Fatalln(err)
+		}
+	}
 	flag.Parse()
 
+	var accessOut io.Writer = os.Stdout
+	if logFile != "" {
+		logRotator, err = openRotatingFile(logFile, int64(logRotateSize), logRotateKeep)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		accessOut = logRotator
+	}
+
+	switch logFormat {
+	case "text":
+		accessLog = &textSink{out: accessOut}
+	case "json":
+		accessLog = &jsonSink{out: accessOut}
+		log.SetFlags(0)
+		log.SetOutput(&jsonSink{out: os.Stderr})
+	default:
+		log.Fatalf("invalid log format %q\n", logFormat)
+	}
+
+	if serviceCmd != "" {
+		if err := controlService(serviceCmd); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+	if runningAsService() {
+		startService()
+	}
+
 	// These are OpenBSD specific protections used to prevent unnecessary file access.
-	_ = protect.Unveil(passPath, "rwc")
+	for _, p := range htpassPaths(passPath) {
+		_ = protect.Unveil(p, "rwc")
+	}
 	_ = protect.Unveil(davDir, "rwc")
+	if logFile != "" {
+		_ = protect.Unveil(filepath.Dir(logFile), "rwc")
+	}
+	if lockStorePath != "" {
+		_ = protect.Unveil(filepath.Dir(lockStorePath), "rwc")
+	}
+	if inviteTokens != "" {
+		_ = protect.Unveil(filepath.Dir(inviteTokens), "rwc")
+	}
+	if checkHTPass && fixHTPass {
+		// fixed file is written next to the original and renamed
+		for _, p := range htpassPaths(passPath) {
+			_ = protect.Unveil(filepath.Dir(p), "rwc")
+		}
+	}
+	if auditLogPath != "" {
+		_ = protect.Unveil(auditLogPath, "rwc")
+	}
+	if sharedDir != "" {
+		_ = protect.Unveil(sharedDir, "rwc")
+	}
+	if journalPath != "" {
+		_ = protect.Unveil(journalPath, "rwc")
+	}
+	if filepath.IsAbs(backupDir) {
+		_ = protect.Unveil(backupDir, "rwc")
+	}
+	if totpPath != "" {
+		_ = protect.Unveil(totpPath, "r")
+	}
+	if vhostsPath != "" {
+		vhosts, err = loadVhosts(vhostsPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, v := range vhosts {
+			_ = protect.Unveil(v.davDir, "rwc")
+			for _, p := range htpassPaths(v.passPath) {
+				_ = protect.Unveil(p, "r")
+			}
+		}
+	}
+
+	if userMapPath != "" {
+		m, err := loadUserMap(userMapPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		userMap.Store(&m)
+
+		for _, dir := range m {
+			_ = protect.Unveil(dir, "rwc")
+		}
+	}
+	if tlsCA != "" {
+		_ = protect.Unveil(tlsCA, "r")
+	}
+	if tlsACME != "" {
+		_ = protect.Unveil(tlsACMECache, "rwc")
+	}
+	if twTemplateURL != "" && twTemplateCache != "" {
+		_ = protect.Unveil(twTemplateCache, "rwc")
+	}
+	if twVersionsDir != "" {
+		_ = protect.Unveil(twVersionsDir, "r")
+	}
+	if twEmptyFile != "" {
+		if twAutoUpdate {
+			_ = protect.Unveil(twEmptyFile, "rwc")
+			_ = protect.Unveil(twEmptyFile+".tmp", "rwc")
+		} else {
+			_ = protect.Unveil(twEmptyFile, "r")
+		}
+	}
+	if themeCSS != "" {
+		_ = protect.Unveil(themeCSS, "r")
+	}
+	if landingTemplate != "" {
+		_ = protect.Unveil(landingTemplate, "r")
+	}
+	if staticDir != "" {
+		_ = protect.Unveil(staticDir, "r")
+	}
+	if userSkel != "" {
+		_ = protect.Unveil(userSkel, "r")
+	}
+	if tlsWatch && tlsCert != "" && tlsKey != "" {
+		_ = protect.Unveil(tlsCert, "r")
+		_ = protect.Unveil(tlsKey, "r")
+	}
+	if inviteTokens != "" && !genInvite && auth != "basic" && auth != "header" {
+		log.Fatalln("-invite.tokens requires -auth basic or header")
+	}
+
+	if genCost < 10 || genCost > 14 {
+		log.Fatalf("invalid -gen.cost %d: must be between 10 and 14\n", genCost)
+	}
+
+	socketMode, err = parseSocketMode(socketModeStr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if socks := unixSockets(listenAddrs(listen)); len(socks) > 0 {
+		for _, sock := range socks {
+			_ = protect.Unveil(filepath.Dir(sock), "rwc")
+		}
+		pledges += " unix fattr"
+	}
 	_ = protect.Unveil("/etc/ssl/cert.pem", "r")
 	_ = protect.Unveil("/etc/resolv.conf", "r")
+	_ = protect.Unveil("/usr/share/zoneinfo", "r")
 	_ = protect.Pledge(pledges)
 
-	templ, err = template.New("landing").Parse(landingPage)
+	landing, err := loadLanding(landingTemplate)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	templ.Store(landing)
+
+	switch theme {
+	case "light", "dark", "auto":
+	default:
+		log.Fatalf("invalid theme %q\n", theme)
+	}
+
+	if themeCSS != "" {
+		css, err := os.ReadFile(themeCSS)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		customCSS = template.CSS(css) //nolint:gosec // trusted local file
+	}
+
+	if err := loadTemplates(twVersionsDir); err != nil {
+		log.Fatalln(err)
+	}
+	if err := loadEmptyTemplate(twEmptyFile); err != nil {
+		log.Fatalln(err)
+	}
+	if twAutoUpdate && twUpdateURL == "" {
+		log.Fatalln("-tw.auto-update requires -tw.update-url")
+	}
 
 	davDir, err = filepath.Abs(davDir)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	log.Printf("Wikis directory: %s\n", davDir)
-	log.Printf("Auth: %s\n", auth)
-	if backupsEnabled {
-		log.Printf("Backups enabled; dir: '%s'; max files: %d, min age: %ds, compress: %v\n", backupDir, backupFiles, backupMinAge, backupCompress)
-	} else {
-		log.Println("Backups disabled")
+	parseAdmins(adminUsers)
+	urlPrefix = normalizePrefix(urlPrefix)
+	parseRedactParams(redactParamsSpec)
+
+	if cacheEnabled {
+		sharedCache = newWikiCache(int64(cacheSize))
+		log.Printf("Cache enabled; size: %s\n", cacheSize.String())
 	}
-}
 
-func authenticate(user string, pass string) bool {
-	htpass, exists := users[user]
+	trustedProxies, err = parseCIDRs(trustProxy)
+	if err != nil {
+		log.Fatalf("invalid -trust.proxy: %v\n", err)
+	}
 
-	if !exists {
-		return false
+	allowNets, err = parseCIDRs(allowSpec)
+	if err != nil {
+		log.Fatalf("invalid -allow: %v\n", err)
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(htpass), []byte(pass))
-	return err == nil
-}
+	denyNets, err = parseCIDRs(denySpec)
+	if err != nil {
+		log.Fatalf("invalid -deny: %v\n", err)
+	}
 
-func logger(f http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		n := time.Now()
-		fmt.Printf("%s (%s) [%s] \"%s %s\" %03d\n",
-			r.RemoteAddr,
-			n.Format(time.RFC822Z),
-			r.Method,
-			r.URL.Path,
-			r.Proto,
-			r.ContentLength,
-		)
-		f(w, r)
+	if err := parseCORSOrigins(corsSpec, corsCredentials); err != nil {
+		log.Fatalln(err)
 	}
-}
 
-func createEmpty(path string) error {
-	_, fErr := os.Stat(path)
-	if os.IsNotExist(fErr) {
-		log.Printf("creating %q\n", path)
-		twData, _ := tiddly.ReadFile(twFile)
-		wErr := os.WriteFile(path, twData, 0o600)
-		if wErr != nil {
-			return wErr
+	if auditLogPath != "" {
+		auditLog, err = openAuditLog(auditLogPath)
+		if err != nil {
+			log.Fatalln(err)
 		}
 	}
-	return nil
-}
 
-func deleteOldBackups(fileBase string) {
-	files, err := filepath.Glob(fileBase + "-*_*.html*")
-	if err != nil {
-		fmt.Printf("delete old backups error: %v\n", err)
-		return
+	if lockStorePath != "" {
+		locks, err = loadLockStore(lockStorePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
 
-	if len(files) <= backupFiles {
-		return
+	if rateLimitSpec != "" {
+		limiter, err = newRateLimiter(rateLimitSpec, rateWhitelist)
+		if err != nil {
+			log.Fatalf("invalid -ratelimit: %v\n", err)
+		}
+		log.Printf("Rate limit: %s\n", rateLimitSpec)
 	}
-	sort.Strings(files)
 
-	toDel := files[:len(files)-backupFiles]
-	for _, fname := range toDel {
-		fmt.Printf("delete old backup: %s\n", fname)
-		os.Remove(fname)
+	if auth == "mtls" && (tlsCA == "" || (tlsCert == "" || tlsKey == "") && tlsACME == "") {
+		log.Fatalln("-auth mtls require -tls.ca and -tlscert and -tlskey or -tls.acme")
 	}
-}
-
-var backupsAge = make(map[string]time.Time)
 
-func createBackup(path, backupPath string) error {
-	if _, err := os.Stat(path); err != nil {
-		return nil
+	if auth == "webhook" && webhookURL == "" {
+		log.Fatalln("-auth webhook require -auth.webhook-url")
 	}
 
-	now := time.Now()
-
-	if backupMinAge > 0 {
-		if oldBackupTs, ok := backupsAge[path]; ok {
-			if now.Sub(oldBackupTs) < time.Duration(backupMinAge)*time.Second {
-				return nil
-			}
-		}
+	if backupMode != backupModeFull && backupMode != backupModeDelta && backupMode != backupModeTiddlers {
+		log.Fatalf("invalid backup mode %q\n", backupMode)
+	}
 
-		backupsAge[path] = now
+	if backupFiles < 1 {
+		log.Fatalln("-backup.files must be at least 1")
 	}
 
-	ext := filepath.Ext(backupPath)
-	base := backupPath[0 : len(backupPath)-len(ext)]
-	dstFilename := base + "-" + now.Format("20060102_150405") + ext
+	if davMaxDepth < -1 || davMaxDepth > 1 {
+		log.Fatalln("-dav.max-depth must be 0, 1 or -1")
+	}
 
-	if backupCompress {
-		dstFilename += ".gz"
+	if _, err := filepath.Match(userGlob, ""); err != nil {
+		log.Fatalf("invalid -user.glob: %v\n", err)
 	}
 
-	backupDir, _ := filepath.Split(dstFilename)
-	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(backupDir, 0o700); err != nil {
-			return fmt.Errorf("create backup dir %s error: %w", backupDir, err)
-		}
+	log.Printf("Wikis directory: %s\n", davDir)
+	log.Printf("Auth: %s\n", auth)
+	if backupsEnabled {
+		log.Printf("Backups enabled; dir: '%s'; max files: %d, min age: %ds, compress: %v, mode: %s\n", backupDir, backupFiles, backupMinAge, backupCompress, backupMode)
+	} else {
+		log.Println("Backups disabled")
 	}
+}
 
-	log.Printf("backup %s -> %s\n", path, dstFilename)
+func (v *vhost) authenticate(user string, pass string, code string) bool {
+	htpass, exists := v.lookupUser(user)
 
-	source, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("open %s for backup error: %w", path, err)
+	if !exists {
+		return false
 	}
-	defer source.Close()
 
-	var destination io.WriteCloser
+	if totp != nil && code == "" {
+		pass, code = totp.splitTOTP(user, pass)
+	}
 
-	destination, err = os.Create(dstFilename)
+	err := bcrypt.CompareHashAndPassword([]byte(htpass), []byte(pass))
 	if err != nil {
-		return fmt.Errorf("create backup file %s error: %w", dstFilename, err)
+		return false
 	}
-	defer destination.Close()
 
-	if backupCompress {
-		destination, err = gzip.NewWriterLevel(destination, gzip.BestCompression)
-		defer destination.Close()
+	warnWeakHash(user, htpass)
 
-		if err != nil {
-			return fmt.Errorf("create gzip writer error: %w", err)
-		}
+	if totp != nil {
+		return totp.verify(user, pass, code, time.Now())
 	}
-	if _, err = io.Copy(destination, source); err != nil {
-		return fmt.Errorf("create backup file error: %w", err)
+
+	return true
+}
+
+// warnWeakHash log, once per user, that password hash uses cost lower
+// than -auth.min-cost.
+func warnWeakHash(user, hash string) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil || cost >= authMinCost {
+		return
 	}
 
-	deleteOldBackups(base)
+	if _, warned := weakHashWarned.LoadOrStore(user, true); !warned {
+		log.Printf("password hash of %q uses bcrypt cost %d, lower than %d; consider regenerating it\n",
+			user, cost, authMinCost)
+	}
+}
 
-	return nil
+// statusWriter remember status code written by handler.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
 }
 
-func prompt(prompt string, secure bool) (string, error) {
-	var input string
-	fmt.Print(prompt)
+func (s *statusWriter) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
 
-	if secure {
-		b, err := term.ReadPassword(int(os.Stdin.Fd()))
-		if err != nil {
-			return "", err
-		}
-		input = string(b)
-	} else {
-		_, err := fmt.Scanln(&input)
-		if err != nil {
-			return "", err
-		}
-	}
-	return input, nil
+// Hijack take over connection, e.g. for WebSocket.
+func (s *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.code = http.StatusSwitchingProtocols
+	return http.NewResponseController(s.ResponseWriter).Hijack()
 }
 
-func addHandler(u, uPath string) {
-	handlers.list = append(handlers.list, userHandler{
-		name: u,
-		dav: &webdav.Handler{
-			LockSystem: webdav.NewMemLS(),
-			FileSystem: webdav.Dir(uPath),
-			Logger: func(_ *http.Request, err error) {
-				// log.Print(r)
-				if err != nil {
-					log.Print(err)
-				}
-			},
-		},
-		fs: http.FileServer(http.Dir(uPath)),
-	})
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
 }
 
-func main() {
-	if version {
-		fmt.Println(build)
-		os.Exit(0)
+func readHTPasswd(passPath string) (map[string]string, error) {
+	p, err := os.Open(filepath.Clean(passPath))
+	if err != nil {
+		return nil, err
 	}
-	if genHtpass {
-		user, err := prompt("Username: ", false)
-		if err != nil {
-			log.Fatalln(err)
-		}
+	defer p.Close()
 
-		pass, err := prompt("Password: ", true)
-		if err != nil {
-			log.Fatalln(err)
+	ht := csv.NewReader(p)
+	ht.Comma = ':'
+	ht.Comment = '#'
+	ht.TrimLeadingSpace = true
+
+	entries, err := ht.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(entries))
+	for _, parts := range entries {
+		// htdigest files have also realm: user:realm:HA1
+		result[parts[0]] = strings.Join(parts[1:], ":")
+	}
+
+	return result, nil
+}
+
+// htpassPaths split comma-separated list of .htpasswd files given to
+// -htpass. The first file is the one new users are added to.
+func htpassPaths(spec string) []string {
+	var paths []string
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
 		}
+	}
+	return paths
+}
 
-		hash, err := bcrypt.GenerateFromPassword([]byte(pass), 11)
-		if err != nil {
-			log.Fatalln(err)
+// loadHTPasswd read and merge users from .htpasswd files; missing files are
+// skipped. When user is defined in more files, the first one wins.
+func loadHTPasswd(paths []string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, p := range paths {
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
 		}
 
-		f, err := os.OpenFile(filepath.Clean(passPath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		users, err := readHTPasswd(p)
 		if err != nil {
-			log.Fatalln(err)
+			return nil, fmt.Errorf("read %s error: %w", p, err)
 		}
 
-		if _, err := fmt.Fprintf(f, "%s:%s\n", user, hash); err != nil {
-			log.Fatalln(err)
+		for u, h := range users {
+			if _, ok := result[u]; ok {
+				log.Printf("user %q from %s already defined, ignored\n", u, p)
+				continue
+			}
+			result[u] = h
 		}
+		log.Printf("Loaded %d users from %s\n", len(users), p)
+	}
 
-		err = f.Close()
-		if err != nil {
-			log.Fatalln(err)
-		}
+	return result, nil
+}
 
-		fmt.Printf("Added %q to %q\n", user, passPath)
+// loadUsers read users from .htpasswd files and, when envPrefix is set, from
+// environment variables named <prefix><USERNAME> containing bcrypt hash.
+// Entries from environment override ones from file.
+func loadUsers() (map[string]string, error) {
+	result := make(map[string]string)
 
-		os.Exit(0)
+	fileUsers, err := loadHTPasswd(htpassPaths(passPath))
+	if err != nil {
+		return nil, err
 	}
-	pledges, _ = protect.ReducePledges(pledges, "tty")
 
-	// drop to only read on passPath
-	_ = protect.Unveil(passPath, "r")
-	pledges, _ = protect.ReducePledges(pledges, "unveil")
+	for u, h := range fileUsers {
+		result[u] = h
+	}
+
+	if envPrefix != "" {
+		envUsers := 0
+		for _, env := range os.Environ() {
+			name, hash, ok := strings.Cut(env, "=")
+			if !ok || !strings.HasPrefix(name, envPrefix) {
+				continue
+			}
+
+			user := strings.TrimPrefix(name, envPrefix)
+			if user == "" || hash == "" {
+				continue
+			}
+
+			result[user] = hash
+			envUsers++
+		}
+		log.Printf("Loaded %d users from environment (%s*)\n", envUsers, envPrefix)
+	}
 
-	_, fErr := os.Stat(passPath)
+	return result, nil
+}
+
+func logger(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := time.Now()
+
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		f(sw, r)
+		observeRequest(r.Method, sw.code)
+
+		accessLog.LogRequest(&requestEntry{
+			Time:          n,
+			Method:        r.Method,
+			Path:          logPath(r.URL),
+			Proto:         r.Proto,
+			Remote:        clientIP(r),
+			ContentLength: r.ContentLength,
+			Status:        sw.code,
+			Duration:      time.Since(n),
+			RequestID:     requestID(r.Context()),
+		})
+
+		if logRotator != nil {
+			logRotator.rotateIfNeeded()
+		}
+	}
+}
+
+// createEmpty create wiki from template, when path does not exist yet.
+// errCreateDisabled is returned with -no-create.
+func createEmpty(path, version string) error {
+	_, fErr := os.Stat(path)
 	if os.IsNotExist(fErr) {
-		if auth == "basic" || auth == "header" {
-			fmt.Println("No .htpasswd file found!")
-			os.Exit(1)
+		if noCreate {
+			return errCreateDisabled
 		}
-	} else {
-		p, err := os.Open(filepath.Clean(passPath))
-		if err != nil {
-			log.Fatal(err)
+		log.Printf("creating %q\n", path)
+		twData, _ := fs.ReadFile(twTemplates, templateFor(version))
+		wErr := os.WriteFile(path, twData, 0o600)
+		if wErr != nil {
+			return wErr
 		}
+	}
+	return nil
+}
 
-		ht := csv.NewReader(p)
-		ht.Comma = ':'
-		ht.Comment = '#'
-		ht.TrimLeadingSpace = true
+// deleteOldBackups remove backups of fileBase over the limit of files.
+func deleteOldBackups(fileBase string, keep int) {
+	matches, err := filepath.Glob(fileBase + "-*_*.html*")
+	if err != nil {
+		log.Printf("delete old backups error: %v\n", err)
+		return
+	}
 
-		entries, err := ht.ReadAll()
-		if err != nil {
-			log.Fatal(err)
+	files := matches[:0]
+	for _, fname := range matches {
+		if !strings.HasSuffix(fname, checksumExt) {
+			files = append(files, fname)
+		}
+	}
+
+	if len(files) <= keep {
+		return
+	}
+	sort.Strings(files)
+
+	toDel := files[:len(files)-keep]
+
+	if backupMode != backupModeFull {
+		// the oldest kept backup must not depend on deleted ones
+		if err := rebaseBackups(fileBase+".html", files[len(files)-keep]); err != nil {
+			log.Printf("delete old backups error: %v\n", err)
+			return
+		}
+	}
+
+	for _, fname := range toDel {
+		log.Printf("delete old backup: %s\n", fname)
+		os.Remove(fname)
+		os.Remove(fname + checksumExt)
+	}
+
+	if err := pruneManifest(filepath.Dir(fileBase)); err != nil && !os.IsNotExist(err) {
+		log.Printf("delete old backups error: %v\n", err)
+	}
+}
+
+var (
+	backupsAge   = make(map[string]time.Time)
+	backupsAgeMu sync.Mutex
+)
+
+// backupDue check if backup of path is not younger than minAge seconds and
+// remember time of the new backup.
+func backupDue(path string, now time.Time, minAge int) bool {
+	if minAge <= 0 {
+		return true
+	}
+
+	backupsAgeMu.Lock()
+	defer backupsAgeMu.Unlock()
+
+	if oldBackupTs, ok := backupsAge[path]; ok {
+		if now.Sub(oldBackupTs) < time.Duration(minAge)*time.Second {
+			return false
 		}
+	}
+
+	backupsAge[path] = now
 
-		err = p.Close()
+	return true
+}
+
+// forgetBackupAge make next backup of path not limited by -backup.age.
+func forgetBackupAge(path string) {
+	backupsAgeMu.Lock()
+	delete(backupsAge, path)
+	backupsAgeMu.Unlock()
+}
+
+// moveBackupAge keep -backup.age limit of renamed wiki.
+func moveBackupAge(src, dst string) {
+	backupsAgeMu.Lock()
+	defer backupsAgeMu.Unlock()
+
+	if ts, ok := backupsAge[src]; ok {
+		backupsAge[dst] = ts
+		delete(backupsAge, src)
+	}
+}
+
+// createBackup backup path when the last backup is old enough or force is
+// set.
+func createBackup(path, backupPath string, cfg backupConfig, force bool) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if force {
+		forgetBackupAge(path)
+	}
+	if !backupDue(path, now, cfg.MinAge) {
+		return nil
+	}
+
+	return writeBackup(path, backupPath, now, cfg)
+}
+
+// writeBackup copy path into new backup of backupPath created at now.
+func writeBackup(path, backupPath string, now time.Time, cfg backupConfig) error {
+	unlock := lockBackups(backupPath)
+	defer unlock()
+
+	ext := filepath.Ext(backupPath)
+	base := backupPath[0 : len(backupPath)-len(ext)]
+	dstFilename := base + "-" + now.Format(backupTimeFormat) + ext
+
+	if backupMode != backupModeFull {
+		ok, err := createDeltaBackup(path, backupPath, dstFilename+deltaExt+".gz")
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+
+		if ok {
+			deleteOldBackups(base, cfg.Files)
+			observeBackup(now)
+
+			return nil
+		}
+	}
+
+	if cfg.Compress {
+		dstFilename += ".gz"
+	}
+
+	backupDir, _ := filepath.Split(dstFilename)
+	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(backupDir, 0o700); err != nil {
+			return fmt.Errorf("create backup dir %s error: %w", backupDir, err)
 		}
+	}
+
+	log.Printf("backup %s -> %s\n", path, dstFilename)
+
+	source, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s for backup error: %w", path, err)
+	}
+	defer source.Close()
+
+	file, err := os.Create(dstFilename)
+	if err != nil {
+		return fmt.Errorf("create backup file %s error: %w", dstFilename, err)
+	}
+	defer file.Close()
 
-		for _, parts := range entries {
-			users[parts[0]] = parts[1]
+	var destination io.WriteCloser = file
+	if cfg.Compress {
+		destination, err = gzip.NewWriterLevel(file, gzip.BestCompression)
+		if err != nil {
+			return fmt.Errorf("create gzip writer error: %w", err)
 		}
 	}
 
-	if auth == "basic" || auth == "header" {
-		for u := range users {
-			uPath := path.Join(davDir, u)
-			addHandler(u, uPath)
+	// hash of source is compared with content of written backup
+	h := sha256.New()
+	_, err = io.Copy(destination, io.TeeReader(source, h))
+	if err == nil && cfg.Compress {
+		err = destination.Close()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		os.Remove(dstFilename)
+		return fmt.Errorf("create backup file error: %w", err)
+	}
+
+	if err := checkBackup(dstFilename, hex.EncodeToString(h.Sum(nil))); err != nil {
+		return fmt.Errorf("verify backup error: %w", err)
+	}
+
+	deleteOldBackups(base, cfg.Files)
+	observeBackup(now)
+
+	return nil
+}
+
+func prompt(prompt string, secure bool) (string, error) {
+	var input string
+	fmt.Print(prompt)
+
+	if secure {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return "", err
 		}
+		input = string(b)
 	} else {
-		addHandler("", davDir)
+		_, err := fmt.Scanln(&input)
+		if err != nil {
+			return "", err
+		}
 	}
+	return input, nil
+}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", logger(func(w http.ResponseWriter, r *http.Request) {
+func addHandler(handlers *userHandlers, u, uPath string) *userHandler {
+	h := &userHandler{
+		name:  u,
+		cache: sharedCache,
+	}
+	h.setDir(uPath)
+	if userMaxConcurrent > 0 {
+		h.slots = make(chan struct{}, userMaxConcurrent)
+	}
+	handlers.list = append(handlers.list, h)
+
+	return h
+}
+
+// setDir make handler serve files from uPath. Caller must hold h.mu for
+// handlers already in use.
+func (h *userHandler) setDir(uPath string) {
+	if h.dir == uPath {
+		return
+	}
+
+	h.dir = uPath
+	h.dav, h.fs = nil, nil
+}
+
+// initServers create WebDAV handler and file server of h on its first
+// request, so users who never log in cost only their entry in the list.
+// prefix is path of handler directory as seen by clients. Caller must hold
+// h.mu.
+func (h *userHandler) initServers(prefix string) {
+	if h.dav != nil {
+		return
+	}
+
+	h.dav = &webdav.Handler{
+		Prefix:     prefix,
+		LockSystem: newLockSystem(h.dir),
+		FileSystem: webdav.Dir(h.dir),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logf(r.Context(), "%s %s error: %v\n", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	h.fs = http.FileServer(http.Dir(h.dir))
+}
+
+// wikiHandler return main handler serving wikis of virtual host.
+func wikiHandler(v *vhost) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		user, pass := "", ""
 		var ok bool
 
-		if strings.Contains(r.URL.Path, ".htpasswd") {
+		if strings.Contains(r.URL.Path, ".htpasswd") || strings.Contains(r.URL.Path, ".journal") {
 			http.NotFound(w, r)
 			return
 		}
@@ -411,14 +1149,37 @@ func main() {
 			return
 		}
 
-		if auth == "basic" {
-			user, pass, ok = r.BasicAuth()
-			if !ok || !authenticate(user, pass) {
-				w.Header().Set("WWW-Authenticate", `Basic realm="widdler"`)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if isWriteMethod(r.Method) && !diskHealthy.Load() {
+			// storage is failing; reads are still served
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		if v.auth == "basic" {
+			if authSession {
+				user, pass, ok = v.sessionCredentials(r)
+			}
+
+			if !ok {
+				user, pass, ok = r.BasicAuth()
+				if !ok || !v.authenticate(user, pass, r.Header.Get(totpHeader)) {
+					w.Header().Set("WWW-Authenticate", `Basic realm="widdler"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+				if authSession && wantsSession(r) {
+					createSession(w, r, user)
+				}
+			}
+		} else if v.auth == "digest" {
+			var stale bool
+			user, ok, stale = v.authenticateDigest(r)
+			if !ok {
+				digestChallenge(w, stale)
 				return
 			}
-		} else if auth == "header" {
+		} else if v.auth == "header" {
 			prefix := "Auth"
 			for name, values := range r.Header {
 				if strings.HasPrefix(name, prefix) {
@@ -429,42 +1190,143 @@ func main() {
 				}
 			}
 
-			if !ok || !authenticate(user, pass) {
+			if !ok || !v.authenticate(user, pass, r.Header.Get(totpHeader)) {
 				w.Header().Set("WWW-Authenticate", `Basic realm="widdler"`)
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
+		} else if v.auth == "webhook" {
+			user, pass, ok = r.BasicAuth()
+			if !ok || !validUserName(user) || !webhookAuthenticate(r.Context(), user, pass, clientIP(r)) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="widdler"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if v.auth == "oidc" {
+			user, ok = oidcUser(r)
+			if ok && v.userCount() > 0 {
+				_, ok = v.lookupUser(user)
+			}
+
+			if !ok {
+				if r.Method == http.MethodGet {
+					http.Redirect(w, r, prefixed("/auth/login"), http.StatusFound)
+					return
+				}
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if v.auth == "mtls" {
+			user, ok = certUser(r)
+			if ok && v.userCount() > 0 {
+				// .htpasswd, when present, limit allowed users
+				_, ok = v.lookupUser(user)
+			}
+
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if isStaticRequest(r) {
+			staticHandler(w, r)
+			return
+		}
+
+		// wikis under /shared/ are served from -shared.dir by a handler
+		// common for all users
+		site, owner, reqPath := v, user, r.URL.Path
+		if shared, ok := sharedRequest(v, r); ok {
+			if !sharedAllowed(user) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			r = shared
+			site, owner = sharedSite, ""
+		}
+
+		site.handlers.mu.RLock()
+		handler := site.handlers.find(owner)
+		site.handlers.mu.RUnlock()
+
+		if handler == nil && site == v && (v.auth == "mtls" || v.auth == "oidc" || v.auth == "webhook") {
+			// users verified by certificate or identity provider get own
+			// directory; .htpasswd, when present, was already checked
+			handler = v.handlers.findOrAdd(user, v.userDir(user))
+		}
+
+		if handler == nil && site == v {
+			handler = v.globHandler(owner)
 		}
 
-		handlers.mu.RLock()
-		handler := handlers.find(user)
-		handlers.mu.RUnlock()
+		if handler == nil && site == v {
+			handler = v.autoCreateHandler(owner)
+		}
 
 		if handler == nil {
 			http.NotFound(w, r)
 			return
 		}
 
+		if !handler.acquire() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		defer handler.release()
+
 		handler.mu.Lock()
 
 		defer handler.mu.Unlock()
 
-		userPath := path.Join(davDir, user)
-		fullPath := path.Join(davDir, user, r.URL.Path)
+		handler.initServers(davPrefix(site))
+
+		userPath := site.userDir(owner)
+		if userPath == "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		fullPath := path.Join(userPath, r.URL.Path)
 		fullPath = filepath.Clean(fullPath)
 		if !strings.HasPrefix(fullPath, userPath) {
 			http.Error(w, "Bad request", http.StatusBadRequest)
 			return
 		}
-		log.Printf("Resolved file: %s", fullPath)
+		logf(r.Context(), "Resolved file: %s", fullPath)
+
+		if err := createUserDir(userPath); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		_, dErr := os.Stat(userPath)
-		if os.IsNotExist(dErr) {
-			mErr := os.Mkdir(userPath, 0o700)
-			if mErr != nil {
-				http.Error(w, mErr.Error(), http.StatusInternalServerError)
+		if userAccessLog {
+			cw := &countingWriter{ResponseWriter: w}
+			defer handler.logUserAccess(userPath, user, r, cw, time.Now())
+			w = cw
+		}
+
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			if !isAdmin(user) || site == sharedSite {
+				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
+			serveAdmin(w, r, &apiRequest{site: site, user: user, pass: pass, handler: handler, userPath: userPath})
+			return
+		}
+
+		if r.URL.Path == searchPath {
+			serveSearch(w, r, &apiRequest{site: site, user: user, pass: pass, handler: handler, userPath: userPath})
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			if !apiEnabled {
+				http.NotFound(w, r)
+				return
+			}
+			serveAPI(w, r, &apiRequest{site: site, user: user, pass: pass, handler: handler, userPath: userPath})
+			return
 		}
 
 		isHTML, err := regexp.Match(`\.html$`, []byte(r.URL.Path))
@@ -474,71 +1336,537 @@ func main() {
 		}
 
 		if isHTML {
+			if code := checkWikiAccess(r, v.auth, user, pass, fullPath); code != 0 {
+				wikiAccessError(w, code)
+				return
+			}
+
+			if isCopyMove(r) {
+				dest, code := davDestination(r, site == sharedSite)
+				if code != 0 {
+					http.Error(w, http.StatusText(code), code)
+					return
+				}
+
+				destPath := filepath.Join(userPath, filepath.FromSlash(dest))
+				if code := checkWikiAccess(r, v.auth, user, pass, destPath); code != 0 {
+					wikiAccessError(w, code)
+					return
+				}
+				if isReadOnly(destPath) {
+					http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				r = withDestination(r, handler.dav.Prefix+dest)
+			}
+
+			if isReadOnly(fullPath) {
+				if isWriteMethod(r.Method) {
+					http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+					return
+				}
+
+				if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+					// read-only mode does not create new wikis
+					http.NotFound(w, r)
+					return
+				}
+			}
+
+			if auditLog != nil && auditMethods[r.Method] {
+				aw, done := auditRequest(w, r, user, reqPath)
+				defer done()
+				w = aw
+			}
+
+			if r.Method == http.MethodDelete {
+				deleteWiki(w, r, &apiRequest{site: site, user: user, pass: pass, handler: handler, userPath: userPath},
+					fullPath, wikiBackupPath(site, user, r.URL.Path))
+				return
+			}
+
 			// HTML files will be created or sent back
-			err := createEmpty(fullPath)
+			err := createEmpty(fullPath, r.URL.Query().Get("tw"))
+			if errors.Is(err, errCreateDisabled) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
 			if err != nil {
-				log.Println(err)
+				logf(r.Context(), "%v\n", err)
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if r.Method == "PUT" {
+				if limit := userMaxSize(userPath); limit > 0 {
+					if r.ContentLength > limit {
+						http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+						return
+					}
+
+					// length may be unknown (chunked body)
+					body := newMaxSizeBody(r.Body, limit, errWikiTooLarge)
+					r.Body = body
+					w = &maxSizeWriter{ResponseWriter: w, body: body}
+				}
+
+				left, limited, err := handler.quotaLeft(userPath, fullPath)
+				if err != nil {
+					logf(r.Context(), "%v\n", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if limited && r.ContentLength > left {
+					http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+					return
+				}
+				if limited && r.ContentLength < 0 {
+					// bytes of chunked body are counted while it is read
+					body := newMaxSizeBody(r.Body, left, errQuotaExceeded)
+					r.Body = body
+					w = &maxSizeWriter{ResponseWriter: w, body: body}
+				}
+
+				if strictHTML {
+					ok, err := checkHTMLBody(r)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					if !ok {
+						http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+						return
+					}
+				}
+
+				if validatePut {
+					cleanup, err := validatePutBody(r, filepath.Dir(fullPath))
+					var checkErr *putCheckError
+					switch {
+					case errors.As(err, &checkErr):
+						writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+							"error": checkErr.msg,
+							"check": checkErr.check,
+						})
+						return
+					case errors.Is(err, errWikiTooLarge):
+						http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+						return
+					case errors.Is(err, errQuotaExceeded):
+						http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+						return
+					case err != nil:
+						logf(r.Context(), "%v\n", err)
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					defer cleanup()
+				}
+				defer handler.invalidateUsage()
+
+				removeGzipFile(fullPath)
+
+				w = &warningWriter{ResponseWriter: w, userPath: userPath, fullPath: fullPath}
+
+				if fromSaver(r) {
+					w = &saverWriter{ResponseWriter: w}
+				}
+			}
 			if r.Method == "PUT" && backupsEnabled {
-				bDir := path.Join(davDir, user, backupDir)
-				if err := createBackup(fullPath, filepath.Clean(path.Join(bDir, r.URL.Path))); err != nil {
-					log.Println(err)
+				finish, err := queueBackup(fullPath, wikiBackupPath(site, user, r.URL.Path))
+				if err != nil {
+					logf(r.Context(), "%v\n", err)
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
 				}
+
+				pw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+				defer func() {
+					finish(pw.code < http.StatusMultipleChoices)
+				}()
+				w = pw
+			}
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				if limit := userMaxSize(userPath); limit > 0 {
+					if fi, err := os.Stat(fullPath); err == nil && fi.Size() > limit {
+						logf(r.Context(), "%s size %s exceeds limit %s\n", fullPath, formatSize(fi.Size()), formatSize(limit))
+						http.Error(w, "Wiki Too Large", http.StatusInternalServerError)
+						return
+					}
+				}
+
+				w.Header().Add("Vary", "Accept-Encoding")
+
+				sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+				defer func() {
+					if sw.code < http.StatusMultipleChoices {
+						recordAccess(fullPath)
+					}
+				}()
+				w = sw
+
+				if apiEnabled {
+					w = &linkWriter{ResponseWriter: w, links: wikiLinks(site, r.URL.Path)}
+				}
+			}
+			w = withPush(w, r)
+			if enc := responseEncoding(r); enc != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				if enc == "gzip" && serveGzipFile(w, r, fullPath) {
+					return
+				}
+
+				if fi, err := os.Stat(fullPath); err == nil && fi.Size() >= int64(compressMinSize) {
+					if enc == "gzip" && backupsEnabled && backupCompress &&
+						servePrecompressed(w, r, fullPath, wikiBackupPath(site, user, r.URL.Path), fi) {
+						return
+					}
+
+					// compressed response can not be served partially
+					r.Header.Del("Range")
+
+					if handler.cache != nil && compressBrotli {
+						serveCached(w, r, handler.cache, fullPath, enc)
+						return
+					}
+
+					cw := &compressWriter{ResponseWriter: w, encoding: enc}
+					defer cw.Close()
+					w = cw
+				}
 			}
-			handler.dav.ServeHTTP(w, r)
+			if handler.cache != nil {
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					serveCached(w, r, handler.cache, fullPath, "")
+					return
+				}
+
+				if isWriteMethod(r.Method) {
+					defer handler.cache.invalidate(fullPath)
+				}
+			}
+			limitDepth(handler.dav).ServeHTTP(w, davRequest(r, handler.dav.Prefix))
+		} else if r.Method == "PROPFIND" {
+			// WebDAV listing of directories, limited by -dav.max-depth
+			limitDepth(handler.dav).ServeHTTP(w, davRequest(r, handler.dav.Prefix))
 		} else {
 			// Everything else is browsable
 			entries, err := os.ReadDir(userPath)
 			if err != nil {
-				log.Println(err)
+				logf(r.Context(), "%v\n", err)
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			if len(entries) > 0 {
-				if r.URL.Path == "/" {
-					// If we have entries, and are serving up /, check for
-					// index.html and redirect to that if it exists. We redirect
-					// because net/http handles index.html magically for FileServer
-					_, fErr := os.Stat(filepath.Clean(path.Join(userPath, "index.html")))
-					if !os.IsNotExist(fErr) {
-						http.Redirect(w, r, "/index.html", http.StatusMovedPermanently)
-						return
-					}
+			if len(entries) > 0 && r.URL.Path == "/" {
+				// If we have entries, and are serving up /, check for
+				// index.html and redirect to that if it exists. We redirect
+				// because net/http handles index.html magically for FileServer
+				_, fErr := os.Stat(filepath.Clean(path.Join(userPath, "index.html")))
+				if !os.IsNotExist(fErr) {
+					http.Redirect(w, r, prefixed("/index.html"), http.StatusMovedPermanently)
+					return
 				}
+			}
+
+			if len(entries) > 0 && r.URL.Path != "/" {
 				handler.fs.ServeHTTP(w, r)
 			} else {
 				l := Landing{
-					URL: fmt.Sprintf("%s/wiki.html", fullListen),
+					URL:       fmt.Sprintf("%s/wiki.html", fullListen),
+					Versions:  twVersions,
+					Theme:     theme,
+					CustomCSS: customCSS,
+					NoCreate:  noCreate,
+					Prefix:    urlPrefix,
 				}
 				if user != "" {
 					l.User = user
 				}
-				err = templ.ExecuteTemplate(w, "landing", l)
+
+				prefix := ""
+				if site == sharedSite {
+					prefix = sharedPrefix
+				}
+				l.URL = fmt.Sprintf("%s/%swiki.html", fullListen, prefix)
+
+				wikis, err := listUserWikis(userPath)
+				if err != nil {
+					logf(r.Context(), "%v\n", err)
+				}
+				for _, wi := range wikis {
+					l.Wikis = append(l.Wikis, prefix+wi.Name)
+				}
+
+				if site != sharedSite && sharedSite != nil && v == defaultVhost && sharedAllowed(user) {
+					l.Wikis = append(l.Wikis, sharedWikis()...)
+				}
+
+				err = templ.Load().ExecuteTemplate(w, "landing", l)
 				if err != nil {
-					log.Println(err)
+					logf(r.Context(), "%v\n", err)
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 				}
 			}
 		}
-	}))
+	}
+}
 
-	s := http.Server{
-		Handler:           mux,
-		ReadHeaderTimeout: 0,
+func main() {
+	parseFlags()
+
+	if version {
+		fmt.Println(build)
+		os.Exit(0)
 	}
+	if genHtpass {
+		user, err := prompt("Username: ", false)
+		if err != nil {
+			log.Fatalln(err)
+		}
 
-	lis, err := net.Listen("tcp", listen)
-	if err != nil {
+		pass, err := prompt("Password: ", true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(pass), genCost)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		passFile := htpassPaths(passPath)[0]
+		f, err := os.OpenFile(filepath.Clean(passFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if _, err := fmt.Fprintf(f, "%s:%s\n", user, hash); err != nil {
+			log.Fatalln(err)
+		}
+
+		err = f.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Printf("Added %q to %q\n", user, passFile)
+
+		os.Exit(0)
+	}
+	if genInvite {
+		token, err := addInvite(inviteTokens)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Printf("Added invite %q to %q\n", token, inviteTokens)
+
+		os.Exit(0)
+	}
+	if checkHTPass {
+		problems := 0
+		for _, p := range htpassPaths(passPath) {
+			n, err := checkHTPassFile(os.Stdout, p, fixHTPass)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			problems += n
+		}
+		if problems > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if migrateCmd {
+		if err := migrateWikis(os.Stdout, davDir, migrateToUser, dryRun); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+	if dryRun {
+		os.Exit(runDryRun(os.Stdout))
+	}
+	if extractWiki != "" {
+		n, err := extractTiddlers(extractWiki, extractDir, extractFormat)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("Extracted %d tiddlers to %q\n", n, extractDir)
+		os.Exit(0)
+	}
+	if listCmd {
+		if err := printWikis(os.Stdout, davDir, listFormat); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+
+	if rebuildManifestCmd {
+		if err := rebuildManifests(backupsRoot()); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+	pledges, _ = protect.ReducePledges(pledges, "tty")
+
+	if inviteTokens == "" {
+		// drop to only read on passPath
+		for _, p := range htpassPaths(passPath) {
+			_ = protect.Unveil(p, "r")
+		}
+	}
+	pledges, _ = protect.ReducePledges(pledges, "unveil")
+
+	var err error
+	defaultVhost = &vhost{davDir: davDir, passPath: passPath, auth: auth}
+	if err := defaultVhost.loadUsers(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if defaultVhost.userCount() == 0 && (auth == "basic" || auth == "header" || auth == "digest") {
+		fmt.Println("No .htpasswd file found!")
+		os.Exit(1)
+	}
+
+	if totpPath != "" {
+		totp, err = loadTOTPSecrets(totpPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("TOTP enabled for %d users\n", len(totp.secrets))
+	}
+
+	defaultVhost.setup()
+	setupShared()
+	loadTemplateURL(twTemplateURL, twTemplateCache)
+	if twAutoUpdate {
+		if err := updateTemplate(twUpdateURL, twEmptyFile); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if landingTemplate != "" {
+		go reloadLandingOnSignal(landingTemplate)
+	}
+
+	if userMapPath != "" {
+		go reloadUserMapOnSignal(userMapPath)
+	}
+
+	for _, v := range vhosts {
+		if err := v.loadUsers(); err != nil {
+			log.Fatalln(err)
+		}
+		v.setup()
+		log.Printf("Vhost %s: wikis directory: %s, auth: %s\n", v.name, v.davDir, v.auth)
+	}
+
+	if htpassWatch {
+		for _, v := range allVhosts() {
+			if v.passPath != "" {
+				go v.watchUsers(htpassWatchInterval)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	if metricsEnabled {
+		registerMetrics(mux)
+	}
+	if auth == "oidc" {
+		oidcProvider, err = newOIDCAuth(context.Background())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		oidcProvider.register(mux)
+	} else if authSession {
+		mux.HandleFunc(logoutPath, logger(logoutHandler))
+	}
+	if authSecret == "" {
+		// sessions and share links are kept in memory, so they do not
+		// survive restart anyway
+		authSecret = randomToken(32)
+	}
+	mux.HandleFunc(sharePrefix, logger(rateLimit(shareHandler)))
+
+	// health checks are registered before catch-all handler, so they never
+	// require authentication
+	mux.HandleFunc("/healthz", healthHandler)
+	mux.HandleFunc("/readyz", readyHandler)
+	registerDebug(mux)
+	if inviteTokens != "" {
+		mux.HandleFunc(registerPath, logger(rateLimit(registerHandler)))
+	}
+	if staticDir != "" && staticPublic {
+		// public assets do not require authentication
+		mux.HandleFunc(staticPrefix, logger(rateLimit(staticHandler)))
+	}
+	mux.HandleFunc("/", logger(rateLimit(func(w http.ResponseWriter, r *http.Request) {
+		vhostFor(r).handler(w, r)
+	})))
+
+	if err := startTelemetry(); err != nil {
 		log.Fatalln(err)
 	}
 
-	if tlsCert != "" && tlsKey != "" {
-		fullListen = fmt.Sprintf("https://%s", listen)
+	if limiter != nil {
+		go limiter.pruneLoop()
+	}
+
+	if backupsEnabled {
+		go pruneManifests(backupsRoot())
+	}
+
+	if backupsEnabled && backupWorkers > 0 {
+		startBackupWorkers(backupWorkers, backupQueueSize)
+	}
+
+	if diskCheckInterval > 0 && !readOnly {
+		go diskCheckLoop(diskCheckInterval)
+	}
+
+	if cleanupInactive > 0 {
+		go inactiveLoop(time.Duration(cleanupInactive))
+	}
+
+	s := http.Server{
+		Handler: withMaxBody(withTracing(withErrorReporting(withTimeouts(withRequestID(withClientIP(ipFilter(withCORS(withSecurityHeaders(withPrefix(mux)))))))))),
+		// ReadHeaderTimeout protects against clients sending headers very
+		// slowly (Slowloris). ReadTimeout covers the whole request including
+		// body, so it is disabled by default: saving a large wiki over a slow
+		// link could take longer than any fixed limit. The trade-off is that
+		// a client can hold a connection by sending body slowly.
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+	}
+
+	setupKeepAlive(&s)
+
+	if acmeEnabled() {
+		listen = acmeListen(listen)
+	}
+
+	addrs := listenAddrs(listen)
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		lis, err := openListener(addr)
+		if err != nil {
+			removeSockets(addrs)
+			log.Fatalln(err)
+		}
+		if proxyProtocol {
+			lis = &proxyListener{Listener: lis, strict: proxyProtocolStrict}
+		}
+		listeners = append(listeners, lis)
+	}
+
+	done := make(chan int, 1)
+	go shutdownOnSignal(&s, shutdownTimeout, done)
+
+	useTLS := tlsCert != "" && tlsKey != "" || acmeEnabled()
+	certFile, keyFile := tlsCert, tlsKey
+	if useTLS {
+		fullListen = fmt.Sprintf("https://%s%s", publicAddr(addrs), urlPrefix)
 
 		s.TLSConfig = &tls.Config{
 			MinVersion:               tls.VersionTLS12,
@@ -546,12 +1874,78 @@ func main() {
 			PreferServerCipherSuites: true,
 		}
 
-		log.Printf("Listening for HTTPS on 'https://%s'", listen)
-		log.Fatalln(s.ServeTLS(lis, tlsCert, tlsKey))
+		if tlsWatch && !acmeEnabled() {
+			reloader, err := newCertReloader(tlsCert, tlsKey)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			s.TLSConfig.GetCertificate = reloader.GetCertificate
+			go reloader.watch(tlsWatchInterval)
+
+			// certificate is served by GetCertificate
+			certFile, keyFile = "", ""
+		}
+
+		if httpsRedirect {
+			s.Handler = withHSTS(s.Handler)
+		}
+
+		if acmeEnabled() {
+			m := newACMEManager()
+			s.TLSConfig.GetCertificate = m.GetCertificate
+			s.TLSConfig.NextProtos = acmeProtos
+			go serveACMEChallenge(m)
+		}
+
+		// challenge listener of ACME already redirects to HTTPS
+		if httpsRedirect && !(acmeEnabled() && httpsRedirectPort == tlsACMEHTTPPort) {
+			go serveHTTPSRedirect(publicAddr(addrs))
+		}
+
+		if auth == "mtls" {
+			pool, err := loadClientCAs(tlsCA)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			s.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			s.TLSConfig.ClientCAs = pool
+		}
+	} else {
+		fullListen = fmt.Sprintf("http://%s%s", publicAddr(addrs), urlPrefix)
+
+		if http2Push {
+			log.Println("-http2.push requires TLS, HTTP/2 is not available")
+		}
+		if httpsRedirect {
+			log.Println("-https.redirect requires TLS, ignored")
+		}
 	}
 
-	fullListen = fmt.Sprintf("http://%s", listen)
+	// every listener is served in own goroutine; failure of any of them
+	// stops the server
+	errs := make(chan error, len(listeners))
+	for i, lis := range listeners {
+		go func(addr string, lis net.Listener) {
+			if useTLS {
+				log.Printf("Listening for HTTPS on '%s'", addr)
+				errs <- s.ServeTLS(lis, certFile, keyFile)
+			} else {
+				log.Printf("Listening for HTTP on '%s'", addr)
+				errs <- s.Serve(lis)
+			}
+		}(addrs[i], lis)
+	}
+
+	for range listeners {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			removeSockets(addrs)
+			log.Fatalln(err)
+		}
+	}
 
-	log.Printf("Listening for HTTP on 'http://%s'", listen)
-	log.Fatalln(s.Serve(lis))
+	code := <-done
+	removeSockets(addrs)
+	flushTelemetry()
+	stopService(code)
+	os.Exit(code)
 }
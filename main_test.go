@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testHash(t *testing.T, pass string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestDeleteOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"a-20240101_100000.html",
+		"a-20240102_100000.html",
+		"a-20240103_100000.html.gz",
+		"a-20240104_100000.html",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleteOldBackups(filepath.Join(dir, "a"), 2)
+
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != (i >= 2) {
+			t.Errorf("%s kept: %v, want %v", name, kept, i >= 2)
+		}
+	}
+}
+
+func TestLoadUsersFromEnv(t *testing.T) {
+	defer func(p, e string) { passPath, envPrefix = p, e }(passPath, envPrefix)
+
+	passPath = filepath.Join(t.TempDir(), ".htpasswd")
+	data := "alice:" + testHash(t, "file") + "\nbob:" + testHash(t, "bob") + "\n"
+	if err := os.WriteFile(passPath, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	envPrefix = "WIDDLER_TEST_USER_"
+	t.Setenv(envPrefix+"alice", testHash(t, "env"))
+	t.Setenv(envPrefix+"carol", testHash(t, "carol"))
+
+	users, err := loadUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vhost{users: users}
+
+	tests := []struct {
+		user, pass string
+		want       bool
+	}{
+		// environment wins on conflict
+		{"alice", "env", true},
+		{"alice", "file", false},
+		{"bob", "bob", true},
+		{"carol", "carol", true},
+		{"dave", "dave", false},
+	}
+
+	for _, tt := range tests {
+		if got := v.authenticate(tt.user, tt.pass, ""); got != tt.want {
+			t.Errorf("authenticate(%q, %q) = %v, want %v", tt.user, tt.pass, got, tt.want)
+		}
+	}
+}
+
+func TestUserMaxConcurrent(t *testing.T) {
+	defer func(n int) { userMaxConcurrent = n }(userMaxConcurrent)
+	userMaxConcurrent = 1
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "a.html")
+	v := &vhost{davDir: dir}
+	handler := addHandler(&v.handlers, "", dir)
+	h := wikiHandler(v)
+
+	get := func() int {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/a.html", nil))
+		return rec.Code
+	}
+
+	// first request waits for user lock
+	handler.mu.Lock()
+	first := make(chan int, 1)
+	go func() { first <- get() }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(handler.slots) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first request did not take slot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/a.html", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request over limit: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header missing")
+	}
+
+	handler.mu.Unlock()
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first request: status %d, want %d", code, http.StatusOK)
+	}
+
+	if code := get(); code != http.StatusOK {
+		t.Errorf("request after slot was released: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLoadHTPasswd(t *testing.T) {
+	dir := t.TempDir()
+	admins := filepath.Join(dir, "admins")
+	editors := filepath.Join(dir, "editors")
+	writeFile := func(p, data string) {
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(admins, "alice:admin-hash\n")
+	writeFile(editors, "# editors\nalice:editor-hash\nbob:bob-hash\n")
+
+	paths := htpassPaths(admins + ", " + filepath.Join(dir, "missing") + "," + editors + ",")
+	if len(paths) != 3 {
+		t.Fatalf("htpassPaths returned %q", paths)
+	}
+
+	users, err := loadHTPasswd(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first file wins
+	want := map[string]string{"alice": "admin-hash", "bob": "bob-hash"}
+	if len(users) != len(want) {
+		t.Errorf("users %v, want %v", users, want)
+	}
+	for u, h := range want {
+		if users[u] != h {
+			t.Errorf("user %s hash %q, want %q", u, users[u], h)
+		}
+	}
+
+	writeFile(editors, "bob:a:b:c\n\"bad")
+	if _, err := loadHTPasswd(paths); err == nil {
+		t.Error("invalid file loaded")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestName is file in each backup directory listing its backups, one
+// JSON object per line.
+const manifestName = ".manifest.json"
+
+var (
+	rebuildManifestCmd bool
+
+	manifestMu sync.Mutex
+	// backupFileRe match names of backups of any wiki.
+	backupFileRe = regexp.MustCompile(`^.+-(\d{8}_\d{6})\.html(\.delta)?(\.gz)?$`)
+)
+
+type manifestEntry struct {
+	File       string    `json:"file"`
+	Timestamp  time.Time `json:"timestamp"`
+	Size       int64     `json:"size_bytes"`
+	Compressed bool      `json:"compressed"`
+	SHA256     string    `json:"sha256"`
+}
+
+// newManifestEntry describe backup file fname with content hash sum.
+func newManifestEntry(fname, sum string) (manifestEntry, error) {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	e := manifestEntry{
+		File:       filepath.Base(fname),
+		Timestamp:  fi.ModTime(),
+		Size:       fi.Size(),
+		Compressed: filepath.Ext(fname) == ".gz",
+		SHA256:     sum,
+	}
+
+	if m := backupFileRe.FindStringSubmatch(e.File); m != nil {
+		if t, err := time.ParseInLocation(backupTimeFormat, m[1], time.Local); err == nil {
+			e.Timestamp = t
+		}
+	}
+
+	return e, nil
+}
+
+// readManifest return entries of manifest in dir; later entries for the same
+// file replace earlier ones.
+func readManifest(dir string) ([]manifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	index := make(map[string]int)
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var e manifestEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.File == "" {
+			continue
+		}
+
+		if i, ok := index[e.File]; ok {
+			entries[i] = e
+			continue
+		}
+		index[e.File] = len(entries)
+		entries = append(entries, e)
+	}
+
+	return entries, sc.Err()
+}
+
+func writeManifest(dir string, entries []manifestEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	fname := filepath.Join(dir, manifestName)
+	tmp := fname + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("write manifest %s error: %w", fname, err)
+	}
+
+	return os.Rename(tmp, fname)
+}
+
+// appendManifest add record of backup fname to manifest of its directory.
+// Manifest missing in directory with older backups is rebuilt first.
+func appendManifest(fname, sum string) error {
+	dir := filepath.Dir(fname)
+
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); os.IsNotExist(err) {
+		return rebuildManifestLocked(dir)
+	}
+
+	e, err := newManifestEntry(fname, sum)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, manifestName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open manifest error: %w", err)
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write manifest error: %w", err)
+	}
+
+	return f.Close()
+}
+
+// recordBackup store checksum of new backup and add it to the manifest.
+func recordBackup(fname, sum string) error {
+	if err := writeChecksum(fname, sum); err != nil {
+		return err
+	}
+
+	if err := appendManifest(fname, sum); err != nil {
+		log.Printf("update manifest of %s error: %v\n", fname, err)
+	}
+
+	return nil
+}
+
+// rebuildManifest regenerate manifest of dir from backups found on disk.
+func rebuildManifest(dir string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	return rebuildManifestLocked(dir)
+}
+
+func rebuildManifestLocked(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var entries []manifestEntry
+	for _, f := range files {
+		if f.IsDir() || !backupFileRe.MatchString(f.Name()) {
+			continue
+		}
+
+		fname := filepath.Join(dir, f.Name())
+		sum, _, err := readChecksum(fname)
+		if err != nil {
+			if sum, err = backupHash(fname); err != nil {
+				log.Printf("rebuild manifest: %v\n", err)
+				continue
+			}
+		}
+
+		e, err := newManifestEntry(fname, sum)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File < entries[j].File
+	})
+
+	return writeManifest(dir, entries)
+}
+
+// pruneManifest drop entries of backups missing on disk, e.g. deleted
+// manually or by rotation.
+func pruneManifest(dir string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	entries, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(dir, e.File)); err == nil {
+			kept = append(kept, e)
+		}
+	}
+
+	if len(kept) == len(entries) {
+		return nil
+	}
+
+	return writeManifest(dir, kept)
+}
+
+// backupDirs return directories under root containing backups or manifest.
+func backupDirs(root string) ([]string, error) {
+	seen := make(map[string]bool)
+	var dirs []string
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+
+		if d.Name() == manifestName || backupFileRe.MatchString(d.Name()) {
+			dir := filepath.Dir(p)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+
+		return nil
+	})
+
+	return dirs, err
+}
+
+// backupsRoot return directory containing all backup directories.
+func backupsRoot() string {
+	if filepath.IsAbs(backupDir) {
+		return backupDir
+	}
+	return davDir
+}
+
+// rebuildManifests regenerate manifests of all backup directories under
+// root.
+func rebuildManifests(root string) error {
+	dirs, err := backupDirs(root)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if err := rebuildManifest(dir); err != nil {
+			return fmt.Errorf("rebuild manifest of %s error: %w", dir, err)
+		}
+		log.Printf("Rebuilt manifest of %s\n", dir)
+	}
+
+	return nil
+}
+
+// pruneManifests remove entries of missing backups from all manifests under
+// root.
+func pruneManifests(root string) {
+	dirs, err := backupDirs(root)
+	if err != nil {
+		log.Printf("prune manifests error: %v\n", err)
+		return
+	}
+
+	for _, dir := range dirs {
+		if err := pruneManifest(dir); err != nil && !os.IsNotExist(err) {
+			log.Printf("prune manifest of %s error: %v\n", dir, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	wikiMaxSize = byteSize(100 * 1000 * 1000)
+	httpMaxBody = byteSize(200 * 1000 * 1000)
+
+	errWikiTooLarge = errors.New("wiki too large")
+	errBodyTooLarge = errors.New("request body too large")
+)
+
+// userMaxSize return maximum size of wiki of user; .maxsize file in user
+// directory overrides global -wiki.max-size value.
+func userMaxSize(userPath string) int64 {
+	return userSizeSetting(userPath, ".maxsize", int64(wikiMaxSize))
+}
+
+// maxSizeBody fail reading of request body longer than limit.
+type maxSizeBody struct {
+	io.Closer
+	r        io.Reader
+	n, limit int64
+	err      error
+	exceeded bool
+}
+
+// newMaxSizeBody return body failing with err after limit bytes.
+func newMaxSizeBody(body io.ReadCloser, limit int64, err error) *maxSizeBody {
+	return &maxSizeBody{Closer: body, r: io.LimitReader(body, limit+1), limit: limit, err: err}
+}
+
+func (b *maxSizeBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+
+	var maxErr *http.MaxBytesError
+	if b.n > b.limit || errors.As(err, &maxErr) {
+		b.exceeded = true
+		return 0, b.err
+	}
+	return n, err
+}
+
+// maxSizeWriter replace error response of request, which body was too
+// large, with 413 Request Entity Too Large, or 507 Insufficient Storage when
+// body exceeded user quota.
+type maxSizeWriter struct {
+	http.ResponseWriter
+	body        *maxSizeBody
+	wroteHeader bool
+	discard     bool
+	json        bool
+}
+
+func (mw *maxSizeWriter) WriteHeader(code int) {
+	if mw.wroteHeader {
+		return
+	}
+	mw.wroteHeader = true
+
+	if mw.body.exceeded && code >= http.StatusMultipleChoices {
+		mw.discard = true
+
+		code = http.StatusRequestEntityTooLarge
+		if errors.Is(mw.body.err, errQuotaExceeded) {
+			code = http.StatusInsufficientStorage
+		}
+		if mw.json {
+			jsonError(mw.ResponseWriter, code, mw.body.err.Error())
+			return
+		}
+		http.Error(mw.ResponseWriter, http.StatusText(code), code)
+		return
+	}
+
+	mw.ResponseWriter.WriteHeader(code)
+}
+
+func (mw *maxSizeWriter) Write(p []byte) (int, error) {
+	if !mw.wroteHeader {
+		mw.WriteHeader(http.StatusOK)
+	}
+	if mw.discard {
+		return len(p), nil
+	}
+	return mw.ResponseWriter.Write(p)
+}
+
+func (mw *maxSizeWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// withMaxBody limit size of body of all requests to -http.max-body with
+// http.MaxBytesReader, so connection is closed after too large body. It must
+// be the outermost handler, as the reader needs the server ResponseWriter.
+// Saved wikis have own limit, -wiki.max-size, checked by wiki handler.
+func withMaxBody(next http.Handler) http.Handler {
+	if httpMaxBody <= 0 {
+		return next
+	}
+
+	limit := int64(httpMaxBody)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, ".html") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			jsonError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge.Error())
+			return
+		}
+
+		body := &maxSizeBody{Closer: r.Body, r: http.MaxBytesReader(w, r.Body, limit), limit: limit, err: errBodyTooLarge}
+		r.Body = body
+		next.ServeHTTP(&maxSizeWriter{ResponseWriter: w, body: body, json: true}, r)
+	})
+}
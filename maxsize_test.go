@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithMaxBody(t *testing.T) {
+	defer func(s byteSize) { httpMaxBody = s }(httpMaxBody)
+	httpMaxBody = 10
+
+	h := withMaxBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method  string
+		path    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{http.MethodPost, "/api/v1/import", "0123456789", false, http.StatusNoContent},
+		{http.MethodPost, "/api/v1/import", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/v1/import", "0123456789a", true, http.StatusRequestEntityTooLarge},
+		// saved wikis are limited by -wiki.max-size
+		{http.MethodPut, "/a.html", "0123456789a", true, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.chunked {
+			r.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s %s (%d bytes, chunked %v): status %d, want %d", tt.method, tt.path, len(tt.body), tt.chunked, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestMaxSizeBody(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr error
+	}{
+		{"12345", nil},
+		{"123456", errWikiTooLarge},
+	}
+
+	for _, tt := range tests {
+		body := newMaxSizeBody(io.NopCloser(strings.NewReader(tt.body)), 5, errWikiTooLarge)
+		_, err := io.ReadAll(body)
+		if err != tt.wantErr || body.exceeded != (tt.wantErr != nil) {
+			t.Errorf("read %q: error %v, exceeded %v, want %v", tt.body, err, body.exceeded, tt.wantErr)
+		}
+	}
+}
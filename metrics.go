@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics exported on /metrics. Names and labels listed below are stable;
+// methods other than debugMethods are counted as "OTHER":
+//
+//	widdler_http_requests_total{method, code}
+//	widdler_active_users
+//	widdler_backups_total
+//	widdler_backup_last_duration_seconds
+//	widdler_wiki_size_bytes{user, wiki}
+var (
+	metricRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "widdler_http_requests_total",
+		Help: "Total number of HTTP requests by method and status code.",
+	}, []string{"method", "code"})
+
+	metricBackups = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "widdler_backups_total",
+		Help: "Total number of created backups.",
+	})
+
+	metricBackupDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "widdler_backup_last_duration_seconds",
+		Help: "Duration of the last backup creation.",
+	})
+
+	metricActiveUsers = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "widdler_active_users",
+		Help: "Number of users with active handlers.",
+	}, func() float64 {
+		count := 0
+		for _, v := range allVhosts() {
+			v.handlers.mu.RLock()
+			count += len(v.handlers.list)
+			v.handlers.mu.RUnlock()
+		}
+
+		return float64(count)
+	})
+
+	metricWikiSizeDesc = prometheus.NewDesc(
+		"widdler_wiki_size_bytes",
+		"Size of wiki file.",
+		[]string{"user", "wiki"}, nil,
+	)
+)
+
+// wikiSizeCollector report size of every wiki file on scrape.
+type wikiSizeCollector struct{}
+
+func (wikiSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricWikiSizeDesc
+}
+
+func (wikiSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, v := range allVhosts() {
+		v.handlers.mu.RLock()
+		names := make([]string, 0, len(v.handlers.list))
+		for _, h := range v.handlers.list {
+			names = append(names, h.name)
+		}
+		v.handlers.mu.RUnlock()
+
+		for _, name := range names {
+			collectWikiSizes(ch, v, name)
+		}
+	}
+}
+
+func collectWikiSizes(ch chan<- prometheus.Metric, v *vhost, name string) {
+	root := v.userDir(name)
+	bDir := userBackupDir(v, name)
+
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if p == bDir && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(p, ".html") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		ch <- prometheus.MustNewConstMetric(metricWikiSizeDesc, prometheus.GaugeValue,
+			float64(info.Size()), v.label(name), rel)
+
+		return nil
+	})
+}
+
+func registerMetrics(mux *http.ServeMux) {
+	prometheus.MustRegister(metricRequests, metricBackups, metricBackupDuration,
+		metricActiveUsers, wikiSizeCollector{})
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+func observeRequest(method string, code int) {
+	countRequest(method)
+	if metricsEnabled {
+		metricRequests.WithLabelValues(knownMethod(method), strconv.Itoa(code)).Inc()
+	}
+}
+
+func observeBackup(start time.Time) {
+	if metricsEnabled {
+		metricBackups.Inc()
+		metricBackupDuration.Set(time.Since(start).Seconds())
+	}
+}
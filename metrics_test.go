@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestObserveRequestMethods(t *testing.T) {
+	defer func(m bool) { metricsEnabled = m }(metricsEnabled)
+	metricsEnabled = true
+	metricRequests.Reset()
+	defer metricRequests.Reset()
+
+	for _, m := range []string{http.MethodGet, "FOO", "BAR", "propfind", http.MethodGet} {
+		observeRequest(m, http.StatusOK)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	metricRequests.Collect(ch)
+	close(ch)
+
+	got := make(map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "method" {
+				got[l.GetValue()] = pb.GetCounter().GetValue()
+			}
+		}
+	}
+
+	want := map[string]float64{http.MethodGet: 2, "OTHER": 3}
+	if len(got) != len(want) || got[http.MethodGet] != 2 || got["OTHER"] != 3 {
+		t.Errorf("requests by method %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	migrateCmd    bool
+	migrateToUser string
+)
+
+var errMigrateTarget = errors.New("target directory is not empty")
+
+// migrateWikis move wikis served without authentication (directly in dir)
+// with their backups into directory of user. With dryRun only the plan is
+// printed.
+func migrateWikis(w io.Writer, dir, user string, dryRun bool) error {
+	if user == "" || strings.ContainsAny(user, `/\`) || strings.HasPrefix(user, ".") {
+		return fmt.Errorf("invalid user name %q", user)
+	}
+
+	site := &vhost{davDir: dir}
+	userPath := site.userDir(user)
+
+	entries, err := os.ReadDir(userPath)
+	switch {
+	case err == nil && len(entries) > 0:
+		return fmt.Errorf("%s: %w", userPath, errMigrateTarget)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var wikis []string
+	for _, f := range files {
+		if f.Type().IsRegular() && strings.HasSuffix(f.Name(), ".html") {
+			wikis = append(wikis, f.Name())
+		}
+	}
+
+	if len(wikis) == 0 {
+		fmt.Fprintf(w, "No wikis found in %q\n", dir)
+		return nil
+	}
+
+	if !dryRun {
+		if err := os.MkdirAll(userPath, 0o700); err != nil {
+			return err
+		}
+	}
+
+	moved, backups := 0, 0
+	for _, name := range wikis {
+		srcBackupPath := wikiBackupPath(site, "", name)
+		dstBackupPath := wikiBackupPath(site, user, name)
+
+		list, err := listBackups(srcBackupPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s -> %s (%d backups)\n", filepath.Join(dir, name), filepath.Join(userPath, name), len(list))
+		if dryRun {
+			continue
+		}
+
+		if err := renameWiki(filepath.Join(dir, name), filepath.Join(userPath, name), srcBackupPath, dstBackupPath); err != nil {
+			return fmt.Errorf("move %s error: %w (moved %d of %d wikis)", name, err, moved, len(wikis))
+		}
+		moved++
+		backups += len(list)
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "Dry run: %d wikis would be moved to %q\n", len(wikis), userPath)
+		return nil
+	}
+
+	// backups of the moved wikis are gone from the old directory
+	oldBackupDir := userBackupDir(site, "")
+	if err := pruneManifest(oldBackupDir); err == nil {
+		if entries, err := readManifest(oldBackupDir); err == nil && len(entries) == 0 {
+			_ = os.Remove(filepath.Join(oldBackupDir, manifestName))
+		}
+	}
+	_ = os.Remove(oldBackupDir)
+
+	fmt.Fprintf(w, "Moved %d wikis and %d backups to %q\n", moved, backups, userPath)
+
+	return nil
+}
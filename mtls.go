@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// loadClientCAs read PEM file with CA certificates used to verify clients.
+func loadClientCAs(fname string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filepath.Clean(fname))
+	if err != nil {
+		return nil, fmt.Errorf("read CA file %s error: %w", fname, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", fname)
+	}
+
+	return pool, nil
+}
+
+// certUser return user name from the common name of verified client
+// certificate.
+func certUser(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return "", false
+	}
+
+	cn := r.TLS.PeerCertificates[0].Subject.CommonName
+	if !validUserName(cn) {
+		return "", false
+	}
+
+	return cn, true
+}
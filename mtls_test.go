@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert create certificate with common name cn signed by parent; parent
+// nil create self-signed CA.
+func testCert(t *testing.T, cn string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCertUser(t *testing.T) {
+	ca := testCert(t, "test CA", nil)
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := loadClientCAs(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := certUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, user)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}
+	ts.StartTLS()
+	defer ts.Close()
+
+	other := testCert(t, "other CA", nil)
+
+	tests := []struct {
+		name     string
+		certs    []tls.Certificate
+		wantUser string
+	}{
+		{"valid certificate", []tls.Certificate{testCert(t, "alice", &ca)}, "alice"},
+		{"invalid user name", []tls.Certificate{testCert(t, "../alice", &ca)}, ""},
+		{"no certificate", nil, ""},
+		// client does not send certificate not issued by accepted CA
+		{"unknown CA", []tls.Certificate{testCert(t, "alice", &other)}, ""},
+	}
+
+	for _, tt := range tests {
+		client := ts.Client()
+		transport := client.Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = tt.certs
+		client.Transport = transport
+
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if tt.wantUser == "" && resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, http.StatusUnauthorized)
+		}
+		if tt.wantUser != "" && string(body) != tt.wantUser {
+			t.Errorf("%s: user %q, want %q", tt.name, body, tt.wantUser)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNoCreate(t *testing.T) {
+	defer func(n bool) { noCreate = n }(noCreate)
+	defer func(l *template.Template) { templ.Store(l) }(templ.Load())
+
+	landing, err := loadLanding("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templ.Store(landing)
+
+	tests := []struct {
+		noCreate bool
+		want     int
+	}{
+		{true, http.StatusForbidden},
+		{false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		noCreate = tt.noCreate
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "old.html"), []byte("old wiki"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		v := &vhost{davDir: dir}
+		addHandler(&v.handlers, "", dir)
+		h := wikiHandler(v)
+
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/new.html", nil))
+		if rec.Code != tt.want {
+			t.Errorf("no-create %v: GET new wiki status %d, want %d", tt.noCreate, rec.Code, tt.want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "new.html")); (err == nil) == tt.noCreate {
+			t.Errorf("no-create %v: new wiki created %v", tt.noCreate, err == nil)
+		}
+
+		// existing wikis are served as usual
+		rec = httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/old.html", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "old wiki" {
+			t.Errorf("no-create %v: GET existing wiki status %d, body %q", tt.noCreate, rec.Code, rec.Body)
+		}
+
+		rec = httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := strings.Contains(rec.Body.String(), "To create another TiddlyWiki"); got == tt.noCreate {
+			t.Errorf("no-create %v: landing page has create hint %v", tt.noCreate, got)
+		}
+	}
+}
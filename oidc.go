@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcCookie      = "widdler_oidc"
+	oidcStateCookie = "widdler_oidc_state"
+)
+
+var errInvalidCookie = errors.New("invalid cookie")
+
+// oidcAuth handle login with OpenID Connect provider. Logged in users get
+// signed session cookie containing user name and expiry time.
+type oidcAuth struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+var (
+	oidcProvider *oidcAuth
+	oidcClient   = &http.Client{Transport: &tracingTransport{}}
+)
+
+func newOIDCAuth(ctx context.Context) (*oidcAuth, error) {
+	if oidcIssuer == "" || oidcClientID == "" || oidcRedirectURL == "" {
+		return nil, errors.New("-auth oidc require -auth.oidc.issuer, -auth.oidc.client-id and -auth.oidc.redirect-url")
+	}
+
+	if authSecret == "" {
+		return nil, errors.New("-auth oidc require -auth.secret")
+	}
+
+	provider, err := oidc.NewProvider(ctx, oidcIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc provider %s error: %w", oidcIssuer, err)
+	}
+
+	return &oidcAuth{
+		config: oauth2.Config{
+			ClientID:     oidcClientID,
+			ClientSecret: oidcClientSecret,
+			RedirectURL:  oidcRedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: oidcClientID}),
+	}, nil
+}
+
+func cookieKey() []byte {
+	key := sha256.Sum256([]byte(authSecret))
+	return key[:]
+}
+
+// signValue return value with appended HMAC-SHA256 signature.
+func signValue(value string) string {
+	mac := hmac.New(sha256.New, cookieKey())
+	mac.Write([]byte(value))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyValue check signature created by signValue and return value.
+func verifyValue(signed string) (string, error) {
+	data, sig, ok := strings.Cut(signed, ".")
+	if !ok {
+		return "", errInvalidCookie
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return "", errInvalidCookie
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", errInvalidCookie
+	}
+
+	mac := hmac.New(sha256.New, cookieKey())
+	mac.Write(value)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return "", errInvalidCookie
+	}
+
+	return string(value), nil
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// oidcUser return user from valid session cookie.
+func oidcUser(r *http.Request) (string, bool) {
+	c, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return "", false
+	}
+
+	value, err := verifyValue(c.Value)
+	if err != nil {
+		return "", false
+	}
+
+	user, exp, ok := strings.Cut(value, "|")
+	if !ok {
+		return "", false
+	}
+
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+
+	return user, user != ""
+}
+
+func (o *oidcAuth) login(w http.ResponseWriter, r *http.Request) {
+	state := randomToken(16)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     prefixed("/auth/"),
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, o.config.AuthCodeURL(state), http.StatusFound)
+}
+
+func (o *oidcAuth) callback(w http.ResponseWriter, r *http.Request) {
+	state, err := r.Cookie(oidcStateCookie)
+	if err != nil || state.Value == "" || state.Value != r.URL.Query().Get("state") {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, oidcClient)
+	token, err := o.config.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("oidc: exchange code error: %v\n", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idToken, err := o.verifier.Verify(r.Context(), rawID)
+	if err != nil {
+		log.Printf("oidc: verify id token error: %v\n", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := claimUser(claims)
+	if err != nil {
+		log.Printf("oidc: %v\n", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    signValue(fmt.Sprintf("%s|%d", user, expires.Unix())),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: prefixed("/auth/"), MaxAge: -1})
+
+	log.Printf("oidc: user %s logged in\n", user)
+	http.Redirect(w, r, prefixed("/"), http.StatusFound)
+}
+
+// claimUser return user name from authClaim of ID token. Email is accepted
+// only when provider verified it, otherwise anyone could register account
+// with email of other user.
+func claimUser(claims map[string]interface{}) (string, error) {
+	user, _ := claims[authClaim].(string)
+	if !validUserName(user) {
+		return "", fmt.Errorf("invalid or missing claim %q", authClaim)
+	}
+
+	if authClaim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return "", fmt.Errorf("email %s not verified", user)
+		}
+	}
+
+	return user, nil
+}
+
+func (o *oidcAuth) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, prefixed("/"), http.StatusFound)
+}
+
+func (o *oidcAuth) register(mux *http.ServeMux) {
+	mux.HandleFunc("/auth/login", logger(o.login))
+	mux.HandleFunc("/auth/callback", logger(o.callback))
+	mux.HandleFunc("/auth/logout", logger(o.logout))
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestClaimUser(t *testing.T) {
+	defer func(c string) { authClaim = c }(authClaim)
+
+	tests := []struct {
+		claim  string
+		claims map[string]interface{}
+		want   string
+		ok     bool
+	}{
+		{"email", map[string]interface{}{"email": "alice@example.com", "email_verified": true}, "alice@example.com", true},
+		{"email", map[string]interface{}{"email": "alice@example.com", "email_verified": false}, "", false},
+		{"email", map[string]interface{}{"email": "alice@example.com", "email_verified": "true"}, "", false},
+		{"email", map[string]interface{}{"email": "alice@example.com"}, "", false},
+		{"email", map[string]interface{}{"email_verified": true}, "", false},
+		{"preferred_username", map[string]interface{}{"preferred_username": "alice"}, "alice", true},
+		{"preferred_username", map[string]interface{}{"preferred_username": "../alice"}, "", false},
+	}
+
+	for _, tt := range tests {
+		authClaim = tt.claim
+		user, err := claimUser(tt.claims)
+		if (err == nil) != tt.ok || user != tt.want {
+			t.Errorf("claimUser(%v) = %q, %v; want %q, ok %v", tt.claims, user, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// urlPrefix is path under which widdler is available to clients, e.g.
+// "/wikis"; empty when served at root.
+var urlPrefix string
+
+// normalizePrefix return prefix with leading and without trailing slash.
+func normalizePrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// prefixed return URL path p as seen by clients.
+func prefixed(p string) string {
+	return urlPrefix + p
+}
+
+// withPrefix strip -prefix from request paths before routing. Requests
+// without the prefix (already stripped by proxy) are served unchanged.
+func withPrefix(next http.Handler) http.Handler {
+	if urlPrefix == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == urlPrefix {
+			target := urlPrefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		p, ok := strings.CutPrefix(r.URL.Path, urlPrefix+"/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u := new(url.URL)
+		*u = *r.URL
+		u.Path = "/" + p
+		if rp, ok := strings.CutPrefix(r.URL.RawPath, urlPrefix+"/"); ok {
+			u.RawPath = "/" + rp
+		} else {
+			u.RawPath = ""
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL = u
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// davPrefix return path of directory of site as seen by WebDAV clients.
+func davPrefix(site *vhost) string {
+	if site == sharedSite {
+		return prefixed("/" + strings.TrimSuffix(sharedPrefix, "/"))
+	}
+	return urlPrefix
+}
+
+// davRequest return copy of r with path as seen by client, so hrefs in
+// WebDAV responses point to the right place.
+func davRequest(r *http.Request, prefix string) *http.Request {
+	if prefix == "" {
+		return r
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = prefix + r.URL.Path
+	r2.URL.RawPath = ""
+	return r2
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol (https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt)
+// header sent by load balancer before client data.
+
+const (
+	proxyV1Prefix      = "PROXY "
+	proxyV1MaxLen      = 107
+	proxyHeaderTimeout = 5 * time.Second
+)
+
+var (
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	proxyProtocol       bool
+	proxyProtocolStrict bool
+
+	errNoProxyHeader      = errors.New("missing PROXY protocol header")
+	errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+)
+
+// proxyListener accept connections starting with PROXY protocol header.
+type proxyListener struct {
+	net.Listener
+	strict bool
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, r: bufio.NewReader(conn), strict: l.strict}, nil
+}
+
+// proxyConn read PROXY header on first use; header is read lazily, so slow
+// clients do not block accepting other connections.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	strict bool
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+
+		if errors.Is(c.err, errNoProxyHeader) && !c.strict {
+			c.err = nil
+		}
+		if c.err != nil {
+			log.Printf("connection from %s: %v\n", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr return client address from PROXY header, if there was one.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader parse PROXY header v1 or v2. Returned address is nil for
+// connections made by proxy itself (health checks).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		if p, err := r.Peek(len(proxyV1Prefix)); err == nil && string(p) == proxyV1Prefix {
+			return readProxyV1(r)
+		}
+	case proxyV2Signature[0]:
+		if p, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(p, proxyV2Signature) {
+			return readProxyV2(r)
+		}
+	}
+
+	return nil, errNoProxyHeader
+}
+
+// readProxyV1 parse text header, e.g.
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errInvalidProxyHeader
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errInvalidProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parse binary header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+
+	verCmd, family := hdr[12], hdr[13]
+	length := binary.BigEndian.Uint16(hdr[14:16])
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d: %w", verCmd>>4, errInvalidProxyHeader)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	// LOCAL command: connection made by proxy itself
+	if verCmd&0x0f == 0 {
+		return nil, nil
+	}
+
+	switch family >> 4 {
+	case 1: // AF_INET
+		if len(data) < 12 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:4]), Port: int(binary.BigEndian.Uint16(data[8:10]))}, nil
+	case 2: // AF_INET6
+		if len(data) < 36 {
+			return nil, errInvalidProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:16]), Port: int(binary.BigEndian.Uint16(data[32:34]))}, nil
+	}
+
+	// AF_UNIX and unspecified: keep address of the proxy
+	return nil, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+var http2Push bool
+
+// findPusher return http.Pusher of response writer, looking through
+// wrappers; nil when push is not supported (HTTP/1.x).
+func findPusher(w http.ResponseWriter) http.Pusher {
+	for {
+		if p, ok := w.(http.Pusher); ok {
+			return p
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+}
+
+// preloadLinks return local targets of rel=preload entries of Link headers.
+func preloadLinks(h http.Header) []string {
+	var targets []string
+	for _, header := range h.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = strings.Trim(target, "<>")
+
+			preload := false
+			for _, p := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if strings.EqualFold(k, "rel") && strings.Contains(strings.ToLower(strings.Trim(v, `"`)), "preload") {
+					preload = true
+				}
+				if strings.EqualFold(k, "nopush") {
+					preload = false
+					break
+				}
+			}
+
+			// only resources of this server can be pushed
+			if preload && strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// pushWriter push resources from Link headers of successful response
+// before it is sent.
+type pushWriter struct {
+	http.ResponseWriter
+	pusher      http.Pusher
+	path        string
+	wroteHeader bool
+}
+
+func (p *pushWriter) WriteHeader(code int) {
+	if !p.wroteHeader && code == http.StatusOK {
+		for _, target := range preloadLinks(p.Header()) {
+			if target == p.path {
+				continue
+			}
+			// push is only a hint; errors (e.g. disabled by client) are ignored
+			_ = p.pusher.Push(target, nil)
+		}
+	}
+	p.wroteHeader = true
+
+	p.ResponseWriter.WriteHeader(code)
+}
+
+func (p *pushWriter) Write(b []byte) (int, error) {
+	if !p.wroteHeader {
+		p.WriteHeader(http.StatusOK)
+	}
+	return p.ResponseWriter.Write(b)
+}
+
+func (p *pushWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// withPush wrap response writer of GET request to push linked resources,
+// when supported by the connection.
+func withPush(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if !http2Push || r.Method != http.MethodGet {
+		return w
+	}
+
+	pusher := findPusher(w)
+	if pusher == nil {
+		return w
+	}
+
+	return &pushWriter{ResponseWriter: w, pusher: pusher, path: r.URL.Path}
+}
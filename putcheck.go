@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+var validatePut = true
+
+// putCheckError describe failed check of saved wiki.
+type putCheckError struct {
+	check string
+	msg   string
+}
+
+func (e *putCheckError) Error() string {
+	return e.check + ": " + e.msg
+}
+
+// checkWikiStream parse wiki and verify that it has tiddler store with valid
+// JSON (or store area of TiddlyWiki before 5.2) and is not truncated.
+func checkWikiStream(r io.Reader) error {
+	z := xhtml.NewTokenizer(bufio.NewReader(r))
+
+	var store, inStore, htmlEnd bool
+
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+
+		name, hasAttr := z.TagName()
+		switch tt {
+		case xhtml.StartTagToken:
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch {
+				case string(name) == "script" && string(key) == "class" &&
+					strings.Contains(string(val), "tiddlywiki-tiddler-store"):
+					store, inStore = true, true
+				case string(name) == "div" && string(key) == "id" && string(val) == "storeArea":
+					store = true
+				}
+			}
+		case xhtml.TextToken:
+			if inStore && !json.Valid(z.Raw()) {
+				return &putCheckError{check: "store_json", msg: "tiddler store is not valid JSON"}
+			}
+		case xhtml.EndTagToken:
+			inStore = false
+			if string(name) == "html" {
+				htmlEnd = true
+			}
+		}
+	}
+
+	if err := z.Err(); !errors.Is(err, io.EOF) {
+		return err
+	}
+	if !store {
+		return &putCheckError{check: "tiddler_store", msg: "missing tiddler store"}
+	}
+	if !htmlEnd {
+		return &putCheckError{check: "html_end", msg: "missing </html>, file may be truncated"}
+	}
+
+	return nil
+}
+
+// validatePutBody copy body of request into temporary file in dir while
+// checking it, so big wikis are not kept in memory. On success request body
+// is replaced with the file; returned function remove it.
+func validatePutBody(r *http.Request, dir string) (func(), error) {
+	tmp, err := os.CreateTemp(dir, ".put-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file error: %w", err)
+	}
+
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	err = checkWikiStream(io.TeeReader(r.Body, tmp))
+	if err == nil {
+		// parser may stop before the end of body
+		_, err = io.Copy(tmp, r.Body)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	r.Body = tmp
+
+	return cleanup, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	usageCacheTTL = 5 * time.Second
+	sizeWarnTTL   = 30 * time.Second
+	// sizeWarnRatio is part of quota above which saved wikis get warning.
+	sizeWarnRatio = 0.9
+)
+
+var (
+	warnSize byteSize
+	// sizeLimits cache sizeLimit of wiki files.
+	sizeLimits sync.Map
+
+	errQuotaExceeded = errors.New("quota exceeded")
+)
+
+// byteSize is a flag.Value accepting sizes like 500MB or 2GiB.
+type byteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000}, {"TB", 1000 * 1000 * 1000 * 1000},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			mult = u.mult
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(v * float64(mult)), nil
+}
+
+func formatSize(v int64) string {
+	switch {
+	case v >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(v)/(1<<30))
+	case v >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(v)/(1<<20))
+	case v >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(v)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", v)
+}
+
+func (b *byteSize) String() string {
+	return formatSize(int64(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	v, err := parseSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(v)
+	return nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
+
+// userQuota return quota for user directory; .quota file in the directory
+// overrides global -quota value.
+func userQuota(userPath string) int64 {
+	return userSizeSetting(userPath, ".quota", int64(quota))
+}
+
+// userSizeSetting read size from file name in user directory; def is
+// returned when there is no valid file.
+func userSizeSetting(userPath, name string, def int64) int64 {
+	data, err := os.ReadFile(filepath.Join(userPath, name))
+	if err != nil {
+		return def
+	}
+
+	v, err := parseSize(string(data))
+	if err != nil {
+		log.Printf("invalid %s in %s: %v\n", name, userPath, err)
+		return def
+	}
+
+	return v
+}
+
+// usage return size of user directory. Result is cached for a while to
+// avoid walking the whole tree on every save. Caller must hold h.mu.
+func (h *userHandler) usage(userPath string) (int64, error) {
+	if !h.usageAt.IsZero() && time.Since(h.usageAt) < usageCacheTTL {
+		return h.usageSize, nil
+	}
+
+	size, err := dirSize(userPath)
+	if err != nil {
+		return 0, err
+	}
+
+	h.usageSize = size
+	h.usageAt = time.Now()
+
+	return size, nil
+}
+
+// invalidateUsage drop cached directory size. Caller must hold h.mu.
+func (h *userHandler) invalidateUsage() {
+	h.usageAt = time.Time{}
+}
+
+// exceedsQuota check if writing size bytes to fullPath fit into user quota.
+// Caller must hold h.mu.
+func (h *userHandler) exceedsQuota(userPath, fullPath string, size int64) (bool, error) {
+	left, limited, err := h.quotaLeft(userPath, fullPath)
+	if err != nil || !limited {
+		return false, err
+	}
+
+	return size > left, nil
+}
+
+// quotaLeft return number of bytes which can be written to fullPath without
+// exceeding user quota; limited is false when user has no quota. Caller
+// must hold h.mu.
+func (h *userHandler) quotaLeft(userPath, fullPath string) (left int64, limited bool, err error) {
+	limit := userQuota(userPath)
+	if limit <= 0 {
+		return 0, false, nil
+	}
+
+	used, err := h.usage(userPath)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// written file replaces existing one
+	if fi, err := os.Stat(fullPath); err == nil {
+		used -= fi.Size()
+	}
+
+	return max(limit-used, 0), true, nil
+}
+
+// sizeLimit is size of wiki above which warning is sent.
+type sizeLimit struct {
+	limit int64
+	quota int64
+	at    time.Time
+}
+
+// wikiSizeLimit return warning threshold for wiki: -warn.size or part of
+// user quota.
+func wikiSizeLimit(userPath, fullPath string) sizeLimit {
+	if v, ok := sizeLimits.Load(fullPath); ok {
+		if l := v.(sizeLimit); time.Since(l.at) < sizeWarnTTL {
+			return l
+		}
+	}
+
+	l := sizeLimit{limit: int64(warnSize), at: time.Now()}
+	if l.limit <= 0 {
+		if l.quota = userQuota(userPath); l.quota > 0 {
+			l.limit = int64(float64(l.quota) * sizeWarnRatio)
+		}
+	}
+	sizeLimits.Store(fullPath, l)
+
+	return l
+}
+
+// sizeWarning return warning for wiki of given size; empty when it is below
+// threshold.
+func sizeWarning(userPath, fullPath string, size int64) string {
+	l := wikiSizeLimit(userPath, fullPath)
+	if l.limit <= 0 || size <= l.limit {
+		return ""
+	}
+
+	if l.quota > 0 {
+		return fmt.Sprintf("wiki size %s approaching quota %s", formatSize(size), formatSize(l.quota))
+	}
+	return fmt.Sprintf("wiki size %s exceeds %s", formatSize(size), formatSize(l.limit))
+}
+
+// warningWriter add X-Widdler-Warning header to successful responses of
+// PUT. Size of wiki is checked after it is written, as length of chunked
+// body is not known before.
+type warningWriter struct {
+	http.ResponseWriter
+	userPath    string
+	fullPath    string
+	wroteHeader bool
+}
+
+func (ww *warningWriter) WriteHeader(code int) {
+	if !ww.wroteHeader && code < http.StatusMultipleChoices {
+		if fi, err := os.Stat(ww.fullPath); err == nil {
+			if warning := sizeWarning(ww.userPath, ww.fullPath, fi.Size()); warning != "" {
+				ww.Header().Set("X-Widdler-Warning", warning)
+			}
+		}
+	}
+	ww.wroteHeader = true
+
+	ww.ResponseWriter.WriteHeader(code)
+}
+
+func (ww *warningWriter) Write(b []byte) (int, error) {
+	if !ww.wroteHeader {
+		ww.WriteHeader(http.StatusOK)
+	}
+	return ww.ResponseWriter.Write(b)
+}
+
+func (ww *warningWriter) Unwrap() http.ResponseWriter {
+	return ww.ResponseWriter
+}
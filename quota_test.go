@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuotaLeft(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".quota"), []byte("100"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.html"), []byte(strings.Repeat("a", 40)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		wiki string
+		size int64
+		left int64
+		over bool
+	}{
+		// .quota (3 bytes) and a.html are counted
+		{"b.html", 57, 57, false},
+		{"b.html", 58, 57, true},
+		// a.html is replaced
+		{"a.html", 97, 97, false},
+		{"a.html", 98, 97, true},
+	}
+
+	for _, tt := range tests {
+		h := &userHandler{}
+		fullPath := filepath.Join(dir, tt.wiki)
+
+		left, limited, err := h.quotaLeft(dir, fullPath)
+		if err != nil || !limited || left != tt.left {
+			t.Errorf("quotaLeft(%s) = %d, %v, %v, want %d, true, nil", tt.wiki, left, limited, err, tt.left)
+		}
+
+		over, err := h.exceedsQuota(dir, fullPath, tt.size)
+		if err != nil || over != tt.over {
+			t.Errorf("exceedsQuota(%s, %d) = %v, %v, want %v", tt.wiki, tt.size, over, err, tt.over)
+		}
+	}
+}
+
+func TestQuotaChunkedBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"12345", http.StatusCreated},
+		{"123456", http.StatusInsufficientStorage},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/a.html", io.NopCloser(strings.NewReader(tt.body)))
+		rec := httptest.NewRecorder()
+
+		body := newMaxSizeBody(r.Body, 5, errQuotaExceeded)
+		w := &maxSizeWriter{ResponseWriter: rec, body: body}
+		if _, err := io.ReadAll(body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+
+		if rec.Code != tt.want {
+			t.Errorf("PUT %q: status %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestWarningWriter(t *testing.T) {
+	defer func(s byteSize) { warnSize = s }(warnSize)
+	warnSize = 10
+
+	dir := t.TempDir()
+	tests := []struct {
+		size int
+		want bool
+	}{
+		{10, false},
+		{11, true},
+	}
+
+	for _, tt := range tests {
+		fullPath := filepath.Join(dir, "a.html")
+		if err := os.WriteFile(fullPath, []byte(strings.Repeat("a", tt.size)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		sizeLimits.Delete(fullPath)
+
+		rec := httptest.NewRecorder()
+		w := &warningWriter{ResponseWriter: rec, userPath: dir, fullPath: fullPath}
+		w.WriteHeader(http.StatusCreated)
+
+		if got := rec.Header().Get("X-Widdler-Warning") != ""; got != tt.want {
+			t.Errorf("size %d: warning %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestSizeWarning(t *testing.T) {
+	defer func(s, q byteSize) { warnSize, quota = s, q }(warnSize, quota)
+	warnSize = 0
+	quota = 50 << 20
+
+	dir := t.TempDir()
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, ""},
+		{45 << 20, ""},
+		{45<<20 + 1, "wiki size 45.0MB approaching quota 50.0MB"},
+		{60 << 20, "wiki size 60.0MB approaching quota 50.0MB"},
+	}
+
+	for _, tt := range tests {
+		fullPath := filepath.Join(dir, "a.html")
+		sizeLimits.Delete(fullPath)
+
+		if got := sizeWarning(dir, fullPath, tt.size); got != tt.want {
+			t.Errorf("sizeWarning(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+
+	// no quota and no -warn.size
+	quota = 0
+	fullPath := filepath.Join(dir, "b.html")
+	if got := sizeWarning(dir, fullPath, 60<<20); got != "" {
+		t.Errorf("sizeWarning without quota = %q", got)
+	}
+
+	// threshold is cached
+	if err := os.WriteFile(filepath.Join(dir, ".quota"), []byte("10"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := sizeWarning(dir, fullPath, 60<<20); got != "" {
+		t.Errorf("sizeWarning with cached threshold = %q", got)
+	}
+	sizeLimits.Delete(fullPath)
+	if got := sizeWarning(dir, fullPath, 10); got != "wiki size 10B approaching quota 10B" {
+		t.Errorf("sizeWarning with user quota = %q", got)
+	}
+}
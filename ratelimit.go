@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket limiter keyed by client address.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*bucket
+	whitelist []*net.IPNet
+}
+
+var limiter *rateLimiter
+
+// parseRate parse rate like 20/min into number of requests per second and
+// burst size.
+func parseRate(s string) (float64, float64, error) {
+	count, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid rate %q", s)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q", s)
+	}
+
+	var period time.Duration
+	switch unit {
+	case "s", "sec", "second":
+		period = time.Second
+	case "m", "min", "minute":
+		period = time.Minute
+	case "h", "hour":
+		period = time.Hour
+	default:
+		return 0, 0, fmt.Errorf("invalid rate unit %q", unit)
+	}
+
+	return float64(n) / period.Seconds(), float64(n), nil
+}
+
+func newRateLimiter(rate string, whitelist string) (*rateLimiter, error) {
+	perSec, burst, err := parseRate(rate)
+	if err != nil {
+		return nil, err
+	}
+
+	nets, err := parseCIDRs(whitelist)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateLimiter{
+		rate:      perSec,
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		whitelist: nets,
+	}, nil
+}
+
+// allow take token for ip; when bucket is empty return time after which
+// next request will be accepted.
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	if containsIP(l.whitelist, net.ParseIP(ip)) {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// prune remove buckets that are full again, so map does not grow forever.
+func (l *rateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+func (l *rateLimiter) pruneLoop() {
+	for now := range time.Tick(time.Minute) {
+		l.prune(now)
+	}
+}
+
+func rateLimit(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter != nil {
+			ip := clientIP(r)
+			if ok, wait := limiter.allow(ip, time.Now()); !ok {
+				log.Printf("rate limit exceeded for %s\n", ip)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		f(w, r)
+	}
+}
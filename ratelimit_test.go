@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate    string
+		perSec  float64
+		burst   float64
+		wantErr bool
+	}{
+		{"20/min", 20.0 / 60, 20, false},
+		{"5/s", 5, 5, false},
+		{"3600/hour", 1, 3600, false},
+		{"20", 0, 0, true},
+		{"0/min", 0, 0, true},
+		{"x/min", 0, 0, true},
+		{"20/day", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		perSec, burst, err := parseRate(tt.rate)
+		if (err != nil) != tt.wantErr || perSec != tt.perSec || burst != tt.burst {
+			t.Errorf("parseRate(%q) = %v, %v, %v, want %v, %v, error %v", tt.rate, perSec, burst, err, tt.perSec, tt.burst, tt.wantErr)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	defer func(l *rateLimiter) { limiter = l }(limiter)
+
+	var err error
+	limiter, err = newRateLimiter("3/min", "10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := rateLimit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		remote string
+		want   int
+	}{
+		{"192.0.2.1:1000", http.StatusNoContent},
+		{"192.0.2.1:1000", http.StatusNoContent},
+		{"192.0.2.1:1000", http.StatusNoContent},
+		{"192.0.2.1:1000", http.StatusTooManyRequests},
+		// other clients have own bucket
+		{"192.0.2.2:1000", http.StatusNoContent},
+		// whitelisted clients are never limited
+		{"10.1.2.3:1000", http.StatusNoContent},
+		{"10.1.2.3:1000", http.StatusNoContent},
+		{"10.1.2.3:1000", http.StatusNoContent},
+		{"10.1.2.3:1000", http.StatusNoContent},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		rec := httptest.NewRecorder()
+		h(rec, r)
+
+		if rec.Code != tt.want {
+			t.Errorf("request %d from %s: status %d, want %d", i, tt.remote, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "20" {
+			t.Errorf("request %d: Retry-After %q, want %q", i, rec.Header().Get("Retry-After"), "20")
+		}
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	l, err := newRateLimiter("1/s", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	l.allow("192.0.2.1", now)
+	l.prune(now)
+	if len(l.buckets) != 1 {
+		t.Fatalf("used bucket pruned")
+	}
+
+	l.prune(now.Add(2 * time.Second))
+	if len(l.buckets) != 0 {
+		t.Errorf("refilled bucket not pruned")
+	}
+}
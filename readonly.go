@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+const readOnlyMarker = ".readonly"
+
+var writeMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+	"MKCOL":           true,
+	"MOVE":            true,
+	"COPY":            true,
+	"LOCK":            true,
+	"UNLOCK":          true,
+	"PROPPATCH":       true,
+}
+
+func isWriteMethod(method string) bool {
+	return writeMethods[method]
+}
+
+// isReadOnly check if wiki can not be modified, either because of global
+// -readonly flag or <wiki>.readonly marker file next to it.
+func isReadOnly(fullPath string) bool {
+	if readOnly {
+		return true
+	}
+
+	_, err := os.Stat(fullPath + readOnlyMarker)
+
+	return err == nil
+}
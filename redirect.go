@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+)
+
+const hstsValue = "max-age=63072000; includeSubDomains"
+
+var (
+	httpsRedirect     bool
+	httpsRedirectPort string
+)
+
+// httpsRedirectHandler redirect plain HTTP requests to HTTPS server
+// listening on addr, keeping path and query.
+func httpsRedirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// serveHTTPSRedirect listen for plain HTTP on -https.redirect-port and
+// redirect all requests to HTTPS server on addr.
+func serveHTTPSRedirect(addr string) {
+	host, _, _ := net.SplitHostPort(addr)
+	s := &http.Server{
+		Addr:              net.JoinHostPort(host, httpsRedirectPort),
+		Handler:           httpsRedirectHandler(addr),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	log.Printf("Redirecting HTTP on '%s' to HTTPS", s.Addr)
+	if err := s.ListenAndServe(); err != nil {
+		log.Printf("https redirect listener error: %v\n", err)
+	}
+}
+
+// withHSTS tell browsers to use only HTTPS for the host.
+func withHSTS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", hstsValue)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		addr   string
+		target string
+		host   string
+		want   string
+	}{
+		{":443", "/a.html?tw=5.3.0", "example.com", "https://example.com/a.html?tw=5.3.0"},
+		{":443", "/", "example.com:80", "https://example.com/"},
+		{"127.0.0.1:8443", "/wikis/a%20b.html", "example.com", "https://example.com:8443/wikis/a%20b.html"},
+		{":8443", "/", "[2001:db8::1]:80", "https://[2001:db8::1]:8443/"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		r.Host = tt.host
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(tt.addr).ServeHTTP(rec, r)
+
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s%s: status %d, want %d", tt.host, tt.target, rec.Code, http.StatusMovedPermanently)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s%s: Location %q, want %q", tt.host, tt.target, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = ""
+	rec := httptest.NewRecorder()
+	httpsRedirectHandler(":443").ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("request without host: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestWithHSTS(t *testing.T) {
+	rec := httptest.NewRecorder()
+	withHSTS(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("Strict-Transport-Security"); got != hstsValue {
+		t.Errorf("Strict-Transport-Security %q, want %q", got, hstsValue)
+	}
+}
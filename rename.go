@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type renameOp struct {
+	from, to string
+}
+
+// renameAll rename files in order; when any rename fails, already renamed
+// files are moved back.
+func renameAll(ops []renameOp) error {
+	for i, op := range ops {
+		if err := os.Rename(op.from, op.to); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				_ = os.Rename(ops[j].to, ops[j].from)
+			}
+			return fmt.Errorf("rename %s error: %w", op.from, err)
+		}
+	}
+
+	return nil
+}
+
+// renameWiki rename wiki together with its password file and all backups.
+// Either all files are renamed or none. Caller must hold handler lock.
+func renameWiki(srcPath, dstPath, srcBackupPath, dstBackupPath string) error {
+	ops := []renameOp{{srcPath, dstPath}}
+
+	if _, err := os.Stat(srcPath + wikiPassExt); err == nil {
+		ops = append(ops, renameOp{srcPath + wikiPassExt, dstPath + wikiPassExt})
+	}
+	if _, err := os.Stat(srcPath + storeExt); err == nil {
+		ops = append(ops, renameOp{srcPath + storeExt, dstPath + storeExt})
+	}
+
+	srcBase := srcBackupPath[:len(srcBackupPath)-len(filepath.Ext(srcBackupPath))]
+	dstBase := dstBackupPath[:len(dstBackupPath)-len(filepath.Ext(dstBackupPath))]
+
+	backups, err := listBackups(srcBackupPath)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, b := range backups {
+		files = append(files, b.path)
+		if _, err := os.Stat(b.path + checksumExt); err == nil {
+			files = append(files, b.path+checksumExt)
+		}
+	}
+
+	for _, f := range files {
+		to := dstBase + strings.TrimPrefix(f, srcBase)
+		if _, err := os.Stat(to); err == nil {
+			return fmt.Errorf("backup %s: %w", filepath.Base(to), os.ErrExist)
+		}
+		ops = append(ops, renameOp{f, to})
+	}
+
+	if len(files) > 0 {
+		if err := os.MkdirAll(filepath.Dir(dstBackupPath), 0o700); err != nil {
+			return err
+		}
+	}
+
+	if err := renameAll(ops); err != nil {
+		return err
+	}
+
+	// checksum files contain name of backup
+	for _, op := range ops {
+		if !strings.HasSuffix(op.to, checksumExt) {
+			continue
+		}
+
+		backup := strings.TrimSuffix(op.to, checksumExt)
+		sum, verified, err := readChecksum(backup)
+		if err != nil {
+			continue
+		}
+
+		if recordBackup(backup, sum) == nil {
+			_ = os.Chtimes(op.to, verified, verified)
+		}
+	}
+
+	return nil
+}
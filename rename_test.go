@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenameWiki(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir,
+		"a.html", "a.html"+wikiPassExt,
+		"backups/a-20240101_100000.html",
+		"backups/a-20240102_100000.html.gz",
+		"backups/ab-20240101_100000.html",
+	)
+
+	err := renameWiki(filepath.Join(dir, "a.html"), filepath.Join(dir, "b.html"),
+		filepath.Join(dir, "backups", "a.html"), filepath.Join(dir, "backups", "b.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		exists bool
+	}{
+		{"b.html", true},
+		{"b.html" + wikiPassExt, true},
+		{"backups/b-20240101_100000.html", true},
+		{"backups/b-20240102_100000.html.gz", true},
+		{"a.html", false},
+		{"a.html" + wikiPassExt, false},
+		{"backups/a-20240101_100000.html", false},
+		{"backups/a-20240102_100000.html.gz", false},
+		// backups of other wiki are not touched
+		{"backups/ab-20240101_100000.html", true},
+	}
+
+	for _, tt := range tests {
+		if _, err := os.Stat(filepath.Join(dir, tt.name)); (err == nil) != tt.exists {
+			t.Errorf("%s exists: %v, want %v", tt.name, err == nil, tt.exists)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "backups/b-20240101_100000.html"))
+	if err != nil || string(data) != "backups/a-20240101_100000.html" {
+		t.Errorf("renamed backup content %q, error %v", data, err)
+	}
+}
+
+func TestRenameWikiConflict(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir,
+		"a.html",
+		"backups/a-20240101_100000.html",
+		"backups/b-20240101_100000.html",
+	)
+
+	err := renameWiki(filepath.Join(dir, "a.html"), filepath.Join(dir, "b.html"),
+		filepath.Join(dir, "backups", "a.html"), filepath.Join(dir, "backups", "b.html"))
+	if !errors.Is(err, os.ErrExist) {
+		t.Fatalf("renameWiki error %v, want %v", err, os.ErrExist)
+	}
+
+	for _, name := range []string{"a.html", "backups/a-20240101_100000.html"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s renamed despite conflict", name)
+		}
+	}
+}
+
+func TestRenameAllRollback(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "a", "b")
+
+	err := renameAll([]renameOp{
+		{filepath.Join(dir, "a"), filepath.Join(dir, "a2")},
+		{filepath.Join(dir, "b"), filepath.Join(dir, "missing", "b2")},
+	})
+	if err == nil {
+		t.Fatal("renameAll succeeded")
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not restored: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// requestIDMaxLen limit length of IDs accepted from proxies.
+	requestIDMaxLen = 128
+)
+
+// validRequestID check if ID received from proxy is safe to put in logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLen {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withRequestID assign ID to every request and return it in X-Request-ID
+// header. ID sent by trusted proxy is kept, otherwise a random one is
+// generated.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ""
+		if len(trustedProxies) > 0 && containsIP(trustedProxies, net.ParseIP(remoteIP(r))) {
+			if v := r.Header.Get(requestIDHeader); validRequestID(v) {
+				id = v
+			}
+		}
+		if id == "" {
+			id = randomToken(8)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestID return ID of request assigned by withRequestID.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// logf log message prefixed with ID of the request handled in ctx.
+func logf(ctx context.Context, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if id := requestID(ctx); id != "" {
+		msg = "[" + id + "] " + msg
+	}
+
+	_ = log.Output(2, msg)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	defer func(s logSink, p []*net.IPNet) { accessLog, trustedProxies = s, p }(accessLog, trustedProxies)
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	var err error
+	if trustedProxies, err = parseCIDRs("192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := withRequestID(logger(func(w http.ResponseWriter, r *http.Request) {
+		logf(r.Context(), "handling %s", r.URL.Path)
+	}))
+
+	random := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	tests := []struct {
+		remote string
+		header string
+		want   string
+	}{
+		{"198.51.100.1:1000", "", ""},
+		// ID from untrusted client is not used
+		{"198.51.100.1:1000", "proxy-id", ""},
+		{"192.0.2.1:1000", "proxy-id", "proxy-id"},
+		{"192.0.2.1:1000", "bad id", ""},
+	}
+
+	for _, tt := range tests {
+		var accessBuf bytes.Buffer
+		accessLog = &textSink{out: &accessBuf}
+		logBuf.Reset()
+
+		r := httptest.NewRequest(http.MethodGet, "/a.html", nil)
+		r.RemoteAddr = tt.remote
+		if tt.header != "" {
+			r.Header.Set(requestIDHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		id := rec.Header().Get(requestIDHeader)
+		if tt.want != "" && id != tt.want {
+			t.Errorf("%s %q: request ID %q, want %q", tt.remote, tt.header, id, tt.want)
+		}
+		if tt.want == "" && !random.MatchString(id) {
+			t.Errorf("%s %q: request ID %q is not generated", tt.remote, tt.header, id)
+		}
+
+		if !strings.Contains(accessBuf.String(), " "+id+"\n") {
+			t.Errorf("%s %q: request log %q does not contain %q", tt.remote, tt.header, accessBuf.String(), id)
+		}
+		if !strings.Contains(logBuf.String(), "["+id+"] handling /a.html") {
+			t.Errorf("%s %q: log %q does not contain %q", tt.remote, tt.header, logBuf.String(), id)
+		}
+	}
+}
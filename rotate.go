@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	logFile       string
+	logRotateSize byteSize
+	logRotateKeep int
+
+	logRotator *rotatingFile
+)
+
+// rotatingFile is a log file renamed to <name>.1 (older ones are shifted
+// up to <name>.<keep>) once it grows over maxSize.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open log file %s error: %w", r.path, err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.size = f, fi.Size()
+
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// rotateIfNeeded rotate file when it exceeds size limit.
+func (r *rotatingFile) rotateIfNeeded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize <= 0 || r.size < r.maxSize {
+		return
+	}
+
+	if err := r.rotate(); err != nil {
+		log.Printf("rotate log file %s error: %v\n", r.path, err)
+	}
+}
+
+// rotate shift old files and start new one. Caller must hold r.mu.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	if r.keep > 0 {
+		for i := r.keep - 1; i >= 1; i-- {
+			src := fmt.Sprintf("%s.%d", r.path, i)
+			if err := os.Rename(src, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+)
+
+// saverWriter replace response of successful save with {"ok":true}, for
+// TiddlyWiki savers which send "X-Requested-With: TiddlyWiki" and accept
+// only 200 or 204.
+type saverWriter struct {
+	http.ResponseWriter
+	replaced    bool
+	wroteHeader bool
+}
+
+func (s *saverWriter) WriteHeader(code int) {
+	if s.wroteHeader {
+		return
+	}
+	s.wroteHeader = true
+
+	if code != http.StatusCreated && code != http.StatusNoContent {
+		s.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	s.replaced = true
+	s.Header().Del("Content-Length")
+	s.Header().Set("Content-Type", "application/json")
+	s.ResponseWriter.WriteHeader(http.StatusOK)
+	_, _ = s.ResponseWriter.Write([]byte(`{"ok":true}` + "\n"))
+}
+
+func (s *saverWriter) Write(b []byte) (int, error) {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	if s.replaced {
+		// body of WebDAV handler is dropped
+		return len(b), nil
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *saverWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// fromSaver check if request was sent by TiddlyWiki saver.
+func fromSaver(r *http.Request) bool {
+	return r.Header.Get("X-Requested-With") == "TiddlyWiki"
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaverResponse(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "a.html")
+	v := &vhost{davDir: dir}
+	addHandler(&v.handlers, "", dir)
+	h := wikiHandler(v)
+
+	wiki := testWiki("Wiki", `{"title":"A","text":"a"}`)
+
+	tests := []struct {
+		saver    bool
+		wantCode int
+		wantBody string
+	}{
+		{false, http.StatusCreated, "Created"},
+		{true, http.StatusOK, `{"ok":true}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/a.html", bytes.NewReader(wiki))
+		r.Header.Set("Content-Type", "text/html")
+		if tt.saver {
+			r.Header.Set("X-Requested-With", "TiddlyWiki")
+		}
+		rec := httptest.NewRecorder()
+		h(rec, r)
+
+		if rec.Code != tt.wantCode || rec.Body.String() != tt.wantBody {
+			t.Errorf("saver %v: status %d, body %q, want %d, %q", tt.saver, rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+		}
+		if tt.saver && rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("saver %v: Content-Type %q", tt.saver, rec.Header().Get("Content-Type"))
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "a.html")); err != nil || !bytes.Equal(data, wiki) {
+			t.Errorf("saver %v: wiki %q, error %v", tt.saver, data, err)
+		}
+	}
+}
+
+func TestSaverWriterErrors(t *testing.T) {
+	for _, code := range []int{http.StatusOK, http.StatusForbidden, http.StatusInsufficientStorage} {
+		rec := httptest.NewRecorder()
+		w := &saverWriter{ResponseWriter: rec}
+		http.Error(w, http.StatusText(code), code)
+
+		if rec.Code != code || rec.Body.String() != http.StatusText(code)+"\n" {
+			t.Errorf("response %d replaced: status %d, body %q", code, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+)
+
+const (
+	searchPath         = "/search"
+	searchDefaultLimit = 50
+	searchExcerptLen   = 80
+)
+
+type searchResult struct {
+	File    string `json:"file"`
+	Title   string `json:"tiddler_title"`
+	Excerpt string `json:"excerpt"`
+}
+
+// parseQuery split query into lower-cased terms. Text in double quotes is
+// kept as single phrase.
+func parseQuery(q string) []string {
+	var terms []string
+
+	for i, part := range strings.Split(q, `"`) {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+
+		if i%2 == 1 {
+			terms = append(terms, strings.Join(strings.Fields(part), " "))
+			continue
+		}
+
+		terms = append(terms, strings.Fields(part)...)
+	}
+
+	return terms
+}
+
+// matchTiddler check if all terms are found in title or text and return
+// excerpt with first match highlighted.
+func matchTiddler(title, text string, terms []string) (string, bool) {
+	lowTitle, lowText := strings.ToLower(title), strings.ToLower(text)
+	for _, t := range terms {
+		if !strings.Contains(lowTitle, t) && !strings.Contains(lowText, t) {
+			return "", false
+		}
+	}
+
+	// lower-casing may change length of some characters, so highlight only
+	// when positions are safe to use on original text
+	if len(lowText) != len(text) {
+		return html.EscapeString(truncate(text, 2*searchExcerptLen)), true
+	}
+
+	for _, t := range terms {
+		idx := strings.Index(lowText, t)
+		if idx < 0 {
+			continue
+		}
+
+		start, end := idx-searchExcerptLen, idx+len(t)+searchExcerptLen
+		if start < 0 {
+			start = 0
+		}
+		if end > len(text) {
+			end = len(text)
+		}
+		for start > 0 && !utf8.RuneStart(text[start]) {
+			start--
+		}
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+
+		excerpt := html.EscapeString(text[start:idx]) + "<mark>" +
+			html.EscapeString(text[idx:idx+len(t)]) + "</mark>" +
+			html.EscapeString(text[idx+len(t):end])
+		if start > 0 {
+			excerpt = "…" + excerpt
+		}
+		if end < len(text) {
+			excerpt += "…"
+		}
+
+		return excerpt, true
+	}
+
+	return html.EscapeString(truncate(text, 2*searchExcerptLen)), true
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n] + "…"
+}
+
+// searchWiki stream wiki file through HTML tokenizer and report tiddlers
+// matching terms. Both old style store area (`<div title="...">`) and JSON
+// tiddler store used by TiddlyWiki 5.2+ are supported.
+func searchWiki(r io.Reader, terms []string, found func(title, excerpt string) bool) error {
+	z := xhtml.NewTokenizer(bufio.NewReader(r))
+
+	var (
+		title     string
+		text      strings.Builder
+		depth     int
+		jsonStore bool
+	)
+
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		case xhtml.StartTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+
+			if depth > 0 {
+				if tag == "div" {
+					depth++
+				}
+				continue
+			}
+
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+
+			switch {
+			case tag == "script" && strings.Contains(attrs["class"], "tiddlywiki-tiddler-store"):
+				jsonStore = true
+			case tag == "div" && (attrs["data-title"] != "" || attrs["title"] != ""):
+				title = attrs["data-title"]
+				if title == "" {
+					title = attrs["title"]
+				}
+				text.Reset()
+				depth = 1
+			}
+		case xhtml.EndTagToken:
+			name, _ := z.TagName()
+			if depth == 0 || string(name) != "div" {
+				continue
+			}
+
+			depth--
+			if depth == 0 {
+				if excerpt, ok := matchTiddler(title, text.String(), terms); ok && !found(title, excerpt) {
+					return nil
+				}
+			}
+		case xhtml.TextToken:
+			if jsonStore {
+				jsonStore = false
+
+				var tiddlers []map[string]interface{}
+				if err := json.Unmarshal(z.Text(), &tiddlers); err != nil {
+					continue
+				}
+
+				for _, t := range tiddlers {
+					tTitle, _ := t["title"].(string)
+					tText, _ := t["text"].(string)
+					if excerpt, ok := matchTiddler(tTitle, tText, terms); ok && !found(tTitle, excerpt) {
+						return nil
+					}
+				}
+			} else if depth > 0 {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+// serveSearch search all wikis of user. Caller must authenticate request and
+// hold handler lock.
+func serveSearch(w http.ResponseWriter, r *http.Request, req *apiRequest) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	terms := parseQuery(r.URL.Query().Get("q"))
+	if len(terms) == 0 {
+		jsonError(w, http.StatusBadRequest, "missing query")
+		return
+	}
+
+	limit := searchDefaultLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			jsonError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	bDir := userBackupDir(req.site, req.user)
+	results := []searchResult{}
+
+	err := filepath.WalkDir(req.userPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if p == bDir && p != req.userPath {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(p, ".html") {
+			return nil
+		}
+
+		if req.wikiAccess(r, p) != 0 {
+			// skip wikis protected by own password
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		rel, _ := filepath.Rel(req.userPath, p)
+		_ = searchWiki(f, terms, func(title, excerpt string) bool {
+			results = append(results, searchResult{File: rel, Title: title, Excerpt: excerpt})
+			return len(results) < limit
+		})
+
+		if len(results) >= limit {
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// defaultCSP allow inline and eval'ed scripts required by TiddlyWiki, but
+// only from the same origin; images may be embedded from anywhere.
+const defaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: blob: https:; " +
+	"font-src 'self' data:; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'self'"
+
+var (
+	securityHeaders bool
+	securityCSP     string
+)
+
+// securityWriter add security headers to HTML responses.
+type securityWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (s *securityWriter) WriteHeader(code int) {
+	if !s.wroteHeader {
+		h := s.Header()
+		if strings.HasPrefix(h.Get("Content-Type"), "text/html") {
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+			h.Set("Referrer-Policy", "same-origin")
+			h.Set("Content-Security-Policy", securityCSP)
+		}
+	}
+	s.wroteHeader = true
+
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *securityWriter) Write(b []byte) (int, error) {
+	if !s.wroteHeader {
+		// content type is detected after WriteHeader, so it must be known now
+		if s.Header().Get("Content-Type") == "" {
+			s.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		s.WriteHeader(http.StatusOK)
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *securityWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// withSecurityHeaders add security headers to HTML pages; responses to
+// WebDAV methods are not changed.
+func withSecurityHeaders(next http.Handler) http.Handler {
+	if !securityHeaders {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodPost:
+			next.ServeHTTP(&securityWriter{ResponseWriter: w}, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
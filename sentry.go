@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Errors reported to Sentry with its envelope endpoint, so no Sentry SDK
+// is needed. Only server errors (5xx) and panics are reported.
+
+const (
+	sentryQueueSize   = 100
+	sentrySendTimeout = 10 * time.Second
+)
+
+var (
+	sentryDSN string
+	reporter  *sentryReporter
+)
+
+type sentryReporter struct {
+	url    string
+	auth   string
+	client *http.Client
+	events chan map[string]any
+}
+
+// newSentryReporter parse DSN in form https://<key>@<host>/<project>.
+func newSentryReporter(dsn string) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse sentry dsn error: %w", err)
+	}
+
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid sentry dsn %q", dsn)
+	}
+
+	// project may be prefixed by path of Sentry installation
+	prefix := ""
+	if idx := strings.LastIndex(project, "/"); idx >= 0 {
+		prefix, project = "/"+project[:idx], project[idx+1:]
+	}
+
+	return &sentryReporter{
+		url: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=widdler/%s",
+			u.User.Username(), build),
+		client: &http.Client{Timeout: sentrySendTimeout},
+		events: make(chan map[string]any, sentryQueueSize),
+	}, nil
+}
+
+// report queue event for r; events are dropped when Sentry can not keep up.
+func (s *sentryReporter) report(r *http.Request, h http.Header, code int, message string) {
+	tags := map[string]string{
+		"http.method":      r.Method,
+		"http.status_code": fmt.Sprint(code),
+	}
+	if wiki := wikiName(r); wiki != "" {
+		tags["wiki"] = wiki
+	}
+
+	event := map[string]any{
+		"event_id":  randomToken(16),
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		"platform":  "go",
+		"level":     "error",
+		"logger":    "widdler",
+		"message":   map[string]string{"formatted": message},
+		"tags":      tags,
+		"request": map[string]any{
+			"method": r.Method,
+			"url":    r.URL.Path,
+		},
+	}
+
+	if build != "" {
+		event["release"] = "widdler@" + build
+	}
+	if id := h.Get(requestIDHeader); id != "" {
+		tags["request_id"] = id
+	}
+	if m := traceparentRe.FindStringSubmatch(traceparent(r.Context())); m != nil {
+		event["contexts"] = map[string]any{
+			"trace": map[string]string{"trace_id": m[1], "span_id": m[2]},
+		}
+	}
+
+	select {
+	case s.events <- event:
+	default:
+	}
+}
+
+func (s *sentryReporter) run() {
+	for event := range s.events {
+		s.send(event)
+	}
+}
+
+// flush send queued events.
+func (s *sentryReporter) flush() {
+	for {
+		select {
+		case event := <-s.events:
+			s.send(event)
+		default:
+			return
+		}
+	}
+}
+
+func (s *sentryReporter) send(event map[string]any) {
+	item, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("send sentry event error: %v\n", err)
+		return
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "{\"event_id\":%q}\n{\"type\":\"event\",\"length\":%d}\n", event["event_id"], len(item))
+	body.Write(item)
+	body.WriteString("\n")
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		log.Printf("send sentry event error: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		log.Printf("send sentry event error: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		log.Printf("send sentry event error: %s\n", resp.Status)
+	}
+}
+
+// withErrorReporting report server errors and panics of handlers to Sentry.
+func withErrorReporting(next http.Handler) http.Handler {
+	if reporter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				reporter.report(r, w.Header(), http.StatusInternalServerError, fmt.Sprintf("panic: %v\n\n%s", p, debug.Stack()))
+				logf(r.Context(), "panic serving %s: %v\n", r.URL.Path, p)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if sw.code >= http.StatusInternalServerError {
+				reporter.report(r, w.Header(), sw.code, fmt.Sprintf("%s %s: %d %s", r.Method, r.URL.Path, sw.code, http.StatusText(sw.code)))
+			}
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// startTelemetry start exporters configured by -otel.endpoint and
+// -sentry.dsn.
+func startTelemetry() error {
+	if otelEndpoint != "" {
+		tracer = newTraceExporter(otelEndpoint)
+		go tracer.run()
+		log.Printf("Exporting traces to %s\n", tracer.url)
+	}
+
+	if sentryDSN != "" {
+		r, err := newSentryReporter(sentryDSN)
+		if err != nil {
+			return err
+		}
+		reporter = r
+		go reporter.run()
+		log.Println("Reporting errors to Sentry")
+	}
+
+	return nil
+}
+
+// flushTelemetry send spans and events not yet exported.
+func flushTelemetry() {
+	if tracer != nil {
+		tracer.flush()
+	}
+	if reporter != nil {
+		reporter.flush()
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func runningAsService() bool {
+	return false
+}
+
+func startService() {}
+
+func stopService(int) {}
+
+func controlService(string) error {
+	return errors.New("-service is only supported on Windows")
+}
@@ -0,0 +1,182 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "widdler"
+
+var (
+	// serviceStopped receive exit code of the server when it stops.
+	serviceStopped = make(chan int, 1)
+	// serviceFinished is closed when service manager was told about exit.
+	serviceFinished = make(chan struct{})
+)
+
+type service struct{}
+
+// Execute report service state to service manager and turn stop requests
+// into graceful shutdown.
+func (service) Execute(_ []string, reqs <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case code := <-serviceStopped:
+			status <- svc.Status{State: svc.StopPending}
+			return code != 0, uint32(code)
+		case c := <-reqs:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stopRequests <- syscall.SIGTERM
+			}
+		}
+	}
+}
+
+// eventLogWriter send log lines to Windows Event Log.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (e *eventLogWriter) Write(p []byte) (int, error) {
+	if err := e.elog.Info(1, strings.TrimSpace(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// runningAsService report if widdler was started by service manager.
+func runningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// startService redirect log to Event Log and start talking to service
+// manager.
+func startService() {
+	if elog, err := eventlog.Open(serviceName); err == nil {
+		log.SetFlags(0)
+		log.SetOutput(&eventLogWriter{elog: elog})
+	}
+
+	go func() {
+		if err := svc.Run(serviceName, service{}); err != nil {
+			log.Printf("run service error: %v\n", err)
+		}
+		close(serviceFinished)
+	}()
+}
+
+// stopService tell service manager that server stopped with code.
+func stopService(code int) {
+	if !runningAsService() {
+		return
+	}
+
+	serviceStopped <- code
+	select {
+	case <-serviceFinished:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// serviceArgs return command line of widdler without -service flag.
+func serviceArgs() []string {
+	var args []string
+	for i := 1; i < len(os.Args); i++ {
+		a := os.Args[i]
+		switch {
+		case a == "-service" || a == "--service":
+			i++
+		case strings.HasPrefix(a, "-service=") || strings.HasPrefix(a, "--service="):
+		default:
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// controlService install, uninstall, start or stop widdler service.
+func controlService(cmd string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager error: %w", err)
+	}
+	defer m.Disconnect()
+
+	if cmd == "install" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		exe, err = filepath.Abs(exe)
+		if err != nil {
+			return err
+		}
+
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "widdler",
+			Description: "TiddlyWiki server",
+			StartType:   mgr.StartAutomatic,
+		}, serviceArgs()...)
+		if err != nil {
+			return fmt.Errorf("install service error: %w", err)
+		}
+		defer s.Close()
+
+		err = eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info)
+		if err != nil {
+			_ = s.Delete()
+			return fmt.Errorf("install event log source error: %w", err)
+		}
+
+		log.Printf("Service %s installed\n", serviceName)
+		return nil
+	}
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("open service %s error: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	switch cmd {
+	case "start":
+		err = s.Start()
+	case "stop":
+		_, err = s.Control(svc.Stop)
+	case "uninstall":
+		err = s.Delete()
+		if err == nil {
+			err = eventlog.Remove(serviceName)
+		}
+	default:
+		return fmt.Errorf("invalid -service %q: use install, uninstall, start or stop", cmd)
+	}
+	if err != nil {
+		return fmt.Errorf("%s service error: %w", cmd, err)
+	}
+
+	log.Printf("Service %s: %s done\n", serviceName, cmd)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// service lifecycle functions used by main
+var (
+	_ svc.Handler        = service{}
+	_ func() bool        = runningAsService
+	_ func()             = startService
+	_ func(int)          = stopService
+	_ func(string) error = controlService
+	_ io.Writer          = (*eventLogWriter)(nil)
+)
+
+func TestServiceArgs(t *testing.T) {
+	defer func(a []string) { os.Args = a }(os.Args)
+
+	os.Args = []string{"widdler.exe", "-service", "install", "-http", ":8080", "-service=start", "--service", "stop", "-dir", `C:\wikis`}
+	if got := strings.Join(serviceArgs(), " "); got != `-http :8080 -dir C:\wikis` {
+		t.Errorf("serviceArgs() = %q", got)
+	}
+}
+
+func TestServiceExecute(t *testing.T) {
+	reqs := make(chan svc.ChangeRequest)
+	status := make(chan svc.Status, 10)
+	done := make(chan uint32, 1)
+
+	go func() {
+		_, code := service{}.Execute(nil, reqs, status)
+		done <- code
+	}()
+
+	reqs <- svc.ChangeRequest{Cmd: svc.Stop}
+	select {
+	case sig := <-stopRequests:
+		if sig != syscall.SIGTERM {
+			t.Errorf("stop request %v, want %v", sig, syscall.SIGTERM)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop not requested")
+	}
+
+	serviceStopped <- 1
+	if code := <-done; code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+
+	var states []svc.State
+	for len(status) > 0 {
+		states = append(states, (<-status).State)
+	}
+	want := []svc.State{svc.StartPending, svc.Running, svc.StopPending, svc.StopPending}
+	if len(states) != len(want) {
+		t.Fatalf("states %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("states %v, want %v", states, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookie = "widdler_session"
+	logoutPath    = "/auth/logout"
+)
+
+var (
+	authSession bool
+	// sessions map session token to sessionEntry.
+	sessions sync.Map
+)
+
+type sessionEntry struct {
+	user    string
+	expires time.Time
+}
+
+// wantsSession check if request come from a browser, which will keep the
+// cookie; other clients would create new session on every request.
+func wantsSession(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// createSession store new session of user and set its cookie.
+func createSession(w http.ResponseWriter, r *http.Request, user string) {
+	now := time.Now()
+	sessions.Range(func(k, v any) bool {
+		if now.After(v.(sessionEntry).expires) {
+			sessions.Delete(k)
+		}
+		return true
+	})
+
+	token := randomToken(16)
+	expires := now.Add(sessionTTL)
+	sessions.Store(token, sessionEntry{user: user, expires: expires})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    signValue(token),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sessionToken return token from valid session cookie.
+func sessionToken(r *http.Request) (string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	token, err := verifyValue(c.Value)
+	if err != nil {
+		return "", false
+	}
+
+	return token, true
+}
+
+// sessionUser return user of valid, not expired session.
+func sessionUser(r *http.Request) (string, bool) {
+	token, ok := sessionToken(r)
+	if !ok {
+		return "", false
+	}
+
+	v, ok := sessions.Load(token)
+	if !ok {
+		return "", false
+	}
+
+	s := v.(sessionEntry)
+	if time.Now().After(s.expires) {
+		sessions.Delete(token)
+		return "", false
+	}
+
+	return s.user, true
+}
+
+// sessionCredentials return user of valid session still present in
+// .htpasswd. Password, needed for per-wiki passwords, is taken from Basic
+// auth when browser send it.
+func (v *vhost) sessionCredentials(r *http.Request) (string, string, bool) {
+	user, ok := sessionUser(r)
+	if !ok {
+		return "", "", false
+	}
+
+	if _, ok := v.lookupUser(user); !ok {
+		return "", "", false
+	}
+
+	pass := ""
+	if u, p, ok := r.BasicAuth(); ok && u == user {
+		pass = p
+	}
+
+	return user, pass, true
+}
+
+// logoutHandler invalidate session and remove its cookie.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if token, ok := sessionToken(r); ok {
+		if v, ok := sessions.LoadAndDelete(token); ok {
+			log.Printf("user %s logged out\n", v.(sessionEntry).user)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, prefixed("/"), http.StatusFound)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sharePrefix         = "/s/"
+	shareExpireInterval = time.Minute
+)
+
+var (
+	shareMaxTTL = dayDuration(7 * 24 * time.Hour)
+
+	sharesMu   sync.Mutex
+	shares     = make(map[string]*shareLink)
+	sharesOnce sync.Once
+)
+
+// shareLink give read-only access to one wiki without authentication.
+type shareLink struct {
+	user     string
+	wiki     string
+	fullPath string
+	expires  time.Time
+}
+
+// expireShares remove expired links periodically.
+func expireShares() {
+	for range time.Tick(shareExpireInterval) {
+		now := time.Now()
+
+		sharesMu.Lock()
+		for token, s := range shares {
+			if now.After(s.expires) {
+				delete(shares, token)
+			}
+		}
+		sharesMu.Unlock()
+	}
+}
+
+// addShare create signed token for wiki valid for ttl.
+func addShare(user, wiki, fullPath string, ttl time.Duration) (string, time.Time) {
+	sharesOnce.Do(func() { go expireShares() })
+
+	expires := time.Now().Add(ttl)
+	token := signValue(fmt.Sprintf("%s:%s:%d", user, wiki, expires.Unix()))
+
+	sharesMu.Lock()
+	shares[token] = &shareLink{user: user, wiki: wiki, fullPath: fullPath, expires: expires}
+	sharesMu.Unlock()
+
+	return token, expires
+}
+
+// findShare return valid, not expired link for token.
+func findShare(token string) *shareLink {
+	if _, err := verifyValue(token); err != nil {
+		return nil
+	}
+
+	sharesMu.Lock()
+	defer sharesMu.Unlock()
+
+	s, ok := shares[token]
+	if !ok || time.Now().After(s.expires) {
+		return nil
+	}
+
+	return s
+}
+
+// serveShare handle POST /api/v1/wikis/<wiki>/share: create link to the
+// wiki with lifetime from optional {"ttl": "24h"} body, capped by
+// -share.max-ttl.
+func serveShare(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	fullPath := resolveWiki(req.userPath, wiki)
+	if fullPath == "" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if code := req.wikiAccess(r, fullPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	if _, err := os.Stat(fullPath); err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+
+	var body struct {
+		TTL string `json:"ttl"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ttl := shareMaxTTL
+	if body.TTL != "" {
+		var d dayDuration
+		if err := d.Set(body.TTL); err != nil || d <= 0 {
+			jsonError(w, http.StatusBadRequest, "invalid ttl")
+			return
+		}
+		ttl = min(d, shareMaxTTL)
+	}
+
+	token, expires := addShare(req.user, wiki, fullPath, time.Duration(ttl))
+	log.Printf("user %s shared %s until %s\n", req.user, wiki, expires.Format(time.RFC3339))
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"url":        prefixed(sharePrefix) + token + "/" + strings.TrimPrefix(wiki, "/"),
+		"expires_at": expires.UTC(),
+	})
+}
+
+// shareHandler serve wikis by links created with serveShare: /s/<token>/<wiki>.
+func shareHandler(w http.ResponseWriter, r *http.Request) {
+	token, wiki, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, sharePrefix), "/")
+
+	s := findShare(token)
+	if s == nil || wiki != strings.TrimPrefix(s.wiki, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := os.Open(s.fullPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, filepath.Base(s.fullPath), fi.ModTime(), f)
+}
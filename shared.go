@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+const sharedPrefix = "shared/"
+
+var (
+	sharedDir       string
+	sharedUsersSpec string
+
+	// sharedSite serve wikis from -shared.dir; nil when disabled
+	sharedSite  *vhost
+	sharedUsers map[string]bool
+)
+
+// setupShared prepare handler of shared wikis. Without authentication all
+// wikis are already shared, so -shared.dir is ignored.
+func setupShared() {
+	if sharedDir == "" {
+		return
+	}
+
+	if auth == "none" {
+		log.Println("-shared.dir ignored without authentication")
+		return
+	}
+
+	sharedUsers = make(map[string]bool)
+	for _, u := range strings.Split(sharedUsersSpec, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			sharedUsers[u] = true
+		}
+	}
+
+	sharedSite = &vhost{name: "shared", davDir: sharedDir, auth: auth}
+	addHandler(&sharedSite.handlers, "", sharedDir)
+
+	log.Printf("Shared wikis directory: %s\n", sharedDir)
+}
+
+// sharedAllowed check if user can access shared wikis: all authenticated
+// users unless -shared.users is given.
+func sharedAllowed(user string) bool {
+	return user != "" && (len(sharedUsers) == 0 || sharedUsers[user])
+}
+
+// sharedRequest return copy of request for shared wiki with /shared prefix
+// removed from path.
+func sharedRequest(v *vhost, r *http.Request) (*http.Request, bool) {
+	if sharedSite == nil || v != defaultVhost {
+		return nil, false
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/"+sharedPrefix)
+	if !ok {
+		if r.URL.Path != "/shared" {
+			return nil, false
+		}
+		rest = ""
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + rest
+	r2.URL.RawPath = ""
+
+	return r2, true
+}
+
+// sharedWikis return names of shared wikis, with the shared/ prefix.
+func sharedWikis() []string {
+	wikis, err := listUserWikis(sharedDir)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	names := make([]string, 0, len(wikis))
+	for _, wi := range wikis {
+		names = append(names, sharedPrefix+wi.Name)
+	}
+
+	return names
+}
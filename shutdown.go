@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// drainHandlers wait until all ongoing writes release user handlers locks.
+func drainHandlers(ctx context.Context) bool {
+	drained := make(chan struct{})
+
+	go func() {
+		for _, v := range allVhosts() {
+			v.handlers.mu.RLock()
+			for _, h := range v.handlers.list {
+				h.mu.Lock()
+				//nolint:staticcheck // only wait for the current holder
+				h.mu.Unlock()
+			}
+			v.handlers.mu.RUnlock()
+		}
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// stopRequests stop server like a signal, e.g. on request of Windows
+// service manager.
+var stopRequests = make(chan os.Signal, 1)
+
+// shutdownOnSignal stop server on SIGINT, SIGTERM or stop request and report exit code
+// to done: 0 when all requests finished within timeout, 1 otherwise.
+func shutdownOnSignal(s *http.Server, timeout time.Duration, done chan<- int) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	var received os.Signal
+	select {
+	case received = <-sig:
+	case received = <-stopRequests:
+	}
+	log.Printf("Received %s, shutting down (timeout %s)\n", received, timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		log.Printf("shutdown error: %v\n", err)
+		done <- 1
+		return
+	}
+
+	if !drainHandlers(ctx) {
+		log.Println("shutdown error: timeout waiting for writes")
+		done <- 1
+		return
+	}
+
+	if !stopBackupWorkers(ctx) {
+		log.Println("shutdown error: timeout waiting for backups")
+		done <- 1
+		return
+	}
+
+	log.Println("Shutdown complete")
+	done <- 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownOnSignal(t *testing.T) {
+	defer func(v *vhost) { defaultVhost = v }(defaultVhost)
+	defaultVhost = &vhost{}
+
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		timeout  time.Duration
+		wantExit int
+	}{
+		{"slow PUT finishes", 300 * time.Millisecond, 5 * time.Second, 0},
+		{"timeout", time.Second, 100 * time.Millisecond, 1},
+	}
+
+	for _, tt := range tests {
+		started := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(tt.delay)
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		done := make(chan int, 1)
+		go shutdownOnSignal(ts.Config, tt.timeout, done)
+
+		status := make(chan int, 1)
+		go func() {
+			req, _ := http.NewRequest(http.MethodPut, ts.URL+"/a.html", strings.NewReader("wiki"))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				status <- 0
+				return
+			}
+			resp.Body.Close()
+			status <- resp.StatusCode
+		}()
+
+		<-started
+		stopRequests <- syscall.SIGTERM
+
+		if code := <-done; code != tt.wantExit {
+			t.Errorf("%s: exit code %d, want %d", tt.name, code, tt.wantExit)
+		}
+		if code := <-status; tt.wantExit == 0 && code != http.StatusCreated {
+			t.Errorf("%s: PUT status %d, want %d", tt.name, code, http.StatusCreated)
+		}
+
+		ts.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const staticPrefix = "/static/"
+
+var (
+	staticDir    string
+	staticPublic bool
+)
+
+// staticEncodings are pre-compressed variants of static files, in order of
+// preference.
+var staticEncodings = []struct {
+	name, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// isStaticRequest check if request is for asset from -static directory.
+func isStaticRequest(r *http.Request) bool {
+	return staticDir != "" && strings.HasPrefix(r.URL.Path, staticPrefix)
+}
+
+// staticHandler serve files from -static directory under /static/; .br and
+// .gz files next to them are served to clients accepting such encoding.
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, staticPrefix))
+	fullPath := filepath.Join(staticDir, filepath.FromSlash(name))
+
+	fi, err := os.Stat(fullPath)
+	if err != nil || !fi.Mode().IsRegular() {
+		// directories are not listed
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	if staticPublic {
+		h.Set("Cache-Control", "public, max-age=86400")
+	} else {
+		h.Set("Cache-Control", "private, max-age=86400")
+	}
+	h.Add("Vary", "Accept-Encoding")
+
+	for _, enc := range staticEncodings {
+		if !acceptsEncoding(r, enc.name) {
+			continue
+		}
+
+		encfi, err := os.Stat(fullPath + enc.ext)
+		if err != nil || !encfi.Mode().IsRegular() || encfi.ModTime().Before(fi.ModTime()) {
+			continue
+		}
+
+		f, err := os.Open(fullPath + enc.ext)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		ctype := mime.TypeByExtension(filepath.Ext(fullPath))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+
+		h.Set("Content-Type", ctype)
+		h.Set("Content-Encoding", enc.name)
+		h.Set("ETag", fileETag(encfi))
+		if r.Header.Get("Range") == "" {
+			// ServeContent does not set length of encoded content
+			h.Set("Content-Length", strconv.FormatInt(encfi.Size(), 10))
+		}
+
+		http.ServeContent(w, r, filepath.Base(fullPath), encfi.ModTime(), f)
+		return
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	h.Set("ETag", fileETag(fi))
+	http.ServeContent(w, r, filepath.Base(fullPath), fi.ModTime(), f)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// storeExt is extension of file next to wiki with key-value data of its
+// plugins.
+const storeExt = ".store.json"
+
+const (
+	storeCacheTTL  = 5 * time.Second
+	storeValueSize = 64 << 10
+	// storeMaxKeys and storeMaxSize limit number of keys and size of
+	// store file of one wiki.
+	storeMaxKeys = 1000
+	storeMaxSize = 4 << 20
+)
+
+var (
+	storeKeyRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,128}$`)
+	// storeCache map store file to cached storeEntry.
+	storeCache sync.Map
+)
+
+type storeEntry struct {
+	values   map[string]string
+	loadedAt time.Time
+}
+
+// loadStore return content of store file; missing file is an empty store.
+func loadStore(fname string) (map[string]string, error) {
+	if e, ok := storeCache.Load(fname); ok && time.Since(e.(*storeEntry).loadedAt) < storeCacheTTL {
+		return e.(*storeEntry).values, nil
+	}
+
+	values := make(map[string]string)
+
+	data, err := os.ReadFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("parse %s error: %w", fname, err)
+		}
+	}
+
+	storeCache.Store(fname, &storeEntry{values: values, loadedAt: time.Now()})
+
+	return values, nil
+}
+
+// saveStore atomically replace store file with values encoded as data.
+func saveStore(fname string, values map[string]string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fname), ".store-*")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fname)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write %s error: %w", fname, err)
+	}
+
+	storeCache.Store(fname, &storeEntry{values: values, loadedAt: time.Now()})
+
+	return nil
+}
+
+// serveStore handle GET, PUT and DELETE of /api/v1/wikis/<wiki>/store/<key>:
+// values are plain strings kept in <wiki>.store.json.
+func serveStore(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki, key string) {
+	if !storeKeyRe.MatchString(key) {
+		jsonError(w, http.StatusBadRequest, "invalid key")
+		return
+	}
+
+	fullPath := resolveWiki(req.userPath, wiki)
+	if fullPath == "" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if _, err := os.Stat(fullPath); err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+
+	if code := req.wikiAccess(r, fullPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	fname := fullPath + storeExt
+	values, err := loadStore(fname)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		value, ok := values[key]
+		if !ok {
+			jsonError(w, http.StatusNotFound, "key not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, value)
+		return
+	case http.MethodPut, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if isReadOnly(fullPath) {
+		jsonError(w, http.StatusMethodNotAllowed, "wiki is read-only")
+		return
+	}
+
+	// cached map is shared with readers, so changes are made on a copy
+	updated := make(map[string]string, len(values)+1)
+	for k, v := range values {
+		updated[k] = v
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, ok := updated[key]; !ok {
+			jsonError(w, http.StatusNotFound, "key not found")
+			return
+		}
+		delete(updated, key)
+	} else {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, storeValueSize))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				jsonError(w, http.StatusRequestEntityTooLarge, "value too large")
+				return
+			}
+			jsonError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		updated[key] = string(data)
+	}
+
+	if len(updated) > storeMaxKeys {
+		jsonError(w, http.StatusInsufficientStorage, "too many keys")
+		return
+	}
+
+	data, err := json.Marshal(updated)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(data) > storeMaxSize {
+		jsonError(w, http.StatusInsufficientStorage, "store too large")
+		return
+	}
+
+	over, err := req.handler.exceedsQuota(req.userPath, fname, int64(len(data)))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if over && r.Method == http.MethodPut {
+		jsonError(w, http.StatusInsufficientStorage, "quota exceeded")
+		return
+	}
+
+	if err := saveStore(fname, updated, data); err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	req.handler.invalidateUsage()
+
+	w.WriteHeader(http.StatusNoContent)
+}
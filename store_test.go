@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreLimits(t *testing.T) {
+	writeStore := func(t *testing.T, dir string, keys, size int) {
+		t.Helper()
+
+		values := make(map[string]string, keys)
+		for i := 0; i < keys; i++ {
+			values[fmt.Sprintf("key%d", i)] = strings.Repeat("v", size)
+		}
+		data, err := json.Marshal(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.html"+storeExt), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		keys   int
+		size   int
+		quota  string
+		method string
+		key    string
+		value  int
+		want   int
+	}{
+		{"new key", storeMaxKeys - 1, 1, "", http.MethodPut, "new", 1, http.StatusNoContent},
+		{"too many keys", storeMaxKeys, 1, "", http.MethodPut, "new", 1, http.StatusInsufficientStorage},
+		{"existing key with max keys", storeMaxKeys, 1, "", http.MethodPut, "key1", 1, http.StatusNoContent},
+		{"delete with max keys", storeMaxKeys, 1, "", http.MethodDelete, "key1", 0, http.StatusNoContent},
+		{"store size", 65, 64000, "", http.MethodPut, "new", 1000, http.StatusNoContent},
+		{"store too large", 65, 64000, "", http.MethodPut, "new", 64000, http.StatusInsufficientStorage},
+		{"within quota", 0, 0, "2000", http.MethodPut, "new", 1000, http.StatusNoContent},
+		{"quota exceeded", 0, 0, "2000", http.MethodPut, "new", 3000, http.StatusInsufficientStorage},
+		{"delete over quota", 1, 3000, "2000", http.MethodDelete, "key0", 0, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeTestFiles(t, dir, "a.html")
+		if tt.keys > 0 {
+			writeStore(t, dir, tt.keys, tt.size)
+		}
+		if tt.quota != "" {
+			if err := os.WriteFile(filepath.Join(dir, ".quota"), []byte(tt.quota), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		v := &vhost{davDir: dir}
+		addHandler(&v.handlers, "", dir)
+
+		r := httptest.NewRequest(tt.method, "/api/v1/wikis/a.html/store/"+tt.key, strings.NewReader(strings.Repeat("x", tt.value)))
+		rec := httptest.NewRecorder()
+		wikiHandler(v)(rec, r)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+
+		values, err := loadStore(filepath.Join(dir, "a.html"+storeExt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, stored := values[tt.key]
+		if want := tt.want == http.StatusNoContent; tt.method == http.MethodPut && stored != want {
+			t.Errorf("%s: key stored %v, want %v", tt.name, stored, want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request tracing exported with OTLP/HTTP in JSON encoding, so no
+// OpenTelemetry SDK is needed. Spans are sent in batches to
+// <-otel.endpoint>/v1/traces.
+
+const (
+	traceBatchSize     = 100
+	traceFlushInterval = 5 * time.Second
+	traceQueueSize     = 1000
+	traceExportTimeout = 10 * time.Second
+
+	// OTLP span kind and status codes.
+	spanKindServer  = 2
+	spanStatusError = 2
+)
+
+var (
+	otelEndpoint string
+
+	traceparentRe = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+	tracer        *traceExporter
+)
+
+type otlpValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	IntValue    string `json:"intValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr  `json:"attributes,omitempty"`
+	Events            []otlpEvent `json:"events,omitempty"`
+	Status            otlpStatus  `json:"status"`
+}
+
+func stringAttr(key, value string) otlpAttr {
+	return otlpAttr{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func intAttr(key string, value int) otlpAttr {
+	return otlpAttr{Key: key, Value: otlpValue{IntValue: strconv.Itoa(value)}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// traceExporter queue finished spans and send them in batches.
+type traceExporter struct {
+	url    string
+	client *http.Client
+	spans  chan otlpSpan
+
+	mu    sync.Mutex
+	batch []otlpSpan
+}
+
+func newTraceExporter(endpoint string) *traceExporter {
+	return &traceExporter{
+		url:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: traceExportTimeout},
+		spans:  make(chan otlpSpan, traceQueueSize),
+	}
+}
+
+// add queue span; spans are dropped when exporter can not keep up.
+func (e *traceExporter) add(s otlpSpan) {
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+func (e *traceExporter) run() {
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case s := <-e.spans:
+			e.mu.Lock()
+			e.batch = append(e.batch, s)
+			full := len(e.batch) >= traceBatchSize
+			e.mu.Unlock()
+
+			if full {
+				e.flush()
+			}
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+// flush send queued spans to collector.
+func (e *traceExporter) flush() {
+	for {
+		select {
+		case s := <-e.spans:
+			e.mu.Lock()
+			e.batch = append(e.batch, s)
+			e.mu.Unlock()
+			continue
+		default:
+		}
+		break
+	}
+
+	e.mu.Lock()
+	batch := e.batch
+	e.batch = nil
+	e.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	resource := []otlpAttr{stringAttr("service.name", "widdler")}
+	if build != "" {
+		resource = append(resource, stringAttr("service.version", build))
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "widdler"},
+				"spans": batch,
+			}},
+		}},
+	})
+	if err != nil {
+		log.Printf("export traces error: %v\n", err)
+		return
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("export traces error: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		log.Printf("export traces error: %s\n", resp.Status)
+	}
+}
+
+// parseTraceparent return trace and parent span IDs from W3C traceparent
+// header; empty when header is missing or invalid.
+func parseTraceparent(h string) (string, string) {
+	m := traceparentRe.FindStringSubmatch(strings.TrimSpace(h))
+	if m == nil || m[1] == strings.Repeat("0", 32) || m[2] == strings.Repeat("0", 16) {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// wikiName return name of wiki requested by r, if any.
+func wikiName(r *http.Request) string {
+	if strings.HasSuffix(r.URL.Path, ".html") {
+		return path.Base(r.URL.Path)
+	}
+	return ""
+}
+
+type traceKey struct{}
+
+// traceparent return W3C traceparent of span serving request, to be passed
+// to other services.
+func traceparent(ctx context.Context) string {
+	s, _ := ctx.Value(traceKey{}).(string)
+	return s
+}
+
+// tracingTransport pass traceparent of served request to called services,
+// so their spans join the trace.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if tp := traceparent(req.Context()); tp != "" && req.Header.Get("traceparent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("traceparent", tp)
+	}
+
+	return base.RoundTrip(req)
+}
+
+// withTracing record span of every request; context of caller is taken from
+// traceparent header.
+func withTracing(next http.Handler) http.Handler {
+	if otelEndpoint == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		traceID, parentID := parseTraceparent(r.Header.Get("traceparent"))
+		if traceID == "" {
+			traceID = randomToken(16)
+		}
+		spanID := randomToken(8)
+
+		ctx := context.WithValue(r.Context(), traceKey{}, fmt.Sprintf("00-%s-%s-01", traceID, spanID))
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		end := time.Now()
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            spanID,
+			ParentSpanID:      parentID,
+			Name:              r.Method,
+			Kind:              spanKindServer,
+			StartTimeUnixNano: unixNano(start),
+			EndTimeUnixNano:   unixNano(end),
+			Attributes: []otlpAttr{
+				stringAttr("http.request.method", r.Method),
+				stringAttr("url.path", r.URL.Path),
+				intAttr("http.response.status_code", sw.code),
+			},
+		}
+		if wiki := wikiName(r); wiki != "" {
+			span.Attributes = append(span.Attributes, stringAttr("widdler.wiki", wiki))
+		}
+
+		if sw.code < 200 || sw.code >= http.StatusMultipleChoices {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: unixNano(end),
+				Name:         "error",
+				Attributes:   []otlpAttr{intAttr("http.response.status_code", sw.code)},
+			})
+		}
+		if sw.code >= http.StatusInternalServerError {
+			span.Status = otlpStatus{Code: spanStatusError, Message: http.StatusText(sw.code)}
+		}
+
+		tracer.add(span)
+	})
+}
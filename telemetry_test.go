@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTraceparentPropagation(t *testing.T) {
+	defer func(u string, d time.Duration) { webhookURL, webhookTimeout = u, d }(webhookURL, webhookTimeout)
+	defer func(d time.Duration) { webhookCacheTTL = d }(webhookCacheTTL)
+
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+	}))
+	defer ts.Close()
+
+	webhookURL = ts.URL
+	webhookTimeout = 5 * time.Second
+	webhookCacheTTL = 0
+
+	tp := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	tests := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{context.WithValue(context.Background(), traceKey{}, tp), tp},
+		{context.Background(), ""},
+	}
+
+	for _, tt := range tests {
+		got = "-"
+		if !webhookAuthenticate(tt.ctx, "alice", "secret", "127.0.0.1") {
+			t.Fatal("webhook authentication failed")
+		}
+		if got != tt.want {
+			t.Errorf("traceparent %q, want %q", got, tt.want)
+		}
+	}
+}
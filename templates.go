@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// overlayFS serve files from dir and fall back to base for files missing
+// there.
+type overlayFS struct {
+	dir  fs.FS
+	base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.dir.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	return o.base.Open(name)
+}
+
+var (
+	twVersionsDir string
+	twTemplates   fs.FS = tiddly
+	twVersions    []string
+
+	twTemplateURL   string
+	twTemplateCache string
+
+	twEmptyFile  string
+	twAutoUpdate bool
+	twUpdateURL  string
+
+	twVersionRe = regexp.MustCompile(`<meta\s+name=["']tiddlywiki-version["']\s+content=["']([^"']+)["']`)
+
+	templateClient = &http.Client{Timeout: templateDownloadTimeout, Transport: &tracingTransport{}}
+)
+
+const (
+	// templateDownloadTimeout limit time of downloading -tw.template-url.
+	templateDownloadTimeout = 30 * time.Second
+	// templateMinSize is minimal size of valid empty TiddlyWiki.
+	templateMinSize = 100 * 1024
+)
+
+// loadTemplates overlay embedded empty.html with empty-<version>.html files
+// found in dir.
+func loadTemplates(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	twTemplates = overlayFS{dir: os.DirFS(dir), base: tiddly}
+
+	files, err := fs.Glob(twTemplates, "empty-*.html")
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		twVersions = append(twVersions, strings.TrimSuffix(strings.TrimPrefix(f, "empty-"), ".html"))
+	}
+	sort.Strings(twVersions)
+
+	log.Printf("TiddlyWiki versions: %s\n", strings.Join(twVersions, ", "))
+
+	return nil
+}
+
+// templateFor return name of template for TiddlyWiki version; unknown
+// versions use default one.
+func templateFor(version string) string {
+	if version == "" {
+		return twFile
+	}
+
+	name := "empty-" + version + ".html"
+	if !fs.ValidPath(name) || strings.Contains(version, "/") {
+		return twFile
+	}
+
+	if _, err := fs.Stat(twTemplates, name); err != nil {
+		log.Printf("unknown TiddlyWiki version %q, using default\n", version)
+		return twFile
+	}
+
+	return name
+}
+
+// downloadTemplate fetch empty TiddlyWiki from url and check it.
+func downloadTemplate(url string) ([]byte, error) {
+	resp, err := templateClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("download template error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download template error: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(uploadMaxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("download template error: %w", err)
+	}
+
+	if int64(len(data)) > int64(uploadMaxSize) {
+		return nil, errors.New("download template error: template too large")
+	}
+
+	if !looksLikeHTML(data[:min(len(data), sniffLen)]) {
+		return nil, errors.New("download template error: not an HTML document")
+	}
+
+	return data, nil
+}
+
+// loadTemplateURL replace embedded template by one downloaded from url. The
+// downloaded file is kept in cacheFile and used when download fails; without
+// it embedded template is used.
+func loadTemplateURL(url, cacheFile string) {
+	if url == "" {
+		return
+	}
+
+	data, err := downloadTemplate(url)
+	if err == nil {
+		if cacheFile != "" {
+			if err := os.WriteFile(cacheFile, data, 0o600); err != nil {
+				log.Printf("write template cache error: %v\n", err)
+			}
+		}
+	} else {
+		log.Println(err)
+
+		if cacheFile == "" {
+			return
+		}
+
+		data, err = os.ReadFile(cacheFile)
+		if err != nil {
+			log.Printf("no cached template, using embedded one: %v\n", err)
+			return
+		}
+		log.Printf("using cached template %s\n", cacheFile)
+	}
+
+	setDefaultTemplate(data)
+}
+
+// setDefaultTemplate use data as template of new wikis instead of embedded
+// empty.html.
+func setDefaultTemplate(data []byte) {
+	twTemplates = overlayFS{
+		dir:  fstest.MapFS{twFile: &fstest.MapFile{Data: data, Mode: 0o600}},
+		base: twTemplates,
+	}
+}
+
+// checkTemplate check if data looks like empty TiddlyWiki.
+func checkTemplate(data []byte) error {
+	if len(data) < templateMinSize {
+		return fmt.Errorf("template too small (%s)", formatSize(int64(len(data))))
+	}
+	if !twSignature.Match(data[:min(len(data), sniffLen*4)]) && !bytes.Contains(data, []byte("tiddlywiki-tiddler-store")) {
+		return errors.New("template is not a TiddlyWiki")
+	}
+
+	return nil
+}
+
+// templateVersion return TiddlyWiki version of template, if known.
+func templateVersion(data []byte) string {
+	if m := twVersionRe.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// newerVersion check if version a is newer than b; versions are compared
+// by numeric parts, e.g. 5.3.10 > 5.3.9.
+func newerVersion(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			return na > nb
+		}
+	}
+
+	return false
+}
+
+// loadEmptyTemplate replace embedded template by file; missing file is
+// ignored.
+func loadEmptyTemplate(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("template %s not found, using embedded one\n", file)
+			return nil
+		}
+		return fmt.Errorf("read template error: %w", err)
+	}
+
+	if err := checkTemplate(data); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	setDefaultTemplate(data)
+	log.Printf("Template: %s (TiddlyWiki %s)\n", file, templateVersion(data))
+
+	return nil
+}
+
+// templateRelease describe the latest empty TiddlyWiki available at
+// -tw.update-url.
+type templateRelease struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+}
+
+// updateTemplate download template described at url when it is newer than
+// the current one. Verified template is saved to saveTo, if set.
+func updateTemplate(url, saveTo string) error {
+	current, err := fs.ReadFile(twTemplates, twFile)
+	if err != nil {
+		return err
+	}
+	version := templateVersion(current)
+
+	resp, err := templateClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("check template update error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("check template update error: %s", resp.Status)
+	}
+
+	var rel templateRelease
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&rel); err != nil {
+		return fmt.Errorf("check template update error: %w", err)
+	}
+	if rel.Version == "" || rel.URL == "" || rel.SHA256 == "" {
+		return errors.New("check template update error: incomplete release description")
+	}
+
+	if !newerVersion(rel.Version, version) {
+		log.Printf("TiddlyWiki template %s is up to date\n", version)
+		return nil
+	}
+
+	data, err := downloadTemplate(rel.URL)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), rel.SHA256) {
+		return fmt.Errorf("template %s: sha256 mismatch", rel.URL)
+	}
+	if err := checkTemplate(data); err != nil {
+		return fmt.Errorf("template %s: %w", rel.URL, err)
+	}
+
+	setDefaultTemplate(data)
+	log.Printf("Updated TiddlyWiki template from %s to %s\n", version, rel.Version)
+
+	if saveTo != "" {
+		tmp := saveTo + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return fmt.Errorf("save template error: %w", err)
+		}
+		if err := os.Rename(tmp, saveTo); err != nil {
+			return fmt.Errorf("save template error: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Tiddler delta backups ("tiddlers" backup mode) store only tiddlers added,
+// changed or deleted since the previous backup. Tiddlers are taken from the
+// JSON tiddler store of TiddlyWiki 5.2+:
+//
+//	<script class="tiddlywiki-tiddler-store" type="application/json">[...]</script>
+//
+// Delta file use the same container as binary deltas, with own magic:
+//
+//	"WTIDDL1\n" <base backup name> "\n" <JSON tiddlerDelta>
+//
+// Content outside of the store (core, plugins in other stores) is kept only
+// when it differs from base. Wikis without store get full backups.
+
+const tiddlerMagic = "WTIDDL1\n"
+
+var errNoTiddlerStore = errors.New("no tiddler store")
+
+// tiddlerDelta describe how to build wiki from its base backup.
+type tiddlerDelta struct {
+	// Prefix and Suffix are parts of document around the store; nil when
+	// the same as in base.
+	Prefix *string `json:"prefix,omitempty"`
+	Suffix *string `json:"suffix,omitempty"`
+	// Head, Sep and Tail are text before first tiddler (with "["), between
+	// tiddlers and after last one (with "]").
+	Head string `json:"head"`
+	Sep  string `json:"sep"`
+	Tail string `json:"tail"`
+	// Order is list of titles of all tiddlers in the store.
+	Order []string `json:"order"`
+	// Changed map title to JSON of added and changed tiddlers; kept as
+	// string, because RawMessage is re-encoded by json.Marshal.
+	Changed map[string]string `json:"changed,omitempty"`
+	Deleted []string          `json:"deleted,omitempty"`
+	Size    int               `json:"size"`
+	SHA256  string            `json:"sha256"`
+}
+
+// tiddlerStore is parsed content of tiddler store, kept byte-exact.
+type tiddlerStore struct {
+	prefix, suffix  []byte
+	head, sep, tail string
+	titles          []string
+	tiddlers        map[string]json.RawMessage
+}
+
+// findTiddlerStore return offsets of content of the first tiddler store in
+// wiki.
+func findTiddlerStore(data []byte) (int, int, error) {
+	z := xhtml.NewTokenizer(bytes.NewReader(data))
+	offset := 0
+
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			return 0, 0, errNoTiddlerStore
+		}
+
+		raw := z.Raw()
+		offset += len(raw)
+
+		name, hasAttr := z.TagName()
+		if tt != xhtml.StartTagToken || string(name) != "script" {
+			continue
+		}
+
+		store := false
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			if string(key) == "class" && strings.Contains(string(val), "tiddlywiki-tiddler-store") {
+				store = true
+			}
+		}
+		if !store {
+			continue
+		}
+
+		if z.Next() != xhtml.TextToken {
+			return offset, offset, nil
+		}
+
+		text := z.Raw()
+		if !bytes.Equal(data[offset:offset+len(text)], text) {
+			return 0, 0, errDeltaCorrupted
+		}
+
+		return offset, offset + len(text), nil
+	}
+}
+
+// parseTiddlerStore split wiki into tiddlers of its store and text around
+// them.
+func parseTiddlerStore(data []byte) (*tiddlerStore, error) {
+	start, end, err := findTiddlerStore(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &tiddlerStore{
+		prefix:   data[:start],
+		suffix:   data[end:],
+		tiddlers: make(map[string]json.RawMessage),
+	}
+
+	content := data[start:end]
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("invalid tiddler store: %w", errDeltaCorrupted)
+	}
+
+	prev := 0
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid tiddler store: %w", err)
+		}
+
+		var t struct {
+			Title *string `json:"title"`
+		}
+		if err := json.Unmarshal(raw, &t); err != nil || t.Title == nil {
+			return nil, fmt.Errorf("invalid tiddler in store: %w", errDeltaCorrupted)
+		}
+		if _, ok := s.tiddlers[*t.Title]; ok {
+			return nil, fmt.Errorf("duplicated tiddler %q: %w", *t.Title, errDeltaCorrupted)
+		}
+
+		pos := int(dec.InputOffset())
+		glue := string(content[prev : pos-len(raw)])
+		switch {
+		case len(s.titles) == 0:
+			s.head = glue
+		case len(s.titles) == 1:
+			s.sep = glue
+		case glue != s.sep:
+			return nil, fmt.Errorf("irregular tiddler store: %w", errDeltaCorrupted)
+		}
+		prev = pos
+
+		s.titles = append(s.titles, *t.Title)
+		s.tiddlers[*t.Title] = raw
+	}
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim(']') {
+		return nil, fmt.Errorf("invalid tiddler store: %w", errDeltaCorrupted)
+	}
+
+	if len(s.titles) == 0 {
+		s.head = string(content)
+	} else {
+		s.tail = string(content[prev:])
+	}
+
+	return s, nil
+}
+
+// render build document from store parts.
+func (s *tiddlerStore) render() []byte {
+	var buf bytes.Buffer
+	buf.Write(s.prefix)
+	buf.WriteString(s.head)
+	for i, title := range s.titles {
+		if i > 0 {
+			buf.WriteString(s.sep)
+		}
+		buf.Write(s.tiddlers[title])
+	}
+	buf.WriteString(s.tail)
+	buf.Write(s.suffix)
+
+	return buf.Bytes()
+}
+
+// apply update base store with delta.
+func (s *tiddlerStore) apply(d *tiddlerDelta) error {
+	if d.Prefix != nil {
+		s.prefix = []byte(*d.Prefix)
+	}
+	if d.Suffix != nil {
+		s.suffix = []byte(*d.Suffix)
+	}
+	s.head, s.sep, s.tail = d.Head, d.Sep, d.Tail
+
+	for _, title := range d.Deleted {
+		delete(s.tiddlers, title)
+	}
+	for title, raw := range d.Changed {
+		s.tiddlers[title] = json.RawMessage(raw)
+	}
+
+	for _, title := range d.Order {
+		if _, ok := s.tiddlers[title]; !ok {
+			return fmt.Errorf("missing tiddler %q: %w", title, errDeltaCorrupted)
+		}
+	}
+	s.titles = d.Order
+
+	return nil
+}
+
+// createTiddlerDelta return delta between tiddler stores of old and new
+// wiki. Error is returned when any of them can not be reproduced from
+// tiddlers, then full backup should be created.
+func createTiddlerDelta(oldData, newData []byte) ([]byte, error) {
+	oldStore, err := parseTiddlerStore(oldData)
+	if err != nil {
+		return nil, err
+	}
+
+	newStore, err := parseTiddlerStore(newData)
+	if err != nil {
+		return nil, err
+	}
+
+	d := tiddlerDelta{
+		Head:    newStore.head,
+		Sep:     newStore.sep,
+		Tail:    newStore.tail,
+		Order:   newStore.titles,
+		Changed: make(map[string]string),
+		Size:    len(newData),
+		SHA256:  sha256Hex(newData),
+	}
+
+	if !bytes.Equal(oldStore.prefix, newStore.prefix) {
+		prefix := string(newStore.prefix)
+		d.Prefix = &prefix
+	}
+	if !bytes.Equal(oldStore.suffix, newStore.suffix) {
+		suffix := string(newStore.suffix)
+		d.Suffix = &suffix
+	}
+
+	for _, title := range newStore.titles {
+		raw := newStore.tiddlers[title]
+		if !bytes.Equal(oldStore.tiddlers[title], raw) {
+			d.Changed[title] = string(raw)
+		}
+	}
+	for _, title := range oldStore.titles {
+		if _, ok := newStore.tiddlers[title]; !ok {
+			d.Deleted = append(d.Deleted, title)
+		}
+	}
+
+	delta, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// delta must restore exactly the same file; JSON strings can not keep
+	// invalid UTF-8, layout of store may be irregular etc.
+	if _, err := applyTiddlerDelta(oldData, bytes.NewReader(delta)); err != nil {
+		return nil, fmt.Errorf("tiddler store can not be reproduced: %w", err)
+	}
+
+	return delta, nil
+}
+
+// applyTiddlerDelta rebuild wiki from base content and tiddler delta.
+func applyTiddlerDelta(base []byte, r io.Reader) ([]byte, error) {
+	var d tiddlerDelta
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, fmt.Errorf("read tiddler delta error: %w", errDeltaCorrupted)
+	}
+
+	s, err := parseTiddlerStore(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(&d); err != nil {
+		return nil, err
+	}
+
+	out := s.render()
+	sum := sha256.Sum256(out)
+	if len(out) != d.Size || hex.EncodeToString(sum[:]) != d.SHA256 {
+		return nil, errDeltaCorrupted
+	}
+
+	return out, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testWiki(title string, tiddlers ...string) []byte {
+	return []byte(`<!doctype html>
+<html><head><title>` + title + `</title></head><body>
+<script class="tiddlywiki-tiddler-store" type="application/json">[
+` + strings.Join(tiddlers, ",\n") + `
+]</script>
+<script>/* core */</script>
+</body></html>
+`)
+}
+
+func TestTiddlerDeltaRoundTrip(t *testing.T) {
+	a := `{"title":"A","text":"first"}`
+	b := `{"title":"B","text":"second"}`
+	c := `{"title":"C","text":"unchanged é text","tags":"[[x y]]"}`
+	base := testWiki("Wiki", a, b, c)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		changed     []string
+		deleted     []string
+		prefixDelta bool
+	}{
+		{"no change", base, nil, nil, false},
+		{"changed", testWiki("Wiki", `{"title":"A","text":"edited"}`, b, c), []string{"A"}, nil, false},
+		{"added and deleted", testWiki("Wiki", a, c, `{"title":"D","text":"new"}`), []string{"D"}, []string{"B"}, false},
+		{"reordered", testWiki("Wiki", c, b, a), nil, nil, false},
+		{"empty store", testWiki("Wiki"), nil, []string{"A", "B", "C"}, false},
+		{"changed title", testWiki("Renamed", a, b, c), nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		delta, err := createTiddlerDelta(base, tt.data)
+		if err != nil {
+			t.Fatalf("%s: createTiddlerDelta error: %v", tt.name, err)
+		}
+
+		out, err := applyTiddlerDelta(base, bytes.NewReader(delta))
+		if err != nil {
+			t.Fatalf("%s: applyTiddlerDelta error: %v", tt.name, err)
+		}
+		if !bytes.Equal(out, tt.data) {
+			t.Errorf("%s: restored wiki differs:\n%s\nwant:\n%s", tt.name, out, tt.data)
+		}
+
+		var d tiddlerDelta
+		if err := json.Unmarshal(delta, &d); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.Changed) != len(tt.changed) {
+			t.Errorf("%s: changed %v, want %v", tt.name, d.Changed, tt.changed)
+		}
+		for _, title := range tt.changed {
+			if _, ok := d.Changed[title]; !ok {
+				t.Errorf("%s: %s not in changed tiddlers", tt.name, title)
+			}
+		}
+		if strings.Join(d.Deleted, ",") != strings.Join(tt.deleted, ",") {
+			t.Errorf("%s: deleted %v, want %v", tt.name, d.Deleted, tt.deleted)
+		}
+		if (d.Prefix != nil) != tt.prefixDelta {
+			t.Errorf("%s: prefix in delta %v, want %v", tt.name, d.Prefix != nil, tt.prefixDelta)
+		}
+	}
+}
+
+func TestTiddlerDeltaNoStore(t *testing.T) {
+	plain := []byte("<html><body>classic wiki</body></html>")
+	if _, err := createTiddlerDelta(plain, plain); !errors.Is(err, errNoTiddlerStore) {
+		t.Errorf("createTiddlerDelta error %v, want %v", err, errNoTiddlerStore)
+	}
+}
+
+func TestTiddlerDeltaCorrupted(t *testing.T) {
+	b := `{"title":"B","text":"kept"}`
+	base := testWiki("Wiki", `{"title":"A","text":"first"}`, b)
+	delta, err := createTiddlerDelta(base, testWiki("Wiki", `{"title":"A","text":"second"}`, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	others := [][]byte{
+		// unchanged tiddler missing in base
+		testWiki("Wiki", `{"title":"A","text":"first"}`),
+		// unchanged tiddler differs; checksum not match
+		testWiki("Wiki", `{"title":"A","text":"first"}`, `{"title":"B","text":"other"}`),
+	}
+
+	for _, other := range others {
+		if _, err := applyTiddlerDelta(other, bytes.NewReader(delta)); !errors.Is(err, errDeltaCorrupted) {
+			t.Errorf("applyTiddlerDelta error %v, want %v", err, errDeltaCorrupted)
+		}
+	}
+
+	if _, err := applyTiddlerDelta(base, strings.NewReader("garbage")); !errors.Is(err, errDeltaCorrupted) {
+		t.Errorf("applyTiddlerDelta error %v, want %v", err, errDeltaCorrupted)
+	}
+}
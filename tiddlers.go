@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// parseTiddlerTags split tags field of tiddler: tags are separated by
+// spaces, tags with spaces are written as [[tag name]].
+func parseTiddlerTags(s string) []string {
+	var tags []string
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if strings.HasPrefix(s, "[[") {
+			if tag, rest, ok := strings.Cut(s[2:], "]]"); ok {
+				tags = append(tags, tag)
+				s = rest
+				continue
+			}
+		}
+
+		tag, rest, _ := strings.Cut(s, " ")
+		tags = append(tags, tag)
+		s = rest
+	}
+
+	return tags
+}
+
+// tiddlerFilter select tiddlers by title and tag; empty values match all.
+type tiddlerFilter struct {
+	title, tag string
+}
+
+func (f *tiddlerFilter) match(raw json.RawMessage) bool {
+	if f.title == "" && f.tag == "" {
+		return true
+	}
+
+	var t struct {
+		Title string          `json:"title"`
+		Tags  json.RawMessage `json:"tags"`
+	}
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return false
+	}
+
+	if f.title != "" && t.Title != f.title {
+		return false
+	}
+
+	if f.tag == "" {
+		return true
+	}
+
+	var tags []string
+	var s string
+	if json.Unmarshal(t.Tags, &s) == nil {
+		tags = parseTiddlerTags(s)
+	} else if json.Unmarshal(t.Tags, &tags) != nil {
+		return false
+	}
+
+	for _, tag := range tags {
+		if tag == f.tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eachTiddler call fn for every tiddler from all JSON tiddler stores of
+// wiki read from r.
+func eachTiddler(r io.Reader, fn func(raw json.RawMessage) error) error {
+	z := xhtml.NewTokenizer(bufio.NewReader(r))
+	store := false
+
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			return nil
+		case xhtml.StartTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "script" {
+				continue
+			}
+
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "class" && strings.Contains(string(val), "tiddlywiki-tiddler-store") {
+					store = true
+				}
+			}
+		case xhtml.EndTagToken:
+			store = false
+		case xhtml.TextToken:
+			if !store {
+				continue
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(z.Raw()))
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				continue
+			}
+
+			for dec.More() {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				if err := fn(raw); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// exportTiddlers stream tiddlers from all JSON tiddler stores of wiki as
+// JSON array to w.
+func exportTiddlers(w io.Writer, r io.Reader, f *tiddlerFilter) error {
+	count := 0
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	err := eachTiddler(r, func(raw json.RawMessage) error {
+		if !f.match(raw) {
+			return nil
+		}
+
+		if count > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		count++
+
+		_, err := w.Write(raw)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// serveTiddlers handle GET /api/v1/wikis/<wiki>/tiddlers: return tiddlers of
+// wiki, optionally only with ?title= or ?tag=.
+func serveTiddlers(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	fullPath := resolveWiki(req.userPath, wiki)
+	if fullPath == "" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if code := req.wikiAccess(r, fullPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	q := r.URL.Query()
+	f := &tiddlerFilter{title: q.Get("title"), tag: q.Get("tag")}
+
+	bw := bufio.NewWriter(w)
+	if err := exportTiddlers(bw, file, f); err != nil {
+		// response is already started, client get truncated JSON
+		log.Printf("export tiddlers of %s error: %v\n", fullPath, err)
+		return
+	}
+
+	if err := bw.Flush(); err != nil {
+		log.Printf("export tiddlers of %s error: %v\n", fullPath, err)
+	}
+}
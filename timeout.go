@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// timeoutGrace is time given to send 503 response after deadline.
+const timeoutGrace = 5 * time.Second
+
+var (
+	timeoutGet      time.Duration
+	timeoutPut      time.Duration
+	timeoutPropfind time.Duration
+)
+
+// methodTimeout return deadline of requests with method; 0 means no limit.
+func methodTimeout(method string) time.Duration {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return timeoutGet
+	case http.MethodPut:
+		return timeoutPut
+	case "PROPFIND":
+		return timeoutPropfind
+	}
+	return 0
+}
+
+// timeoutWriter replace response with 503 when deadline passed before
+// headers were written.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	rc          *http.ResponseController
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (t *timeoutWriter) WriteHeader(code int) {
+	if t.wroteHeader {
+		return
+	}
+	t.wroteHeader = true
+
+	if t.ctx.Err() != nil {
+		t.timedOut = true
+		_ = t.rc.SetWriteDeadline(time.Now().Add(timeoutGrace))
+		t.Header().Set("Connection", "close")
+		http.Error(t.ResponseWriter, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *timeoutWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// withTimeouts limit time of requests by -timeout.<method> flags. Request
+// context is canceled and connection deadlines are set, so reading slow
+// uploads and writing responses fail when time is up; the connection is
+// then closed.
+func withTimeouts(next http.Handler) http.Handler {
+	if timeoutGet == 0 && timeoutPut == 0 && timeoutPropfind == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := methodTimeout(r.Method)
+		if d <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		deadline := time.Now().Add(d)
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline)
+
+		tw := &timeoutWriter{ResponseWriter: w, ctx: ctx, rc: rc}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+
+		if ctx.Err() != nil {
+			log.Printf("%s %s timed out after %s\n", r.Method, r.URL.Path, d)
+			tw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTimeouts(t *testing.T) {
+	defer func(g, p time.Duration) { timeoutGet, timeoutPut = g, p }(timeoutGet, timeoutPut)
+	timeoutGet = 100 * time.Millisecond
+	timeoutPut = 0
+
+	ts := httptest.NewServer(withTimeouts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow.html":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/partial.html":
+			_, _ = w.Write([]byte("start"))
+			_ = http.NewResponseController(w).Flush()
+			time.Sleep(300 * time.Millisecond)
+			_, _ = w.Write(make([]byte, 1<<20))
+		default:
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte("ok"))
+		}
+	})))
+	defer ts.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/slow.html", http.StatusServiceUnavailable},
+		// PUT has no deadline
+		{http.MethodPut, "/fast.html", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+		if tt.want == http.StatusServiceUnavailable {
+			if !resp.Close {
+				t.Errorf("%s %s: connection not closed", tt.method, tt.path)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("%s %s: timed out after %s", tt.method, tt.path, d)
+			}
+		}
+	}
+
+	// deadline fired mid-response; connection is closed before whole body
+	// is sent
+	resp, err := http.Get(ts.URL + "/partial.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("partial response read without error")
+	}
+}
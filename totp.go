@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // RFC 6238 default algorithm
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSkew      = 1
+	totpHeader    = "X-TOTP-Code"
+	totpSeparator = ":"
+)
+
+// totpStore keeps TOTP secrets and recently used codes, so a code can not
+// be used with other password within its validity window.
+type totpStore struct {
+	mu      sync.Mutex
+	secrets map[string][]byte
+	used    map[string]usedCode
+}
+
+// usedCode is accepted code with hash of password it was sent with.
+type usedCode struct {
+	expire     time.Time
+	credential [sha256.Size]byte
+}
+
+var totp *totpStore
+
+func loadTOTPSecrets(path string) (*totpStore, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = ':'
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	entries, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read totp file %s error: %w", path, err)
+	}
+
+	store := &totpStore{
+		secrets: make(map[string][]byte),
+		used:    make(map[string]usedCode),
+	}
+
+	for _, parts := range entries {
+		secret := strings.ToUpper(strings.ReplaceAll(parts[1], " ", ""))
+		key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid totp secret for %q: %w", parts[0], err)
+		}
+		store.secrets[parts[0]] = key
+	}
+
+	return store, nil
+}
+
+// totpCode computes the RFC 4226 HOTP value for given counter.
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// verify check code for user accepting codes from one period before and
+// after current to handle clock skew. Accepted codes are remembered until
+// they expire together with pass they were sent with; clients using basic
+// auth resend the same credentials with every request, so the code is
+// accepted again only with the same password.
+func (t *totpStore) verify(user, pass, code string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key, ok := t.secrets[user]
+	if !ok {
+		// users without secret do not use second factor
+		return true
+	}
+
+	if len(code) != totpDigits {
+		return false
+	}
+
+	for k, u := range t.used {
+		if now.After(u.expire) {
+			delete(t.used, k)
+		}
+	}
+
+	credential := sha256.Sum256([]byte(pass))
+	counter := now.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		c := uint64(counter + int64(i))
+		if !hmac.Equal([]byte(totpCode(key, c)), []byte(code)) {
+			continue
+		}
+
+		usedKey := fmt.Sprintf("%s:%d", user, c)
+		if u, ok := t.used[usedKey]; ok {
+			return subtle.ConstantTimeCompare(u.credential[:], credential[:]) == 1
+		}
+
+		t.used[usedKey] = usedCode{
+			expire:     time.Unix((int64(c)+totpSkew+1)*totpPeriod, 0),
+			credential: credential,
+		}
+		return true
+	}
+
+	return false
+}
+
+// splitTOTP extract TOTP code from end of password of user. Passwords of
+// users without secret are returned unchanged, as they may contain the
+// separator.
+func (t *totpStore) splitTOTP(user, pass string) (string, string) {
+	t.mu.Lock()
+	_, ok := t.secrets[user]
+	t.mu.Unlock()
+	if !ok {
+		return pass, ""
+	}
+
+	idx := strings.LastIndex(pass, totpSeparator)
+	if idx < 0 {
+		return pass, ""
+	}
+
+	return pass[:idx], pass[idx+len(totpSeparator):]
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitTOTP(t *testing.T) {
+	store := &totpStore{
+		secrets: map[string][]byte{"alice": []byte("12345678901234567890")},
+		used:    make(map[string]usedCode),
+	}
+
+	tests := []struct {
+		user, pass string
+		wantPass   string
+		wantCode   string
+	}{
+		{"alice", "secret:123456", "secret", "123456"},
+		{"alice", "a:b:123456", "a:b", "123456"},
+		{"alice", "secret", "secret", ""},
+		{"bob", "pass:word", "pass:word", ""},
+		{"bob", "secret:123456", "secret:123456", ""},
+	}
+
+	for _, tt := range tests {
+		pass, code := store.splitTOTP(tt.user, tt.pass)
+		if pass != tt.wantPass || code != tt.wantCode {
+			t.Errorf("splitTOTP(%q, %q) = %q, %q, want %q, %q", tt.user, tt.pass, pass, code, tt.wantPass, tt.wantCode)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	key := []byte("12345678901234567890")
+	store := &totpStore{
+		secrets: map[string][]byte{"alice": key},
+		used:    make(map[string]usedCode),
+	}
+
+	// RFC 6238 test vector
+	now := time.Unix(59, 0)
+	if got := totpCode(key, uint64(now.Unix()/totpPeriod)); got != "287082" {
+		t.Fatalf("totpCode = %q, want %q", got, "287082")
+	}
+
+	tests := []struct {
+		user, pass, code string
+		want             bool
+	}{
+		{"bob", "bob", "", true},
+		{"alice", "alice", "", false},
+		{"alice", "alice", "000000", false},
+		{"alice", "alice", "287082", true},
+		// the same credentials sent again
+		{"alice", "alice", "287082", true},
+		// code used with other password
+		{"alice", "other", "287082", false},
+	}
+
+	for _, tt := range tests {
+		if got := store.verify(tt.user, tt.pass, tt.code, now); got != tt.want {
+			t.Errorf("verify(%q, %q, %q) = %v, want %v", tt.user, tt.pass, tt.code, got, tt.want)
+		}
+	}
+
+	// code expired
+	if store.verify("alice", "alice", "287082", now.Add(3*totpPeriod*time.Second)) {
+		t.Error("expired code accepted")
+	}
+}
+
+func TestTOTPConsecutiveRequests(t *testing.T) {
+	defer func(s *totpStore) { totp = s }(totp)
+
+	key := []byte("12345678901234567890")
+	totp = &totpStore{
+		secrets: map[string][]byte{"alice": key},
+		used:    make(map[string]usedCode),
+	}
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "alice/a.html")
+	v := &vhost{auth: "basic", davDir: dir, users: map[string]string{"alice": testHash(t, "alice")}}
+	addHandler(&v.handlers, "alice", filepath.Join(dir, "alice"))
+	h := wikiHandler(v)
+
+	code := totpCode(key, uint64(time.Now().Unix()/totpPeriod))
+
+	// browser sends the same credentials with every request
+	for i := 1; i <= 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/a.html", nil)
+		r.SetBasicAuth("alice", "alice:"+code)
+		rec := httptest.NewRecorder()
+		h(rec, r)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("request %d: status %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const userAccessLogName = "access.log"
+
+var userAccessLog bool
+
+// countingWriter remember status and number of bytes of response body.
+type countingWriter struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (c *countingWriter) WriteHeader(code int) {
+	if c.code == 0 {
+		c.code = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.code == 0 {
+		c.code = http.StatusOK
+	}
+	n, err := c.ResponseWriter.Write(b)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// clfValue return value for Combined Log Format, "-" when empty.
+func clfValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// logUserAccess write request in Combined Log Format to access.log in user
+// directory. File is opened on first use. Caller must hold h.mu.
+func (h *userHandler) logUserAccess(userPath, user string, r *http.Request, cw *countingWriter, start time.Time) {
+	if h.accessLog == nil {
+		f, err := openRotatingFile(filepath.Join(userPath, userAccessLogName), int64(logRotateSize), logRotateKeep)
+		if err != nil {
+			log.Printf("user access log error: %v\n", err)
+			return
+		}
+		h.accessLog = f
+	}
+
+	code := cw.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	size := "-"
+	if cw.bytes > 0 {
+		size = fmt.Sprint(cw.bytes)
+	}
+
+	fmt.Fprintf(h.accessLog, "%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+		clientIP(r),
+		clfValue(user),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method,
+		logRequestURI(r.RequestURI),
+		r.Proto,
+		code,
+		size,
+		clfValue(r.Referer()),
+		clfValue(r.UserAgent()),
+	)
+
+	h.accessLog.rotateIfNeeded()
+}
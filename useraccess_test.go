@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestUserAccessLog(t *testing.T) {
+	defer func(u bool, s byteSize) { userAccessLog, logRotateSize = u, s }(userAccessLog, logRotateSize)
+	userAccessLog = true
+	logRotateSize = 0
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.html"), []byte("wiki"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v := &vhost{davDir: dir}
+	addHandler(&v.handlers, "", dir)
+	h := wikiHandler(v)
+
+	logPath := filepath.Join(dir, userAccessLogName)
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatalf("access log created before first request: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/a.html?tw=5.3.0", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", "test agent")
+	h(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest(http.MethodGet, "/missing.txt", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	h(httptest.NewRecorder(), r)
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clf := regexp.MustCompile(`^(\S+) - (\S+) \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "(\S+) (\S+) HTTP/1\.1" (\d{3}) (\d+|-) "([^"]*)" "([^"]*)"$`)
+	want := [][]string{
+		{"192.0.2.1", "-", "GET", "/a.html?tw=5.3.0", "200", "4", "http://example.com/", "test agent"},
+		{"192.0.2.2", "-", "GET", "/missing.txt", "404", "19", "-", "-"},
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("access log has %d lines, want %d: %q", len(lines), len(want), data)
+	}
+	for i, line := range lines {
+		m := clf.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("invalid CLF line: %q", line)
+			continue
+		}
+		got := m[1:]
+		if strings.Join(got, "|") != strings.Join(want[i], "|") {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
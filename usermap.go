@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+)
+
+// userMapPath is TOML file mapping users of default virtual host to their
+// directories:
+//
+//	"john@example.com" = "/srv/wikis/john"
+var (
+	userMapPath string
+	userMap     atomic.Pointer[map[string]string]
+)
+
+func loadUserMap(fname string) (map[string]string, error) {
+	m := make(map[string]string)
+	if _, err := toml.DecodeFile(fname, &m); err != nil {
+		return nil, fmt.Errorf("read user map %s error: %w", fname, err)
+	}
+
+	for user, dir := range m {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("user map %s: directory of %s is not absolute", fname, user)
+		}
+		m[user] = filepath.Clean(dir)
+	}
+
+	return m, nil
+}
+
+// validUserName check if user name coming from outside (registration,
+// certificate, identity provider) can be used as name of directory.
+func validUserName(user string) bool {
+	return user != "" && !strings.HasPrefix(user, ".") &&
+		!strings.ContainsAny(user, "/\\|\x00") && !strings.Contains(user, "..")
+}
+
+// userDir return directory of user: <wikis dir>/<user> or, for default
+// virtual host, the one given in -user.map. Empty string is returned when
+// the directory would be outside of wikis directory.
+func (v *vhost) userDir(user string) string {
+	if v == defaultVhost && user != "" {
+		if m := userMap.Load(); m != nil {
+			if dir, ok := (*m)[user]; ok {
+				return dir
+			}
+		}
+	}
+
+	dir := path.Join(v.davDir, user)
+	if user != "" && !strings.HasPrefix(dir, strings.TrimSuffix(v.davDir, "/")+"/") {
+		return ""
+	}
+
+	return dir
+}
+
+// remapHandlers point handlers of users to their current directories.
+func (v *vhost) remapHandlers() {
+	v.handlers.mu.RLock()
+	defer v.handlers.mu.RUnlock()
+
+	for _, h := range v.handlers.list {
+		if h.name == "" {
+			continue
+		}
+
+		h.mu.Lock()
+		h.setDir(v.userDir(h.name))
+		h.mu.Unlock()
+	}
+}
+
+// reloadUserMapOnSignal re-read -user.map on SIGHUP; invalid file is
+// reported and the previous map is kept.
+func reloadUserMapOnSignal(fname string) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		m, err := loadUserMap(fname)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		userMap.Store(&m)
+		defaultVhost.remapHandlers()
+		log.Printf("Reloaded user map %s: %d users\n", fname, len(m))
+	}
+}
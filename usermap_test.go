@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidUserName(t *testing.T) {
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"alice", true},
+		{"bob@example.com", true},
+		{"team-1_a.b", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".hidden", false},
+		{"../x", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a..b", false},
+		{"a|b", false},
+	}
+
+	for _, tt := range tests {
+		if got := validUserName(tt.user); got != tt.want {
+			t.Errorf("validUserName(%q) = %v, want %v", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestUserDir(t *testing.T) {
+	v := &vhost{davDir: "/srv/wikis"}
+
+	tests := []struct {
+		user string
+		want string
+	}{
+		{"", "/srv/wikis"},
+		{"alice", "/srv/wikis/alice"},
+		{".", ""},
+		{"..", ""},
+		{"../other", ""},
+		{"a/../../x", ""},
+		{"a/../b", "/srv/wikis/b"},
+	}
+
+	for _, tt := range tests {
+		if got := v.userDir(tt.user); got != tt.want {
+			t.Errorf("userDir(%q) = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+}
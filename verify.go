@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+type verifyReport struct {
+	Name      string   `json:"name"`
+	Valid     bool     `json:"valid"`
+	Issues    []string `json:"issues"`
+	SizeBytes int64    `json:"size_bytes"`
+	Hash      string   `json:"hash"`
+}
+
+// checkWikiHTML parse wiki and report missing TiddlyWiki markers.
+func checkWikiHTML(r io.Reader) []string {
+	z := xhtml.NewTokenizer(bufio.NewReader(r))
+
+	var appName, store, htmlEnd bool
+
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+
+		name, hasAttr := z.TagName()
+		switch tt {
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+
+			switch string(name) {
+			case "meta":
+				if attrs["name"] == "application-name" && attrs["content"] == "TiddlyWiki" {
+					appName = true
+				}
+			case "script":
+				if strings.Contains(attrs["class"], "tiddlywiki-tiddler-store") {
+					store = true
+				}
+			case "div":
+				// store area of TiddlyWiki before 5.2
+				if attrs["id"] == "storeArea" {
+					store = true
+				}
+			}
+		case xhtml.EndTagToken:
+			if string(name) == "html" {
+				htmlEnd = true
+			}
+		}
+	}
+
+	issues := []string{}
+	if err := z.Err(); !errors.Is(err, io.EOF) {
+		issues = append(issues, "read error: "+err.Error())
+	}
+	if !appName {
+		issues = append(issues, `missing <meta name="application-name" content="TiddlyWiki">`)
+	}
+	if !store {
+		issues = append(issues, "missing tiddler store")
+	}
+	if !htmlEnd {
+		issues = append(issues, "missing </html>, file may be truncated")
+	}
+
+	return issues
+}
+
+// verifyWiki check wiki structure and compare its hash with .sha256 sidecar.
+// Sidecar is (re)created when missing or older than the wiki; the same
+// modification time with a different hash means the file was corrupted.
+func verifyWiki(fullPath string) (*verifyReport, error) {
+	before, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	issues := checkWikiHTML(io.TeeReader(f, h))
+	// hash whole file even if parser stopped early
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	report := &verifyReport{
+		Name:      filepath.Base(fullPath),
+		Issues:    issues,
+		SizeBytes: before.Size(),
+		Hash:      hex.EncodeToString(h.Sum(nil)),
+	}
+
+	after, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+		report.Issues = append(report.Issues, "file modified during verification")
+		return report, nil
+	}
+
+	stored, storedAt, err := readChecksum(fullPath)
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+	case err == nil && !before.ModTime().After(storedAt) && stored != report.Hash:
+		report.Issues = append(report.Issues, "hash does not match .sha256 file")
+	case len(report.Issues) == 0 && stored != report.Hash:
+		if err := writeChecksum(fullPath, report.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Valid = len(report.Issues) == 0
+
+	return report, nil
+}
+
+// serveVerify handle GET /api/v1/wikis/<wiki>/verify and
+// /api/v1/wikis/verify-all. Handler lock is released while files are read,
+// so saving is not blocked by verification.
+func serveVerify(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var paths []string
+	if wiki == "" {
+		wikis, err := listUserWikis(req.userPath)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		for _, wi := range wikis {
+			fullPath := filepath.Join(req.userPath, wi.Name)
+			if req.wikiAccess(r, fullPath) == 0 {
+				paths = append(paths, fullPath)
+			}
+		}
+	} else {
+		fullPath := resolveWiki(req.userPath, wiki)
+		if fullPath == "" {
+			jsonError(w, http.StatusBadRequest, "invalid wiki name")
+			return
+		}
+
+		if code := req.wikiAccess(r, fullPath); code != 0 {
+			jsonError(w, code, http.StatusText(code))
+			return
+		}
+
+		paths = append(paths, fullPath)
+	}
+
+	req.handler.mu.Unlock()
+	defer req.handler.mu.Lock()
+
+	reports := make([]*verifyReport, 0, len(paths))
+	for _, p := range paths {
+		report, err := verifyWiki(p)
+		if err != nil {
+			if os.IsNotExist(err) && wiki != "" {
+				jsonError(w, http.StatusNotFound, "wiki not found")
+				return
+			}
+			if os.IsNotExist(err) {
+				continue
+			}
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if wiki != "" {
+			writeJSON(w, http.StatusOK, report)
+			return
+		}
+
+		reports = append(reports, report)
+	}
+
+	writeJSON(w, http.StatusOK, reports)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vhostConfig describe one virtual host in -vhosts file.
+type vhostConfig struct {
+	Wikis  string `yaml:"wikis_dir"`
+	HTPass string `yaml:"htpass"`
+	Auth   string `yaml:"auth"`
+}
+
+// vhost is a set of wikis with its own users, served for one host name.
+type vhost struct {
+	name     string
+	davDir   string
+	passPath string
+	auth     string
+	usersMu  sync.RWMutex
+	users    map[string]string
+	handlers userHandlers
+	handler  http.HandlerFunc
+}
+
+var (
+	defaultVhost *vhost
+	vhosts       map[string]*vhost
+)
+
+// loadVhosts read YAML file mapping host names to their configuration.
+func loadVhosts(fname string) (map[string]*vhost, error) {
+	f, err := os.Open(filepath.Clean(fname))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var conf map[string]vhostConfig
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&conf); err != nil {
+		return nil, fmt.Errorf("read vhosts %s error: %w", fname, err)
+	}
+
+	result := make(map[string]*vhost, len(conf))
+	for name, c := range conf {
+		if c.Wikis == "" {
+			return nil, fmt.Errorf("vhost %s: missing wikis_dir", name)
+		}
+
+		dir, err := filepath.Abs(c.Wikis)
+		if err != nil {
+			return nil, fmt.Errorf("vhost %s: %w", name, err)
+		}
+
+		if c.Auth == "" {
+			c.Auth = "none"
+		}
+
+		switch c.Auth {
+		case "none", "basic", "digest", "header":
+		default:
+			return nil, fmt.Errorf("vhost %s: invalid auth %q", name, c.Auth)
+		}
+
+		result[strings.ToLower(name)] = &vhost{
+			name:     strings.ToLower(name),
+			davDir:   dir,
+			passPath: c.HTPass,
+			auth:     c.Auth,
+		}
+	}
+
+	return result, nil
+}
+
+// vhostFor find virtual host for request; unknown hosts are served by
+// default one configured with -wikis and -htpass.
+func vhostFor(r *http.Request) *vhost {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if v, ok := vhosts[strings.ToLower(host)]; ok {
+		return v
+	}
+
+	return defaultVhost
+}
+
+// allVhosts return default and all configured virtual hosts, and the host
+// of shared wikis.
+func allVhosts() []*vhost {
+	result := []*vhost{defaultVhost}
+	for _, v := range vhosts {
+		result = append(result, v)
+	}
+	if sharedSite != nil {
+		result = append(result, sharedSite)
+	}
+	return result
+}
+
+// readUsers read users of virtual host from its .htpasswd file; users of
+// default host are loaded also from environment.
+func (v *vhost) readUsers() (map[string]string, error) {
+	if v == defaultVhost {
+		return loadUsers()
+	}
+
+	if v.passPath == "" {
+		return map[string]string{}, nil
+	}
+
+	users, err := loadHTPasswd(htpassPaths(v.passPath))
+	if err != nil {
+		return nil, fmt.Errorf("vhost %s: %w", v.name, err)
+	}
+
+	return users, nil
+}
+
+// loadUsers (re)load users of virtual host.
+func (v *vhost) loadUsers() error {
+	users, err := v.readUsers()
+	if err != nil {
+		return err
+	}
+
+	v.usersMu.Lock()
+	old := len(v.users)
+	v.users = users
+	v.usersMu.Unlock()
+
+	if v.handler != nil {
+		log.Printf("Reloaded users of %s: %d -> %d\n", v.passPath, old, len(users))
+		v.addUserHandlers()
+	}
+
+	return nil
+}
+
+func (v *vhost) lookupUser(name string) (string, bool) {
+	v.usersMu.RLock()
+	defer v.usersMu.RUnlock()
+
+	hash, ok := v.users[name]
+
+	return hash, ok
+}
+
+func (v *vhost) userCount() int {
+	v.usersMu.RLock()
+	defer v.usersMu.RUnlock()
+
+	return len(v.users)
+}
+
+func (v *vhost) userNames() []string {
+	v.usersMu.RLock()
+	defer v.usersMu.RUnlock()
+
+	names := make([]string, 0, len(v.users))
+	for u := range v.users {
+		names = append(names, u)
+	}
+
+	return names
+}
+
+// addUserHandlers create handlers for users that does not have one yet.
+func (v *vhost) addUserHandlers() {
+	for _, u := range v.userNames() {
+		v.handlers.findOrAdd(u, v.userDir(u))
+	}
+}
+
+// globHandler return handler for user whose directory, created after start,
+// match -user.glob; nil when there is no such directory.
+func (v *vhost) globHandler(user string) *userHandler {
+	if userGlob == "" || user == "" {
+		return nil
+	}
+
+	if ok, err := filepath.Match(userGlob, user); err != nil || !ok {
+		return nil
+	}
+
+	uPath := v.userDir(user)
+	if fi, err := os.Stat(uPath); err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	return v.handlers.findOrAdd(user, uPath)
+}
+
+// setup create user handlers and main handler of the virtual host.
+func (v *vhost) setup() {
+	switch v.auth {
+	case "basic", "digest", "header", "mtls", "oidc", "webhook":
+		v.addUserHandlers()
+	default:
+		addHandler(&v.handlers, "", v.davDir)
+	}
+
+	v.handler = wikiHandler(v)
+}
+
+// watchUsers reload users when modification time of any of .htpasswd files
+// change.
+func (v *vhost) watchUsers(interval time.Duration) {
+	paths := htpassPaths(v.passPath)
+	modTimes := func() []time.Time {
+		times := make([]time.Time, len(paths))
+		for i, p := range paths {
+			if fi, err := os.Stat(p); err == nil {
+				times[i] = fi.ModTime()
+			}
+		}
+		return times
+	}
+
+	last := modTimes()
+	for range time.Tick(interval) {
+		current := modTimes()
+		if slices.EqualFunc(current, last, time.Time.Equal) {
+			continue
+		}
+		last = current
+
+		if err := v.loadUsers(); err != nil {
+			log.Printf("reload users from %s error: %v\n", v.passPath, err)
+		}
+	}
+}
+
+// label return name used to distinguish users of virtual hosts.
+func (v *vhost) label(user string) string {
+	if v == defaultVhost {
+		return user
+	}
+	return user + "@" + v.name
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchUsers(t *testing.T) {
+	dir := t.TempDir()
+	passPath := filepath.Join(dir, ".htpasswd")
+	if err := os.WriteFile(passPath, []byte("alice:"+testHash(t, "alice")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vhost{name: "example.com", davDir: dir, passPath: passPath}
+	if err := v.loadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	go v.watchUsers(10 * time.Millisecond)
+	// let watcher read initial modification time
+	time.Sleep(50 * time.Millisecond)
+
+	if v.authenticate("bob", "bob", "") {
+		t.Fatal("bob authenticated before reload")
+	}
+
+	data := "alice:" + testHash(t, "alice") + "\nbob:" + testHash(t, "bob") + "\n"
+	if err := os.WriteFile(passPath, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// modification time may have coarse resolution
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(passPath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !v.authenticate("bob", "bob", "") {
+		if time.Now().After(deadline) {
+			t.Fatal("bob not authenticated after reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !v.authenticate("alice", "alice", "") {
+		t.Error("alice not authenticated after reload")
+	}
+}
+
+func TestWatchUsersMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	admins, editors := filepath.Join(dir, "admins"), filepath.Join(dir, "editors")
+	if err := os.WriteFile(admins, []byte("alice:"+testHash(t, "alice")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vhost{name: "example.com", davDir: dir, passPath: admins + "," + editors}
+	if err := v.loadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	go v.watchUsers(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	// second file created while running
+	if err := os.WriteFile(editors, []byte("bob:"+testHash(t, "bob")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !v.authenticate("bob", "bob", "") {
+		if time.Now().After(deadline) {
+			t.Fatal("bob not authenticated after reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !v.authenticate("alice", "alice", "") {
+		t.Error("alice not authenticated after reload")
+	}
+}
+
+func TestGlobHandler(t *testing.T) {
+	defer func(g string) { userGlob = g }(userGlob)
+	userGlob = "team-*"
+
+	dir := t.TempDir()
+	v := &vhost{auth: "basic", davDir: dir, users: map[string]string{
+		"team-a": testHash(t, "team-a"),
+		"alice":  testHash(t, "alice"),
+	}}
+	h := wikiHandler(v)
+
+	get := func(user string) int {
+		r := httptest.NewRequest(http.MethodGet, "/a.html", nil)
+		r.SetBasicAuth(user, user)
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		return rec.Code
+	}
+
+	if code := get("team-a"); code != http.StatusNotFound {
+		t.Fatalf("GET before directory was created: status %d, want %d", code, http.StatusNotFound)
+	}
+
+	// directories added while running
+	writeTestFiles(t, dir, "team-a/a.html", "alice/a.html")
+
+	if code := get("team-a"); code != http.StatusOK {
+		t.Errorf("GET after directory was created: status %d, want %d", code, http.StatusOK)
+	}
+	if v.handlers.find("team-a") == nil {
+		t.Error("handler of team-a not added")
+	}
+
+	// user not matching pattern
+	if code := get("alice"); code != http.StatusNotFound {
+		t.Errorf("GET of user not matching -user.glob: status %d, want %d", code, http.StatusNotFound)
+	}
+}
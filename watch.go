@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const watchInterval = 2 * time.Second
+
+type watchEvent struct {
+	Event string    `json:"event"`
+	Wiki  string    `json:"wiki"`
+	At    time.Time `json:"at"`
+}
+
+// wikiWatch poll one wiki file for changes and notify its clients.
+type wikiWatch struct {
+	clients map[chan watchEvent]bool
+	stop    chan struct{}
+}
+
+var (
+	watchesMu sync.Mutex
+	watches   = make(map[string]*wikiWatch)
+)
+
+// subscribe register client watching wiki at fullPath; polling is started
+// for the first client and stopped when the last one unsubscribe.
+func subscribe(fullPath, name string) (chan watchEvent, func()) {
+	ch := make(chan watchEvent, 1)
+
+	watchesMu.Lock()
+	ww, ok := watches[fullPath]
+	if !ok {
+		ww = &wikiWatch{clients: make(map[chan watchEvent]bool), stop: make(chan struct{})}
+		watches[fullPath] = ww
+		go ww.poll(fullPath, name)
+	}
+	ww.clients[ch] = true
+	watchesMu.Unlock()
+
+	return ch, func() {
+		watchesMu.Lock()
+		defer watchesMu.Unlock()
+
+		delete(ww.clients, ch)
+		if len(ww.clients) == 0 {
+			close(ww.stop)
+			delete(watches, fullPath)
+		}
+	}
+}
+
+func modTime(fullPath string) time.Time {
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+func (ww *wikiWatch) poll(fullPath, name string) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := modTime(fullPath)
+
+	for {
+		select {
+		case <-ww.stop:
+			return
+		case <-ticker.C:
+		}
+
+		mt := modTime(fullPath)
+		if mt.Equal(last) {
+			continue
+		}
+		last = mt
+
+		ev := watchEvent{Event: "modified", Wiki: name, At: mt.UTC()}
+
+		watchesMu.Lock()
+		for ch := range ww.clients {
+			select {
+			case ch <- ev:
+			default:
+				// client did not receive previous event yet
+			}
+		}
+		watchesMu.Unlock()
+	}
+}
+
+// checkWatchOrigin accept requests without Origin (non-browser clients),
+// from the same host or from origins allowed by -cors.origins.
+func checkWatchOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+
+	if u.Host != r.Host && !corsAllowed(origin) {
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+
+	config.Origin = u
+
+	return nil
+}
+
+// serveWatch handle /api/v1/wikis/<wiki>/watch: send WebSocket event every
+// time the wiki is modified.
+func serveWatch(w http.ResponseWriter, r *http.Request, req *apiRequest, wiki string) {
+	fullPath := resolveWiki(req.userPath, wiki)
+	if fullPath == "" {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	if code := req.wikiAccess(r, fullPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	if _, err := os.Stat(fullPath); err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+
+	// connection is kept open, so user lock and request slot can not be held
+	req.handler.mu.Unlock()
+	req.handler.release()
+	defer req.handler.mu.Lock()
+	defer req.handler.wait()
+
+	s := websocket.Server{
+		Handshake: checkWatchOrigin,
+		Handler: func(ws *websocket.Conn) {
+			// server write timeout does not apply to long-lived connection
+			_ = ws.SetDeadline(time.Time{})
+
+			events, unsubscribe := subscribe(fullPath, wiki)
+			defer unsubscribe()
+
+			closed := make(chan struct{})
+			go func() {
+				var msg string
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+				close(closed)
+			}()
+
+			for {
+				select {
+				case ev := <-events:
+					if err := websocket.JSON.Send(ws, ev); err != nil {
+						log.Printf("watch %s error: %v\n", fullPath, err)
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		},
+	}
+
+	s.ServeHTTP(w, r)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const webhookCacheSize = 1024
+
+var (
+	webhookURL      string
+	webhookTimeout  time.Duration
+	webhookCacheTTL time.Duration
+
+	webhookClient = &http.Client{Transport: &tracingTransport{}}
+	webhookCache  = newAuthCache(webhookCacheSize)
+)
+
+type authCacheEntry struct {
+	key     string
+	expires time.Time
+}
+
+// authCache is LRU cache of successful authentications.
+type authCache struct {
+	mu    sync.Mutex
+	max   int
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+func newAuthCache(max int) *authCache {
+	return &authCache{
+		max:   max,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+func authCacheKey(user, pass, ip string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + pass + "\x00" + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *authCache) valid(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return false
+	}
+
+	if now.After(elem.Value.(*authCacheEntry).expires) {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+		return false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return true
+}
+
+func (c *authCache) add(key string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*authCacheEntry).expires = expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&authCacheEntry{key: key, expires: expires})
+
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*authCacheEntry).key)
+	}
+}
+
+// webhookAuthenticate ask -auth.webhook-url if credentials are valid.
+// Only 200 response means success; errors are treated as failure.
+func webhookAuthenticate(ctx context.Context, user, pass, ip string) bool {
+	now := time.Now()
+	key := authCacheKey(user, pass, ip)
+
+	if webhookCacheTTL > 0 && webhookCache.valid(key, now) {
+		return true
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"username":  user,
+		"password":  pass,
+		"client_ip": ip,
+	})
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("auth webhook error: %v\n", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		log.Printf("auth webhook error: %v\n", err)
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	if webhookCacheTTL > 0 {
+		webhookCache.add(key, now.Add(webhookCacheTTL))
+	}
+
+	return true
+}
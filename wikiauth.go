@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// wikiPassExt is extension of per-wiki password file, e.g.
+// notes.html.htpasswd protects notes.html.
+const wikiPassExt = ".htpasswd"
+
+// checkWikiAccess check credentials against per-wiki .htpasswd file. Users
+// authenticated by certificate, OpenID Connect or Digest auth only have to
+// be listed there; password of Digest auth is never sent. Without global auth credentials are taken from Basic auth. Return
+// 0 when access is allowed, otherwise HTTP status to respond with.
+func checkWikiAccess(r *http.Request, auth, user, pass, fullPath string) int {
+	users, err := readHTPasswd(fullPath + wikiPassExt)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0
+		}
+		log.Printf("read %s error: %v\n", fullPath+wikiPassExt, err)
+		return http.StatusInternalServerError
+	}
+
+	var ok bool
+
+	switch auth {
+	case "mtls", "oidc", "digest":
+		if _, ok = users[user]; ok {
+			return 0
+		}
+		return http.StatusForbidden
+	case "basic", "header", "webhook":
+		if totp != nil && r.Header.Get(totpHeader) == "" {
+			pass, _ = totp.splitTOTP(user, pass)
+		}
+	default:
+		user, pass, ok = r.BasicAuth()
+		if !ok {
+			return http.StatusUnauthorized
+		}
+	}
+
+	hash, ok := users[user]
+	if !ok || bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return http.StatusForbidden
+	}
+
+	return 0
+}
+
+// wikiAccessError write response for status returned by checkWikiAccess.
+func wikiAccessError(w http.ResponseWriter, code int) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="widdler"`)
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// wikiAccess check per-wiki password of wiki in fullPath for API requests.
+func (req *apiRequest) wikiAccess(r *http.Request, fullPath string) int {
+	return checkWikiAccess(r, req.site.auth, req.user, req.pass, fullPath)
+}
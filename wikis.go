@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resolveWiki return absolute path of wiki inside user directory or empty
+// string when name is invalid.
+func resolveWiki(userPath, wiki string) string {
+	fullPath := filepath.Clean(path.Join(userPath, wiki))
+	if !strings.HasSuffix(wiki, ".html") || !strings.HasPrefix(fullPath, userPath+"/") {
+		return ""
+	}
+	return fullPath
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("copy %s error: %w", src, err)
+	}
+
+	return out.Close()
+}
+
+// copyBackups copy backup history of wiki to new backup path. Delta backups
+// refer to their base by name, so they are stored as full copies.
+func copyBackups(srcBackupPath, dstBackupPath string) error {
+	backups, err := listBackups(srcBackupPath)
+	if err != nil {
+		return err
+	}
+
+	srcBase := strings.TrimSuffix(filepath.Base(srcBackupPath), filepath.Ext(srcBackupPath))
+	dstBase := strings.TrimSuffix(filepath.Base(dstBackupPath), filepath.Ext(dstBackupPath))
+
+	if err := os.MkdirAll(filepath.Dir(dstBackupPath), 0o700); err != nil {
+		return err
+	}
+
+	for i := range backups {
+		b := &backups[i]
+		name := dstBase + strings.TrimPrefix(b.Name, srcBase)
+		dst := filepath.Join(filepath.Dir(dstBackupPath), name)
+
+		if !b.Delta {
+			if err := copyFile(b.path, dst); err != nil {
+				return err
+			}
+			if b.SHA256 != "" {
+				if err := recordBackup(dst, b.SHA256); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		data, err := readBackup(backups, b)
+		if err != nil {
+			return err
+		}
+
+		dst = backupStem(dst)
+		if err := os.WriteFile(dst, data, 0o600); err != nil {
+			return fmt.Errorf("write backup %s error: %w", dst, err)
+		}
+
+		if err := recordBackup(dst, sha256Hex(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeBackups(backupPath string) error {
+	backups, err := listBackups(backupPath)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range backups {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(b.path + checksumExt)
+	}
+
+	return nil
+}
+
+type wikiInfo struct {
+	User        string    `json:"user,omitempty"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url,omitempty"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+	ModifiedAt  time.Time `json:"modified_at"`
+	BackupCount int       `json:"backup_count"`
+
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+}
+
+type wikiList struct {
+	TotalSizeBytes int64      `json:"total_size_bytes"`
+	Wikis          []wikiInfo `json:"wikis"`
+}
+
+// listWikis return information about wikis in user directory. File systems
+// do not reliably keep creation time, so the time of the oldest backup is
+// used when it predates the last modification.
+func listWikis(req *apiRequest) (*wikiList, error) {
+	entries, err := os.ReadDir(req.userPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	result := &wikiList{Wikis: []wikiInfo{}}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".html") {
+			continue
+		}
+
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		info := wikiInfo{
+			Name:       e.Name(),
+			URL:        "/" + url.PathEscape(e.Name()),
+			SizeBytes:  fi.Size(),
+			CreatedAt:  fi.ModTime(),
+			ModifiedAt: fi.ModTime(),
+		}
+
+		if last, ok := lastAccess(filepath.Join(req.userPath, e.Name())); ok {
+			info.LastAccessedAt = &last
+		}
+
+		backups, err := listBackups(wikiBackupPath(req.site, req.user, e.Name()))
+		if err == nil && len(backups) > 0 {
+			info.BackupCount = len(backups)
+			if oldest := backups[len(backups)-1].CreatedAt; oldest.Before(info.CreatedAt) {
+				info.CreatedAt = oldest
+			}
+		}
+
+		result.TotalSizeBytes += info.SizeBytes
+		result.Wikis = append(result.Wikis, info)
+	}
+
+	return result, nil
+}
+
+// serveWikiList handle GET /api/v1/wikis?sort=<field>&order=<asc|desc>.
+func serveWikiList(w http.ResponseWriter, r *http.Request, req *apiRequest) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	list, err := listWikis(req)
+	if err != nil {
+		log.Println(err)
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var less func(a, b *wikiInfo) bool
+	switch r.URL.Query().Get("sort") {
+	case "", "name":
+		less = func(a, b *wikiInfo) bool { return a.Name < b.Name }
+	case "size_bytes":
+		less = func(a, b *wikiInfo) bool { return a.SizeBytes < b.SizeBytes }
+	case "created_at":
+		less = func(a, b *wikiInfo) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	case "modified_at":
+		less = func(a, b *wikiInfo) bool { return a.ModifiedAt.Before(b.ModifiedAt) }
+	case "last_accessed_at":
+		less = func(a, b *wikiInfo) bool {
+			return a.LastAccessedAt == nil && b.LastAccessedAt != nil ||
+				a.LastAccessedAt != nil && b.LastAccessedAt != nil && a.LastAccessedAt.Before(*b.LastAccessedAt)
+		}
+	case "backup_count":
+		less = func(a, b *wikiInfo) bool { return a.BackupCount < b.BackupCount }
+	default:
+		jsonError(w, http.StatusBadRequest, "invalid sort field")
+		return
+	}
+
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+	case "desc":
+		asc := less
+		less = func(a, b *wikiInfo) bool { return asc(b, a) }
+	default:
+		jsonError(w, http.StatusBadRequest, "invalid order")
+		return
+	}
+
+	sort.SliceStable(list.Wikis, func(i, j int) bool {
+		return less(&list.Wikis[i], &list.Wikis[j])
+	})
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// serveWikis handle /api/v1/wikis/<wiki>/copy?dest=<wiki>,
+// /api/v1/wikis/<wiki>/move?dest=<wiki> and /api/v1/wikis/<wiki>/rename
+// with {"new_name": <wiki>} body. Copy include backups when backups=1 is
+// given; rename keeps backups under the new name, move removes them.
+func serveWikis(w http.ResponseWriter, r *http.Request, req *apiRequest, route string) {
+	idx := strings.LastIndex(route, "/")
+	if idx < 0 {
+		jsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	wiki, action := route[:idx], route[idx+1:]
+	if action != "copy" && action != "move" && action != "rename" {
+		jsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	dest := r.URL.Query().Get("dest")
+	if action == "rename" {
+		var body struct {
+			NewName string `json:"new_name"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&body); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		dest = body.NewName
+	}
+	srcPath := resolveWiki(req.userPath, wiki)
+	dstPath := resolveWiki(req.userPath, dest)
+	if srcPath == "" || dstPath == "" || srcPath == dstPath {
+		jsonError(w, http.StatusBadRequest, "invalid wiki name")
+		return
+	}
+
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "wiki not found")
+		return
+	}
+
+	if code := req.wikiAccess(r, srcPath); code != 0 {
+		jsonError(w, code, http.StatusText(code))
+		return
+	}
+
+	if _, err := os.Stat(dstPath); err == nil {
+		jsonError(w, http.StatusConflict, "destination exists")
+		return
+	}
+
+	if isReadOnly(dstPath) || (action != "copy" && isReadOnly(srcPath)) {
+		jsonError(w, http.StatusMethodNotAllowed, "wiki is read-only")
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o700); err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	srcBackupPath := wikiBackupPath(req.site, req.user, wiki)
+	dstBackupPath := wikiBackupPath(req.site, req.user, dest)
+
+	defer req.handler.invalidateUsage()
+
+	if action == "copy" {
+		over, err := req.handler.exceedsQuota(req.userPath, dstPath, fi.Size())
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if over {
+			jsonError(w, http.StatusInsufficientStorage, "quota exceeded")
+			return
+		}
+
+		if err := copyFile(srcPath, dstPath); err != nil {
+			log.Println(err)
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if r.URL.Query().Get("backups") == "1" {
+			if err := copyBackups(srcBackupPath, dstBackupPath); err != nil {
+				log.Printf("copy backups of %s error: %v\n", srcPath, err)
+				jsonError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		log.Printf("%s copied %s to %s\n", req.user, srcPath, dstPath)
+		writeJSON(w, http.StatusCreated, map[string]string{"wiki": dest})
+		return
+	}
+
+	if action == "rename" {
+		if err := renameWiki(srcPath, dstPath, srcBackupPath, dstBackupPath); err != nil {
+			log.Printf("rename %s error: %v\n", srcPath, err)
+			code := http.StatusInternalServerError
+			if errors.Is(err, os.ErrExist) {
+				code = http.StatusConflict
+			}
+			jsonError(w, code, err.Error())
+			return
+		}
+
+		moveBackupAge(srcPath, dstPath)
+		storeCache.Delete(srcPath + storeExt)
+		if req.handler.cache != nil {
+			req.handler.cache.invalidate(srcPath)
+		}
+
+		log.Printf("%s renamed %s to %s\n", req.user, srcPath, dstPath)
+		writeJSON(w, http.StatusOK, map[string]string{"wiki": dest, "url": "/" + dest})
+		return
+	}
+
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		log.Println(err)
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// per-wiki password file follows the wiki
+	if err := os.Rename(srcPath+wikiPassExt, dstPath+wikiPassExt); err != nil && !os.IsNotExist(err) {
+		log.Printf("rename %s error: %v\n", srcPath+wikiPassExt, err)
+	}
+	if err := os.Rename(srcPath+storeExt, dstPath+storeExt); err != nil && !os.IsNotExist(err) {
+		log.Printf("rename %s error: %v\n", srcPath+storeExt, err)
+	}
+
+	moveBackupAge(srcPath, dstPath)
+	storeCache.Delete(srcPath + storeExt)
+
+	if req.handler.cache != nil {
+		req.handler.cache.invalidate(srcPath)
+	}
+
+	if err := removeBackups(srcBackupPath); err != nil {
+		log.Printf("remove backups of %s error: %v\n", srcPath, err)
+	}
+
+	log.Printf("%s moved %s to %s\n", req.user, srcPath, dstPath)
+	writeJSON(w, http.StatusOK, map[string]string{"wiki": dest})
+}